@@ -0,0 +1,39 @@
+package powerdns
+
+import (
+	"context"
+	"net/netip"
+	"time"
+
+	"github.com/libdns/libdns"
+)
+
+// AppendAddresses adds the addresses to name in the zone.  IPv4 addresses
+// go into the A rrset and IPv6 addresses into the AAAA rrset, so a
+// dual-stack host can be provisioned with a single call.  IPv4-mapped IPv6
+// addresses are treated as IPv4.
+func (p *Provider) AppendAddresses(ctx context.Context, zone, name string, ips []netip.Addr, ttl time.Duration) ([]libdns.Record, error) {
+	return p.AppendRecords(ctx, zone, addressRecords(name, ips, ttl))
+}
+
+// SetAddresses makes the addresses the only ones for name in the zone,
+// using the semantics of SetRecords.  Only the address families present in
+// ips are replaced: passing only IPv4 addresses leaves an existing AAAA
+// rrset alone.
+func (p *Provider) SetAddresses(ctx context.Context, zone, name string, ips []netip.Addr, ttl time.Duration) ([]libdns.Record, error) {
+	return p.SetRecords(ctx, zone, addressRecords(name, ips, ttl))
+}
+
+// DeleteAddresses removes the addresses from name in the zone.  The ttl is
+// only used to build the records and is not matched against the zone.
+func (p *Provider) DeleteAddresses(ctx context.Context, zone, name string, ips []netip.Addr, ttl time.Duration) ([]libdns.Record, error) {
+	return p.DeleteRecords(ctx, zone, addressRecords(name, ips, ttl))
+}
+
+func addressRecords(name string, ips []netip.Addr, ttl time.Duration) []libdns.Record {
+	records := make([]libdns.Record, 0, len(ips))
+	for _, ip := range ips {
+		records = append(records, libdns.Address{Name: name, TTL: ttl, IP: ip.Unmap()})
+	}
+	return records
+}
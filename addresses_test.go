@@ -0,0 +1,66 @@
+package powerdns
+
+import (
+	"context"
+	"net/netip"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/joeig/go-powerdns/v3"
+)
+
+func TestAddresses(t *testing.T) {
+	ctx := context.Background()
+	f := newFakePDNS(t)
+	f.AddZone("example.org.",
+		rrset("host.example.org.", "A", 60, "192.0.2.1"),
+		rrset("host.example.org.", "AAAA", 60, "2001:db8::1"),
+	)
+	p := f.provider()
+	addrs := func(s ...string) []netip.Addr {
+		var out []netip.Addr
+		for _, a := range s {
+			out = append(out, netip.MustParseAddr(a))
+		}
+		return out
+	}
+	check := func(t *testing.T, rrType string, want ...string) {
+		t.Helper()
+		got := rrsetContents(f.RRset("example.org.", "host.example.org.", rrType))
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%s rrset: have %v want %v", rrType, got, want)
+		}
+	}
+
+	_, err := p.AppendAddresses(ctx, "example.org.", "host", addrs("192.0.2.2", "2001:db8::2", "::ffff:192.0.2.3"), time.Minute)
+	if err != nil {
+		t.Fatalf("AppendAddresses: %s", err)
+	}
+	check(t, "A", "192.0.2.1", "192.0.2.2", "192.0.2.3")
+	check(t, "AAAA", "2001:db8::1", "2001:db8::2")
+
+	_, err = p.SetAddresses(ctx, "example.org.", "host", addrs("192.0.2.9", "2001:db8::9"), 5*time.Minute)
+	if err != nil {
+		t.Fatalf("SetAddresses: %s", err)
+	}
+	check(t, "A", "192.0.2.9")
+	check(t, "AAAA", "2001:db8::9")
+	if ttl := powerdns.Uint32Value(f.RRset("example.org.", "host.example.org.", "AAAA").TTL); ttl != 300 {
+		t.Errorf("expected TTL 300, got %d", ttl)
+	}
+
+	_, err = p.SetAddresses(ctx, "example.org.", "host", addrs("192.0.2.10"), 5*time.Minute)
+	if err != nil {
+		t.Fatalf("SetAddresses: %s", err)
+	}
+	check(t, "A", "192.0.2.10")
+	check(t, "AAAA", "2001:db8::9")
+
+	_, err = p.DeleteAddresses(ctx, "example.org.", "host", addrs("192.0.2.10", "2001:db8::9"), 0)
+	if err != nil {
+		t.Fatalf("DeleteAddresses: %s", err)
+	}
+	check(t, "A")
+	check(t, "AAAA")
+}
@@ -0,0 +1,90 @@
+package powerdns
+
+import (
+	"context"
+
+	"github.com/joeig/go-powerdns/v3"
+	"github.com/libdns/libdns"
+)
+
+// Apply sets the upserts and deletes the deletes in a single atomic PATCH,
+// so either the zone ends up with all of the changes or with none.  The
+// upserts are treated like the records of SetRecords, the deletes like
+// those of DeleteRecords.  Deletes act on the zone as it is after the
+// upserts, so a record in both is removed.  It returns the upserts
+// followed by the deletes.
+func (p *Provider) Apply(ctx context.Context, zone string, upserts, deletes []libdns.Record) ([]libdns.Record, error) {
+	zone = p.normalizeZone(zone)
+	absUpserts, err := convertNamesToAbsolute(zone, upserts)
+	if err != nil {
+		return nil, err
+	}
+	absUpserts = p.withDefaultTTL(absUpserts)
+	absDeletes, err := convertNamesToAbsolute(zone, deletes)
+	if err != nil {
+		return nil, err
+	}
+	wholeRRsets(deletes, absDeletes)
+	pl, err := p.checkedPlan(ctx, zone, func() (writePlan, error) {
+		c, err := p.client(ctx)
+		if err != nil {
+			return writePlan{}, err
+		}
+		fullZone, err := p.writableZone(ctx, c, zone)
+		if err != nil {
+			return writePlan{}, p.zoneError(zone, err)
+		}
+		return writePlan{c: c, before: fullZone, changes: p.keepApex(zone, planApply(fullZone, absUpserts, absDeletes))}, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	records := append(append(make([]libdns.Record, 0, len(upserts)+len(deletes)), upserts...), deletes...)
+	if _, err := p.apply(ctx, pl.c, zone, pl.before, records, pl.changes, true); err != nil {
+		return nil, err
+	}
+	return records, nil
+}
+
+// planApply plans the upserts as planSet does, then the deletes as
+// planDelete does against the zone with the upserts in place.  Inputs of
+// the deletes are numbered after the upserts.  An rrset touched by both
+// ends up as a single change, since PowerDNS refuses a PATCH naming an
+// rrset twice.
+func planApply(zone *powerdns.Zone, upserts, deletes []libdns.RR) []rrsetChange {
+	changes := planSet(zone, upserts)
+
+	upserted := &powerdns.Zone{Name: zone.Name}
+	byKey := make(map[string]int, len(changes))
+	for i, ch := range changes {
+		byKey[key(ch.name, ch.rrType)] = i
+	}
+	for _, rrset := range zone.RRsets {
+		if rrset.Type == nil {
+			continue
+		}
+		if _, ok := byKey[key(powerdns.StringValue(rrset.Name), string(*rrset.Type))]; !ok {
+			upserted.RRsets = append(upserted.RRsets, rrset)
+		}
+	}
+	for _, ch := range changes {
+		upserted.RRsets = append(upserted.RRsets, changesToRRsets([]rrsetChange{ch}).Sets[0])
+	}
+
+	for _, del := range planDelete(upserted, deletes) {
+		for i := range del.inputs {
+			del.inputs[i] += len(upserts)
+		}
+		i, ok := byKey[key(del.name, del.rrType)]
+		if !ok {
+			changes = append(changes, del)
+			continue
+		}
+		changes[i].contents = del.contents
+		changes[i].disabled = del.disabled
+		changes[i].inputs = append(changes[i].inputs, del.inputs...)
+		changes[i].applied = append(changes[i].applied, del.applied...)
+	}
+	return changes
+}
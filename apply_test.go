@@ -0,0 +1,63 @@
+package powerdns
+
+import (
+	"context"
+	"net/netip"
+	"reflect"
+	"testing"
+
+	"github.com/libdns/libdns"
+)
+
+func TestApply(t *testing.T) {
+	ctx := context.Background()
+	f := newFakePDNS(t)
+	f.AddZone("example.org.",
+		rrset("www.example.org.", "A", 60, "127.0.0.1", "127.0.0.2"),
+		rrset("old.example.org.", "A", 60, "127.0.0.3"),
+		rrset("txt.example.org.", "TXT", 60, `"keep"`, `"drop"`),
+	)
+	p := f.provider()
+
+	recs, err := p.Apply(ctx, "example.org.",
+		[]libdns.Record{
+			libdns.Address{Name: "www", IP: netip.MustParseAddr("127.0.0.9")},
+			libdns.Address{Name: "new", IP: netip.MustParseAddr("127.0.0.4")},
+			libdns.Address{Name: "new", IP: netip.MustParseAddr("127.0.0.5")},
+		},
+		[]libdns.Record{
+			libdns.Address{Name: "old", IP: netip.MustParseAddr("127.0.0.3")},
+			libdns.TXT{Name: "txt", Text: "drop"},
+			// deletes act on the upserted zone
+			libdns.Address{Name: "new", IP: netip.MustParseAddr("127.0.0.5")},
+		},
+	)
+	if err != nil {
+		t.Fatalf("Apply: %s", err)
+	}
+	if len(recs) != 6 {
+		t.Errorf("expected the upserts and deletes back, got %d records", len(recs))
+	}
+	if len(f.Patches) != 1 {
+		t.Fatalf("expected a single PATCH, got %d", len(f.Patches))
+	}
+	if n := len(f.Patches[0]); n != 4 {
+		t.Errorf("expected 4 rrsets in the PATCH, got %d", n)
+	}
+
+	for _, tst := range []struct {
+		name, rrType string
+		want         []string
+	}{
+		{"www.example.org.", "A", []string{"127.0.0.9"}},
+		{"new.example.org.", "A", []string{"127.0.0.4"}},
+		{"txt.example.org.", "TXT", []string{`"keep"`}},
+	} {
+		if got := rrsetContents(f.RRset("example.org.", tst.name, tst.rrType)); !reflect.DeepEqual(got, tst.want) {
+			t.Errorf("%s %s: have %v want %v", tst.name, tst.rrType, got, tst.want)
+		}
+	}
+	if f.RRset("example.org.", "old.example.org.", "A") != nil {
+		t.Errorf("old.example.org. was not deleted")
+	}
+}
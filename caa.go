@@ -0,0 +1,99 @@
+package powerdns
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/libdns/libdns"
+)
+
+// caaToRR formats a CAA record as PowerDNS expects it: flags, tag and the
+// value as a quoted character string.  libdns quotes the value the Go way,
+// which differs from zone file quoting for anything but plain ASCII.
+func caaToRR(c libdns.CAA) libdns.RR {
+	return libdns.RR{
+		Name: c.Name,
+		TTL:  c.TTL,
+		Type: "CAA",
+		Data: fmt.Sprintf("%d %s %s", c.Flags, c.Tag, quoteCharString(c.Value)),
+	}
+}
+
+// parseCAA turns CAA data in zone file form back into a libdns.CAA
+func parseCAA(rr libdns.RR) (libdns.Record, error) {
+	fields := strings.SplitN(strings.TrimSpace(rr.Data), " ", 3)
+	if len(fields) != 3 {
+		return nil, fmt.Errorf(`malformed CAA value %q; expected 'flags tag "value"'`, rr.Data)
+	}
+	flags, err := strconv.ParseUint(fields[0], 10, 8)
+	if err != nil {
+		return nil, fmt.Errorf("invalid CAA flags %s: %v", fields[0], err)
+	}
+	value, err := unquoteCharString(strings.TrimSpace(fields[2]))
+	if err != nil {
+		return nil, fmt.Errorf("invalid CAA value %s: %v", fields[2], err)
+	}
+	return libdns.CAA{
+		Name:  rr.Name,
+		TTL:   rr.TTL,
+		Flags: uint8(flags),
+		Tag:   fields[1],
+		Value: value,
+	}, nil
+}
+
+// quoteCharString quotes s as a zone file character string: quotes and
+// backslashes are escaped with a backslash, and bytes outside printable
+// ASCII are written as \DDD.
+func quoteCharString(s string) string {
+	var b strings.Builder
+	b.WriteByte('"')
+	for i := 0; i < len(s); i++ {
+		ch := s[i]
+		switch {
+		case ch == '"' || ch == '\\':
+			b.WriteByte('\\')
+			b.WriteByte(ch)
+		case ch < ' ' || ch > '~':
+			fmt.Fprintf(&b, "\\%03d", ch)
+		default:
+			b.WriteByte(ch)
+		}
+	}
+	b.WriteByte('"')
+	return b.String()
+}
+
+// unquoteCharString undoes quoteCharString.  The quotes are optional, so
+// a bare word is returned as is apart from its escapes.
+func unquoteCharString(s string) (string, error) {
+	if len(s) >= 2 && s[0] == '"' && s[len(s)-1] == '"' {
+		s = s[1 : len(s)-1]
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' {
+			b.WriteByte(s[i])
+			continue
+		}
+		i++
+		if i == len(s) {
+			return "", fmt.Errorf("trailing backslash")
+		}
+		if s[i] < '0' || s[i] > '9' {
+			b.WriteByte(s[i])
+			continue
+		}
+		if i+3 > len(s) {
+			return "", fmt.Errorf("short \\DDD escape")
+		}
+		n, err := strconv.ParseUint(s[i:i+3], 10, 8)
+		if err != nil {
+			return "", fmt.Errorf("invalid \\DDD escape: %v", err)
+		}
+		b.WriteByte(byte(n))
+		i += 2
+	}
+	return b.String(), nil
+}
@@ -0,0 +1,81 @@
+package powerdns
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/libdns/libdns"
+)
+
+func TestCAARoundTrip(t *testing.T) {
+	ctx := context.Background()
+	f := newFakePDNS(t)
+	f.AddZone("example.org.")
+	p := f.provider()
+
+	in := []libdns.CAA{
+		{Name: "@", Flags: 128, Tag: "issue", Value: "letsencrypt.org; validationmethods=dns-01"},
+		{Name: "@", Flags: 0, Tag: "issuewild", Value: ";"},
+		{Name: "@", Flags: 0, Tag: "iodef", Value: "mailto:security@example.org"},
+		{Name: "odd", Flags: 0, Tag: "issue", Value: `ca "quoted" \\ é`},
+	}
+	recs := make([]libdns.Record, len(in))
+	for i, c := range in {
+		recs[i] = c
+	}
+	if _, err := p.AppendRecords(ctx, "example.org.", recs); err != nil {
+		t.Fatalf("AppendRecords: %s", err)
+	}
+	want := []string{
+		`128 issue "letsencrypt.org; validationmethods=dns-01"`,
+		`0 issuewild ";"`,
+		`0 iodef "mailto:security@example.org"`,
+	}
+	if got := rrsetContents(f.RRset("example.org.", "example.org.", "CAA")); !reflect.DeepEqual(got, want) {
+		t.Errorf("unexpected CAA contents:\nhave %q\nwant %q", got, want)
+	}
+	if got := rrsetContents(f.RRset("example.org.", "odd.example.org.", "CAA")); !reflect.DeepEqual(got, []string{`0 issue "ca \"quoted\" \\\\ \195\169"`}) {
+		t.Errorf("unexpected escaping: %q", got)
+	}
+
+	out, err := p.GetRecords(ctx, "example.org.")
+	if err != nil {
+		t.Fatalf("GetRecords: %s", err)
+	}
+	var got []libdns.CAA
+	for _, r := range out {
+		if c, ok := r.(libdns.CAA); ok {
+			c.TTL = 0
+			got = append(got, c)
+		}
+	}
+	if !reflect.DeepEqual(got, in) {
+		t.Errorf("CAA round trip:\nhave %#v\nwant %#v", got, in)
+	}
+}
+
+func TestUnquoteCharString(t *testing.T) {
+	for in, want := range map[string]string{
+		`"plain"`:             "plain",
+		`bare`:                "bare",
+		`"a\"b"`:              `a"b`,
+		`"\195\169t\195\169"`: "été",
+		`"back\\slash"`:       `back\slash`,
+	} {
+		got, err := unquoteCharString(in)
+		if err != nil || got != want {
+			t.Errorf("unquoteCharString(%s) = %q, %v, want %q", in, got, err, want)
+		}
+		if quoted := quoteCharString(want); in[0] == '"' {
+			if back, _ := unquoteCharString(quoted); back != want {
+				t.Errorf("quoteCharString(%q) = %s does not round trip", want, quoted)
+			}
+		}
+	}
+	for _, bad := range []string{`"trailing\"`, `"\12"`, `"\999"`} {
+		if _, err := unquoteCharString(bad); err == nil {
+			t.Errorf("unquoteCharString(%s) should fail", bad)
+		}
+	}
+}
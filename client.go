@@ -2,19 +2,37 @@ package powerdns
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"log/slog"
 	"net/http"
 	"net/http/httputil"
+	"net/netip"
+	"net/url"
+	"regexp"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/joeig/go-powerdns/v3"
 	"github.com/libdns/libdns"
 	"github.com/libdns/powerdns/txtsanitize"
+	"golang.org/x/time/rate"
 )
 
 type client struct {
 	*powerdns.Client
+
+	// httpClient and apiToken are what the powerdns.Client was built with,
+	// kept for the few requests it has no method for.
+	httpClient *http.Client
+	apiToken   string
+
+	serverMu sync.Mutex
+	server   *powerdns.Server
 }
 
 // debugTransport wraps http.RoundTripper to log requests/responses
@@ -38,40 +56,254 @@ func (d *debugTransport) RoundTrip(req *http.Request) (*http.Response, error) {
 	return resp, nil
 }
 
-func newClient(serverID, serverURL, apiToken string, debug io.Writer) (*client, error) {
-	opts := []powerdns.NewOption{
-		powerdns.WithAPIKey(apiToken),
+// logTransport wraps http.RoundTripper to log requests/responses through
+// slog at debug level, with the API key masked
+type logTransport struct {
+	transport http.RoundTripper
+	logger    *slog.Logger
+}
+
+var apiKeyHeader = regexp.MustCompile(`(?im)^(X-Api-Key:) .*$`)
+
+func (l *logTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx := req.Context()
+	if !l.logger.Enabled(ctx, slog.LevelDebug) {
+		return l.transport.RoundTrip(req)
+	}
+
+	dump, _ := httputil.DumpRequestOut(req, true)
+	l.logger.DebugContext(ctx, "powerdns request",
+		"method", req.Method,
+		"url", req.URL.String(),
+		"dump", apiKeyHeader.ReplaceAllString(string(dump), "$1 REDACTED"))
+
+	start := time.Now()
+	resp, err := l.transport.RoundTrip(req)
+	if err != nil {
+		l.logger.DebugContext(ctx, "powerdns request failed", "url", req.URL.String(), "error", err)
+		return resp, err
 	}
 
-	if debug != nil {
-		httpClient := &http.Client{
-			Transport: &debugTransport{
-				transport: http.DefaultTransport,
+	dump, _ = httputil.DumpResponse(resp, true)
+	l.logger.DebugContext(ctx, "powerdns response",
+		"url", req.URL.String(),
+		"status", resp.StatusCode,
+		"duration", time.Since(start),
+		"dump", string(dump))
+
+	return resp, nil
+}
+
+func newClient(serverID, serverURL, apiToken string, httpClient *http.Client, debug io.Writer, logger *slog.Logger, maxRetries int, maxRetryAfter time.Duration, limiter *rate.Limiter, userAgent string, hook func(context.Context, string, string, error, time.Duration)) (*client, error) {
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	if hook != nil {
+		transport := httpClient.Transport
+		if transport == nil {
+			transport = http.DefaultTransport
+		}
+		wrapped := *httpClient
+		wrapped.Transport = &hookTransport{
+			transport: transport,
+			hook:      hook,
+		}
+		httpClient = &wrapped
+	}
+	if logger != nil || debug != nil {
+		transport := httpClient.Transport
+		if transport == nil {
+			transport = http.DefaultTransport
+		}
+		wrapped := *httpClient
+		if logger != nil {
+			wrapped.Transport = &logTransport{
+				transport: transport,
+				logger:    logger,
+			}
+		} else {
+			wrapped.Transport = &debugTransport{
+				transport: transport,
 				output:    debug,
-			},
+			}
+		}
+		httpClient = &wrapped
+	}
+	if limiter != nil {
+		// inside of the retries, so every attempt is throttled
+		transport := httpClient.Transport
+		if transport == nil {
+			transport = http.DefaultTransport
+		}
+		wrapped := *httpClient
+		wrapped.Transport = &rateLimitTransport{
+			transport: transport,
+			limiter:   limiter,
 		}
-		opts = append(opts, powerdns.WithHTTPClient(httpClient))
+		httpClient = &wrapped
 	}
+	// outside of the logging, so every attempt is logged, and installed
+	// even without MaxRetries, as a 429 with Retry-After is retried anyway
+	transport := httpClient.Transport
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+	wrapped := *httpClient
+	wrapped.Transport = &retryTransport{
+		transport:     transport,
+		retries:       max(maxRetries, 0),
+		maxRetryAfter: maxRetryAfter,
+	}
+	httpClient = &wrapped
 
+	opts := []powerdns.NewOption{
+		powerdns.WithAPIKey(apiToken),
+		powerdns.WithHTTPClient(httpClient),
+	}
+	if userAgent != "" {
+		// the headers are set after the library's own User-Agent
+		opts = append(opts, powerdns.WithHeaders(map[string]string{"User-Agent": userAgent}))
+	}
 	c := powerdns.New(serverURL, serverID, opts...)
-	return &client{Client: c}, nil
+	return &client{Client: c, httpClient: httpClient, apiToken: apiToken}, nil
 }
 
-// getZone retrieves the full zone with all RRsets
+// getZone retrieves the full zone with all RRsets, mapping a missing zone
+// to ErrZoneNotFound and decoding problems to ErrSchemaMismatch
 func (c *client) getZone(ctx context.Context, zoneName string) (*powerdns.Zone, error) {
-	return c.Zones.Get(ctx, zoneName)
+	zone, err := c.Zones.Get(ctx, zoneName)
+	if err != nil {
+		return nil, c.checkSchema(ctx, wrapAPIError(err, zoneName))
+	}
+	return zone, nil
+}
+
+// zoneSerial fetches the current SOA serial of the zone.  The rrsets are
+// left out on servers that support that; older ones send them anyway.
+func (c *client) zoneSerial(ctx context.Context, zoneName string) (uint32, error) {
+	resp, err := c.doRaw(ctx, http.MethodGet, "zones/"+canonicalZone(zoneName), url.Values{"rrsets": {"false"}}, nil)
+	if err != nil {
+		return 0, wrapAPIError(err, zoneName)
+	}
+	defer resp.Body.Close()
+	var zone powerdns.Zone
+	if err := json.NewDecoder(resp.Body).Decode(&zone); err != nil {
+		return 0, c.checkSchema(ctx, err)
+	}
+	return powerdns.Uint32Value(zone.Serial), nil
+}
+
+// serverEntry returns the server's own entry, with its id, daemon type
+// and version.  It is fetched once and then remembered.
+func (c *client) serverEntry(ctx context.Context) (*powerdns.Server, error) {
+	c.serverMu.Lock()
+	defer c.serverMu.Unlock()
+	if c.server == nil {
+		server, err := c.Servers.Get(ctx, c.VHost)
+		if err != nil {
+			return nil, wrapAPIError(err, "")
+		}
+		c.server = server
+	}
+	return c.server, nil
 }
 
-// findRRset finds an RRset in a zone by name and type
+// serverVersion returns the version string of the PowerDNS server, see
+// serverEntry.
+func (c *client) serverVersion(ctx context.Context) (string, error) {
+	server, err := c.serverEntry(ctx)
+	if err != nil {
+		return "", err
+	}
+	return powerdns.StringValue(server.Version), nil
+}
+
+// requireVersion returns an error wrapping errors.ErrUnsupported if the
+// server is older than major.minor.  Versions that can't be parsed, such
+// as development builds, are assumed to be recent enough.
+func (c *client) requireVersion(ctx context.Context, feature string, major, minor int) error {
+	version, err := c.serverVersion(ctx)
+	if err != nil {
+		return err
+	}
+	if info := parseVersion(version); info.Known() && !info.AtLeast(major, minor) {
+		return fmt.Errorf("%s requires PowerDNS %d.%d or later, server runs %s: %w", feature, major, minor, version, errors.ErrUnsupported)
+	}
+	return nil
+}
+
+// deleteZone removes a zone, mapping a missing zone to ErrZoneNotFound
+func (c *client) deleteZone(ctx context.Context, zoneName string) error {
+	return wrapAPIError(c.Zones.Delete(ctx, zoneName), zoneName)
+}
+
+// findRRset finds an RRset in a zone by name and type.  Names are
+// compared regardless of case, as in DNS.
 func findRRset(zone *powerdns.Zone, name, rrType string) *powerdns.RRset {
 	for _, rrset := range zone.RRsets {
-		if powerdns.StringValue(rrset.Name) == name && rrset.Type != nil && string(*rrset.Type) == rrType {
+		if strings.EqualFold(powerdns.StringValue(rrset.Name), name) && rrset.Type != nil && string(*rrset.Type) == rrType {
 			return &rrset
 		}
 	}
 	return nil
 }
 
+// zoneRecords converts all rrsets of a zone into libdns records, with names
+// relative to zoneName.  Rrsets and their records are walked in the order
+// the server sent them.
+func zoneRecords(zone *powerdns.Zone, zoneName string) ([]RecordMeta, error) {
+	recs := make([]RecordMeta, 0)
+	for _, rrset := range zone.RRsets {
+		rrsetRecs, err := rrsetRecords(rrset, zoneName)
+		if err != nil {
+			return nil, err
+		}
+		recs = append(recs, rrsetRecs...)
+	}
+	return recs, nil
+}
+
+// rrsetRecords converts a single rrset into libdns records, with names
+// relative to zoneName.
+func rrsetRecords(rrset powerdns.RRset, zoneName string) ([]RecordMeta, error) {
+	if rrset.Type == nil {
+		return nil, nil
+	}
+	rrType := string(*rrset.Type)
+	rrName := powerdns.StringValue(rrset.Name)
+	ttl := time.Second * time.Duration(powerdns.Uint32Value(rrset.TTL))
+	comments := convertComments(rrset.Comments)
+	recs := make([]RecordMeta, 0, len(rrset.Records))
+	for _, r := range rrset.Records {
+		content := powerdns.StringValue(r.Content)
+		lrec, err := parseRecord(libdns.RR{
+			Type: rrType,
+			Name: libdns.RelativeName(rrName, zoneName),
+			Data: content,
+			TTL:  ttl,
+		})
+		if err != nil {
+			return nil, err
+		}
+		recs = append(recs, RecordMeta{
+			Record:   lrec,
+			Disabled: powerdns.BoolValue(r.Disabled),
+			Comments: comments,
+		})
+	}
+	return recs, nil
+}
+
+// ttlSeconds converts a TTL to whole seconds without going through a
+// float, the inverse of what rrsetRecords does.  A TTL under a second is
+// rounded up to one, as a TTL of zero means something else to resolvers.
+func ttlSeconds(ttl time.Duration) uint32 {
+	if ttl > 0 && ttl < time.Second {
+		return 1
+	}
+	return uint32(ttl / time.Second)
+}
+
 // rrsetContents extracts content strings from an RRset
 func rrsetContents(rrset *powerdns.RRset) []string {
 	if rrset == nil {
@@ -84,7 +316,35 @@ func rrsetContents(rrset *powerdns.RRset) []string {
 	return contents
 }
 
-// mergeContents merges existing contents with new ones, deduplicating
+// rrsetComments returns the comments of the rrset, which may be nil
+func rrsetComments(rrset *powerdns.RRset) []powerdns.Comment {
+	if rrset == nil {
+		return nil
+	}
+	return rrset.Comments
+}
+
+// rrsetDisabled returns the disabled values of the rrset, without a
+// trailing dot, or nil if there are none
+func rrsetDisabled(rrset *powerdns.RRset) map[string]bool {
+	if rrset == nil {
+		return nil
+	}
+	var disabled map[string]bool
+	for _, r := range rrset.Records {
+		if powerdns.BoolValue(r.Disabled) {
+			if disabled == nil {
+				disabled = make(map[string]bool)
+			}
+			disabled[strings.TrimSuffix(powerdns.StringValue(r.Content), ".")] = true
+		}
+	}
+	return disabled
+}
+
+// mergeContents merges existing contents with new ones, deduplicating.
+// The existing contents keep their order and new ones follow in input
+// order, so the same merge always gives the same result.
 func mergeContents(existing, new []string) []string {
 	seen := make(map[string]bool)
 	result := make([]string, 0, len(existing)+len(new))
@@ -106,7 +366,9 @@ func mergeContents(existing, new []string) []string {
 	return result
 }
 
-// removeContents removes specified contents from existing, returns remaining
+// removeContents removes specified contents from existing, returns remaining.
+// Survivors are copied into a fresh slice, so every occurrence of a removed
+// value goes, including adjacent duplicates, and existing is left intact.
 func removeContents(existing, toRemove []string) []string {
 	remove := make(map[string]bool)
 	for _, c := range toRemove {
@@ -122,47 +384,401 @@ func removeContents(existing, toRemove []string) []string {
 	return result
 }
 
+// key identifies the rrset of a name and type; names differing only in
+// case are the same
 func key(name, rrType string) string {
-	return name + ":" + rrType
+	return strings.ToLower(name) + ":" + rrType
 }
 
-func makeLDRecHash(records []libdns.RR) map[string][]libdns.RR {
-	// Keep track of records grouped by name + type
-	inHash := make(map[string][]libdns.RR)
-	for _, r := range records {
+// makeLDRecHash groups the records by name + type, as indexes into
+// records.  Groups are in order of first appearance so that the rrsets are
+// sent, and later read back, in input order.
+func makeLDRecHash(records []libdns.RR) [][]int {
+	var groups [][]int
+	inHash := make(map[string]int)
+	for i, r := range records {
 		k := key(r.Name, r.Type)
-		inHash[k] = append(inHash[k], r)
+		g, ok := inHash[k]
+		if !ok {
+			g = len(groups)
+			inHash[k] = g
+			groups = append(groups, nil)
+		}
+		groups[g] = append(groups[g], i)
 	}
-	return inHash
+	return groups
 }
 
-func convertNamesToAbsolute(zone string, records []libdns.Record) []libdns.RR {
-	out := make([]libdns.RR, len(records))
+// rrsetChange is the computed new state of a single name+type.  An empty
+// contents slice means the rrset is to be deleted.
+type rrsetChange struct {
+	name     string
+	rrType   string
+	ttl      uint32
+	contents []string
+
+	// comments are carried over from the existing rrset, since replacing
+	// an rrset would otherwise drop them.
+	comments []powerdns.Comment
+
+	// disabled holds the existing values, without a trailing dot, that are
+	// disabled and stay so.  Other values are written enabled.
+	disabled map[string]bool
+
+	// inputs holds the indexes of the input records that belong to this
+	// rrset, and applied whether each of them actually changes the zone.
+	inputs  []int
+	applied []bool
+}
+
+// planAppend merges the records into the existing rrsets of the zone
+func planAppend(zone *powerdns.Zone, records []libdns.RR) []rrsetChange {
+	changes := make([]rrsetChange, 0)
+	for _, idxs := range makeLDRecHash(records) {
+		first := records[idxs[0]]
+		existingRRset := findRRset(zone, first.Name, first.Type)
+		existing := rrsetContents(existingRRset)
+
+		seen := make(map[string]bool)
+		for _, c := range existing {
+			seen[strings.TrimSuffix(c, ".")] = true
+		}
+		newContents := make([]string, 0, len(idxs))
+		applied := make([]bool, len(idxs))
+		for i, idx := range idxs {
+			data := records[idx].Data
+			newContents = append(newContents, data)
+			normalized := strings.TrimSuffix(data, ".")
+			applied[i] = !seen[normalized]
+			seen[normalized] = true
+		}
+
+		changes = append(changes, rrsetChange{
+			name:     first.Name,
+			rrType:   first.Type,
+			ttl:      ttlSeconds(first.TTL),
+			contents: mergeContents(existing, newContents),
+			comments: rrsetComments(existingRRset),
+			disabled: rrsetDisabled(existingRRset),
+			inputs:   idxs,
+			applied:  applied,
+		})
+	}
+	return changes
+}
+
+// planSet replaces each rrset with exactly the given records
+func planSet(zone *powerdns.Zone, records []libdns.RR) []rrsetChange {
+	changes := make([]rrsetChange, 0)
+	for _, idxs := range makeLDRecHash(records) {
+		first := records[idxs[0]]
+		contents := make([]string, 0, len(idxs))
+		applied := make([]bool, len(idxs))
+		for i, idx := range idxs {
+			contents = append(contents, records[idx].Data)
+			applied[i] = true
+		}
+		changes = append(changes, rrsetChange{
+			name:     first.Name,
+			rrType:   first.Type,
+			ttl:      ttlSeconds(first.TTL),
+			contents: contents,
+			comments: rrsetComments(findRRset(zone, first.Name, first.Type)),
+			inputs:   idxs,
+			applied:  applied,
+		})
+	}
+	return changes
+}
+
+// planDelete removes the records from the existing rrsets of the zone.
+// Records whose rrset doesn't exist produce no change at all.
+func planDelete(zone *powerdns.Zone, records []libdns.RR) []rrsetChange {
+	changes := make([]rrsetChange, 0)
+	for _, idxs := range makeLDRecHash(records) {
+		first := records[idxs[0]]
+		existingRRset := findRRset(zone, first.Name, first.Type)
+		if existingRRset == nil {
+			// Nothing to delete
+			continue
+		}
+		existing := rrsetContents(existingRRset)
+
+		present := make(map[string]bool)
+		for _, c := range existing {
+			present[strings.TrimSuffix(c, ".")] = true
+		}
+		toRemove := make([]string, 0, len(idxs))
+		applied := make([]bool, len(idxs))
+		whole := false
+		for i, idx := range idxs {
+			data := records[idx].Data
+			if data == "" {
+				// see wholeRRsets
+				whole = true
+				applied[i] = true
+				continue
+			}
+			toRemove = append(toRemove, data)
+			applied[i] = present[strings.TrimSuffix(data, ".")]
+		}
+		contents := removeContents(existing, toRemove)
+		if whole {
+			contents = nil
+		}
+
+		changes = append(changes, rrsetChange{
+			name:     first.Name,
+			rrType:   first.Type,
+			ttl:      powerdns.Uint32Value(existingRRset.TTL),
+			contents: contents,
+			comments: existingRRset.Comments,
+			disabled: rrsetDisabled(existingRRset),
+			inputs:   idxs,
+			applied:  applied,
+		})
+	}
+	return changes
+}
+
+// applyChanges sends all planned changes to the server in a single PATCH,
+// which PowerDNS applies atomically: either every rrset is changed or none
+// is.  The outcome is recorded for every input record.  A failed PATCH is
+// returned as an error with failFast, otherwise it is only reported in the
+// results.
+func applyChanges(ctx context.Context, c *client, zone string, records []libdns.Record, changes []rrsetChange, failFast bool) ([]RecordResult, error) {
+	results := make([]RecordResult, len(records))
 	for i, r := range records {
-		svcb, ok := r.(libdns.ServiceBinding)
-		if ok {
-			out[i] = svcbToRr(svcb)
+		results[i].Record = r
+	}
+	if len(changes) == 0 {
+		return results, nil
+	}
+
+	err := wrapAPIError(c.Records.Patch(ctx, zone, changesToRRsets(changes)), zone)
+	for _, ch := range changes {
+		for i, idx := range ch.inputs {
+			if err != nil {
+				results[idx].Err = err
+			} else {
+				results[idx].Applied = ch.applied[i]
+			}
+		}
+	}
+	if err != nil && failFast {
+		return results, err
+	}
+	return results, nil
+}
+
+// effectiveChanges drops the changes that would leave their rrset as it
+// is, with the same TTL and the same values, enabled or disabled as they
+// were.  PowerDNS bumps the serial and notifies the secondaries for every
+// rrset in a PATCH, even one that doesn't change, and idempotent callers
+// write the same records over and over.
+func effectiveChanges(zone *powerdns.Zone, changes []rrsetChange) []rrsetChange {
+	out := make([]rrsetChange, 0, len(changes))
+	for _, ch := range changes {
+		if changesRRset(findRRset(zone, ch.name, ch.rrType), ch) {
+			out = append(out, ch)
+		}
+	}
+	return out
+}
+
+// changesRRset reports whether writing ch changes the existing rrset.  The
+// order of the values doesn't matter.
+func changesRRset(existing *powerdns.RRset, ch rrsetChange) bool {
+	if existing == nil {
+		return len(ch.contents) > 0
+	}
+	if len(ch.contents) == 0 || powerdns.Uint32Value(existing.TTL) != ch.ttl || len(existing.Records) != len(ch.contents) {
+		return true
+	}
+	disabled := make(map[string]bool, len(ch.contents))
+	for _, c := range ch.contents {
+		normalized := strings.TrimSuffix(c, ".")
+		disabled[normalized] = ch.disabled[normalized]
+	}
+	for _, r := range existing.Records {
+		normalized := strings.TrimSuffix(powerdns.StringValue(r.Content), ".")
+		d, ok := disabled[normalized]
+		if !ok || d != powerdns.BoolValue(r.Disabled) {
+			return true
+		}
+		delete(disabled, normalized)
+	}
+	return false
+}
+
+// changesToRRsets builds the PATCH payload for the planned changes
+func changesToRRsets(changes []rrsetChange) *powerdns.RRsets {
+	sets := make([]powerdns.RRset, 0, len(changes))
+	for _, ch := range changes {
+		rrset := powerdns.RRset{
+			Name: powerdns.String(ch.name),
+			Type: powerdns.RRTypePtr(powerdns.RRType(ch.rrType)),
+		}
+		if len(ch.contents) == 0 {
+			rrset.ChangeType = powerdns.ChangeTypePtr(powerdns.ChangeTypeDelete)
 		} else {
+			rrset.ChangeType = powerdns.ChangeTypePtr(powerdns.ChangeTypeReplace)
+			rrset.TTL = powerdns.Uint32(ch.ttl)
+			rrset.Comments = ch.comments
+			rrset.Records = make([]powerdns.Record, 0, len(ch.contents))
+			for _, content := range ch.contents {
+				rrset.Records = append(rrset.Records, powerdns.Record{
+					Content:  powerdns.String(content),
+					Disabled: powerdns.Bool(ch.disabled[strings.TrimSuffix(content, ".")]),
+					SetPTR:   powerdns.Bool(false),
+				})
+			}
+		}
+		sets = append(sets, rrset)
+	}
+	return &powerdns.RRsets{Sets: sets}
+}
+
+func convertNamesToAbsolute(zone string, records []libdns.Record) ([]libdns.RR, error) {
+	out := make([]libdns.RR, len(records))
+	for i, r := range records {
+		switch r := r.(type) {
+		case libdns.ServiceBinding:
+			out[i] = svcbToRr(r)
+		case libdns.CAA:
+			out[i] = caaToRR(r)
+		case libdns.SRV:
+			if r.Name == "" {
+				// the apex, which must not turn into a trailing dot
+				r.Name = "@"
+			}
+			out[i] = r.RR()
+		default:
 			out[i] = r.RR()
 		}
 	}
 	for i := range out {
-		name := libdns.AbsoluteName(out[i].Name, zone)
-		if !strings.HasSuffix(name, ".") {
-			name = name + "."
+		name, err := absoluteName(out[i].Name, zone)
+		if err != nil {
+			return nil, recordError(i, out[i], err)
 		}
 		out[i].Name = name
-		if out[i].Type == "TXT" {
-			out[i].Data = txtsanitize.TXTSanitize(out[i].Data)
+		switch out[i].Type {
+		case "TXT":
+			out[i].Data = txtsanitize.TXTSplit(txtsanitize.TXTSanitize(out[i].Data))
+		case "ALIAS", "PTR":
+			// PowerDNS only accepts fully qualified targets here
+			if !strings.HasSuffix(out[i].Data, ".") {
+				out[i].Data += "."
+			}
+		case "A", "AAAA":
+			out[i].Data = canonicalIP(out[i].Data)
+		case "MX":
+			out[i].Data = qualifyTarget(out[i].Data, zone, 1)
+		case "SRV":
+			out[i].Data = qualifyTarget(out[i].Data, zone, 3)
+		case "NAPTR":
+			out[i].Data = qualifyNAPTR(out[i].Data, zone)
+		case "TLSA", "SSHFP":
+			// lowercase the hex, as the server stores it, so that
+			// values compare equal with what is read back
+			if rec, err := parseRecord(out[i]); err == nil {
+				out[i].Data = rec.RR().Data
+			}
 		}
 	}
-	return out
+	return out, nil
+}
+
+// wholeRRsets clears the data of the converted records that ask for their
+// whole rrset to be deleted: plain libdns.RR values with a name and type
+// but empty data.  Conversion may have filled in data for them, such as
+// the quotes of an empty TXT string.  Typed records always carry content,
+// so an empty libdns.TXT still deletes only the empty string.
+func wholeRRsets(records []libdns.Record, abs []libdns.RR) {
+	for i, r := range records {
+		if rr, ok := r.(libdns.RR); ok && rr.Data == "" {
+			abs[i].Data = ""
+		}
+	}
+}
+
+// canonicalIP returns the address in data in its canonical form, which for
+// IPv6 is the compressed one of RFC 5952, so that different spellings of
+// an address are seen as the same value.  Zones of scoped addresses are
+// dropped, as they mean nothing in DNS.  Data that isn't an address is
+// left for the server to reject.
+func canonicalIP(data string) string {
+	ip, err := netip.ParseAddr(data)
+	if err != nil {
+		return data
+	}
+	return ip.WithZone("").String()
+}
+
+// qualifyTarget makes the domain name at the end of MX or SRV data fully
+// qualified, after the numeric fields that come first (one for MX, three
+// for SRV).  Relative targets are taken to be in the zone, as in a zone
+// file.  The root target "." is left alone, as is data that doesn't have
+// the expected shape, for the server to reject.
+func qualifyTarget(data, zone string, numeric int) string {
+	fields := strings.Fields(data)
+	if len(fields) != numeric+1 {
+		return data
+	}
+	for _, f := range fields[:numeric] {
+		if _, err := strconv.ParseUint(f, 10, 16); err != nil {
+			return data
+		}
+	}
+	target := fields[numeric]
+	if target != "." {
+		target = libdns.AbsoluteName(target, zone)
+		if !strings.HasSuffix(target, ".") {
+			target += "."
+		}
+	}
+	fields[numeric] = target
+	return strings.Join(fields, " ")
 }
 
-// This function is taken from libdns itself.
+// absoluteName turns a libdns (relative) name into the canonical form
+// PowerDNS stores: fully qualified, lowercase, with empty labels from
+// doubled dots dropped and exactly one trailing dot.  Names PowerDNS would
+// reject for their length, or for spaces and control characters, are an
+// error.
+func absoluteName(name, zone string) (string, error) {
+	abs := strings.ToLower(libdns.AbsoluteName(name, zone))
+	labels := strings.FieldsFunc(abs, func(r rune) bool { return r == '.' })
+	if len(labels) == 0 {
+		return "", fmt.Errorf("invalid name %q", name)
+	}
+	for _, label := range labels {
+		if len(label) > 63 {
+			return "", fmt.Errorf("label %q in name %q is longer than 63 characters", label, name)
+		}
+		for _, ch := range label {
+			if ch <= ' ' || ch == 0x7f {
+				return "", fmt.Errorf("invalid character %q in name %q", ch, name)
+			}
+		}
+	}
+	abs = strings.Join(labels, ".") + "."
+	if len(abs) > 254 {
+		return "", fmt.Errorf("name %q is longer than 253 characters", name)
+	}
+	return abs, nil
+}
+
+// This function is taken from libdns itself, and modified to use the
+// RFC 9460 "_port._https" prefix for HTTPS records on non-default ports.
 func svcbToRr(s libdns.ServiceBinding) libdns.RR {
 	var name string
 	var recType string
+	if s.Name == "" {
+		// the apex, which must not turn into a trailing dot below
+		s.Name = "@"
+	}
 	if s.Scheme == "https" || s.Scheme == "http" || s.Scheme == "wss" || s.Scheme == "ws" {
 		recType = "HTTPS"
 		name = s.Name
@@ -170,6 +786,9 @@ func svcbToRr(s libdns.ServiceBinding) libdns.RR {
 			// Ok, we'll correct your mistake for you.
 			s.URLSchemePort = 0
 		}
+		if s.URLSchemePort != 0 {
+			name = fmt.Sprintf("_https.%s", name)
+		}
 	} else {
 		recType = "SVCB"
 		name = fmt.Sprintf("_%s.%s", s.Scheme, s.Name)
@@ -188,18 +807,63 @@ func svcbToRr(s libdns.ServiceBinding) libdns.RR {
 		params = paramsToString(s.Params)
 	}
 
+	name = strings.TrimSuffix(name, ".@")
+
 	return libdns.RR{
 		Name: name,
 		TTL:  s.TTL,
 		Type: recType,
-		Data: fmt.Sprintf("%d %s %s", s.Priority, s.Target, params),
+		Data: strings.TrimSpace(fmt.Sprintf("%d %s %s", s.Priority, s.Target, params)),
+	}
+}
+
+// legacyHTTPSPort matches the "_port.name" prefix older versions of this
+// package wrote for HTTPS records on non-default ports.
+var legacyHTTPSPort = regexp.MustCompile(`^_[0-9]+\.[^_]`)
+
+// parseServiceBinding turns an HTTPS or SVCB RR into a libdns.ServiceBinding.
+// The "_port._scheme" name prefix and the "priority target params" data are
+// decoded by libdns, whose SvcParams parser also undoes the quoting done by
+// paramsToString.
+func parseServiceBinding(rr libdns.RR) (libdns.Record, error) {
+	if rr.Type == "HTTPS" && legacyHTTPSPort.MatchString(rr.Name) {
+		port, rest, _ := strings.Cut(rr.Name, ".")
+		rr.Name = port + "._https." + rest
+	}
+	return rr.Parse()
+}
+
+// parseRecord turns an RR read from the server into the matching libdns
+// record type.  Types libdns has no struct for, such as the PowerDNS
+// specific ALIAS, are returned as a plain libdns.RR, apart from TLSA, SSHFP
+// and NAPTR, which have structs in this package.
+func parseRecord(rr libdns.RR) (libdns.Record, error) {
+	switch rr.Type {
+	case "HTTPS", "SVCB":
+		return parseServiceBinding(rr)
+	case "CAA":
+		return parseCAA(rr)
+	case "TLSA":
+		return parseTLSA(rr)
+	case "SSHFP":
+		return parseSSHFP(rr)
+	case "NAPTR":
+		return parseNAPTR(rr)
+	case "TXT":
+		// undo the quoting of convertNamesToAbsolute, so the text reads
+		// back as it was written
+		return libdns.TXT{Name: rr.Name, TTL: rr.TTL, Text: txtsanitize.TXTUnsanitize(rr.Data)}, nil
+	default:
+		return rr.Parse()
 	}
 }
 
-// This function is taken from libdns itself and modified to quote ECH params.
+// This function is taken from libdns itself and modified to quote ECH params
+// and to write the keys in a stable order.
 func paramsToString(params libdns.SvcParams) string {
 	var sb strings.Builder
-	for key, vals := range params {
+	for _, key := range sortedSvcParamKeys(params) {
+		vals := params[key]
 		if sb.Len() > 0 {
 			sb.WriteRune(' ')
 		}
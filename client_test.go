@@ -9,6 +9,7 @@ import (
 	"reflect"
 	"sort"
 	"strconv"
+	"strings"
 	"testing"
 	"time"
 
@@ -52,7 +53,7 @@ func TestPDNSClient(t *testing.T) {
 		APIToken:  "secret",
 		Debug:     os.Getenv("PDNS_DEBUG"),
 	}
-	c, err := p.client()
+	c, err := p.client(context.Background())
 	if err != nil {
 		t.Fatalf("could not create client: %s", err)
 	}
@@ -125,8 +126,8 @@ func TestPDNSClient(t *testing.T) {
 				},
 			},
 			want: []string{
-				`1:"This is text"`,
-				`1:"This is also some text"`,
+				`1:This is text`,
+				`1:This is also some text`,
 			},
 		},
 		{
@@ -141,9 +142,9 @@ func TestPDNSClient(t *testing.T) {
 				},
 			},
 			want: []string{
-				`1:"This is text"`,
-				`1:"This is also some text"`,
-				`1:"This is some weird text that isn't quoted"`,
+				`1:This is text`,
+				`1:This is also some text`,
+				`1:This is some weird text that isn't quoted`,
 			},
 		},
 		{
@@ -157,9 +158,9 @@ func TestPDNSClient(t *testing.T) {
 					Text: `This is some weird text that "has embedded quoting"`,
 				},
 			},
-			want: []string{`1:"This is text"`, `1:"This is also some text"`,
-				`1:"This is some weird text that isn't quoted"`,
-				`1:"This is some weird text that \"has embedded quoting\""`},
+			want: []string{`1:This is text`, `1:This is also some text`,
+				`1:This is some weird text that isn't quoted`,
+				`1:This is some weird text that "has embedded quoting"`},
 		},
 		{
 			name:      "Test Append Zone TXT record with unicode",
@@ -172,12 +173,30 @@ func TestPDNSClient(t *testing.T) {
 					Text: `ç is equal to \195\167`,
 				},
 			},
-			want: []string{`1:"This is text"`, `1:"This is also some text"`,
-				`1:"This is some weird text that isn't quoted"`,
-				`1:"This is some weird text that \"has embedded quoting\""`,
-				`1:"ç is equal to \195\167"`,
+			want: []string{`1:This is text`, `1:This is also some text`,
+				`1:This is some weird text that isn't quoted`,
+				`1:This is some weird text that "has embedded quoting"`,
+				`1:ç is equal to \195\167`,
 			},
 		},
+		{
+			name:      "Test Append Zone AAAA record",
+			operation: "append",
+			zone:      "example.org.",
+			Type:      "AAAA",
+			records: []libdns.Record{
+				libdns.Address{
+					Name: "1",
+					IP:   netip.MustParseAddr("2001:db8:0:0:0:0:0:1"),
+				},
+				libdns.RR{
+					Name: "1",
+					Type: "AAAA",
+					Data: "2001:0db8::0001",
+				},
+			},
+			want: []string{"1:2001:db8::1"},
+		},
 		{
 			name:      "Test Delete Zone",
 			operation: "delete",
@@ -269,6 +288,182 @@ func TestPDNSClient(t *testing.T) {
 		})
 	}
 
+	t.Run("export zone", func(t *testing.T) {
+		out, err := p.ExportZone(ctx, zoneName)
+		if err != nil {
+			t.Fatalf("failed to export zone: %s", err)
+		}
+		var soa, ns bool
+		for _, line := range strings.Split(string(out), "\n") {
+			fields := strings.Fields(line)
+			if len(fields) < 4 || fields[0] != zoneName {
+				continue
+			}
+			switch fields[3] {
+			case "SOA":
+				soa = true
+			case "NS":
+				ns = true
+			}
+		}
+		if !soa || !ns {
+			t.Errorf("export lacks the apex SOA or NS records:\n%s", out)
+		}
+	})
+
+	t.Run("zone serial", func(t *testing.T) {
+		// the zone was created without SOA-EDIT-API, give it one so edits
+		// through the API increase the serial
+		soaEdit := "INCREASE"
+		if err := c.Zones.Change(ctx, zoneName, &powerdns.Zone{SOAEditAPI: &soaEdit}); err != nil {
+			t.Fatalf("failed to set SOA-EDIT-API: %s", err)
+		}
+		before, err := p.GetZoneSerial(ctx, zoneName)
+		if err != nil {
+			t.Fatalf("failed to get serial: %s", err)
+		}
+		if _, err := p.AppendRecords(ctx, zoneName, []libdns.Record{
+			libdns.TXT{Name: "serial", Text: "bump"},
+		}); err != nil {
+			t.Fatalf("failed to append record: %s", err)
+		}
+		after, err := p.GetZoneSerial(ctx, zoneName)
+		if err != nil {
+			t.Fatalf("failed to get serial: %s", err)
+		}
+		if after == before {
+			t.Errorf("serial did not change after an append: %d", after)
+		}
+		if err := p.BumpSerial(ctx, zoneName); err != nil {
+			t.Fatalf("failed to bump serial: %s", err)
+		}
+		if bumped, err := p.GetZoneSerial(ctx, zoneName); err != nil || bumped == after {
+			t.Errorf("serial did not change after BumpSerial: %d, %v", bumped, err)
+		}
+	})
+
+	t.Run("auto create zone", func(t *testing.T) {
+		auto := &Provider{
+			ServerURL:          p.ServerURL,
+			ServerID:           p.ServerID,
+			APIToken:           p.APIToken,
+			AutoCreateZone:     true,
+			DefaultNameservers: nameservers,
+		}
+		if _, err := auto.AppendRecords(ctx, "auto.example.", []libdns.Record{
+			libdns.TXT{Name: "www", Text: "created on the fly"},
+		}); err != nil {
+			t.Fatalf("failed to append to a missing zone: %s", err)
+		}
+		defer func() { _ = auto.DeleteZone(ctx, "auto.example.") }()
+		recs, err := auto.GetRecordsFiltered(ctx, "auto.example.", FilterOptions{Name: "www", Type: "TXT"})
+		if err != nil {
+			t.Fatalf("failed to read back the record: %s", err)
+		}
+		if len(recs) != 1 || recs[0].(libdns.TXT).Text != "created on the fly" {
+			t.Errorf("unexpected records in the new zone: %#v", recs)
+		}
+	})
+
+	t.Run("dnssec keys", func(t *testing.T) {
+		if _, err := p.EnableDNSSEC(ctx, zoneName); err != nil {
+			t.Fatalf("failed to enable DNSSEC: %s", err)
+		}
+		keys, err := p.GetDNSKEYs(ctx, zoneName)
+		if err != nil {
+			t.Fatalf("failed to get DNSSEC keys: %s", err)
+		}
+		var ksk bool
+		for _, k := range keys {
+			if k.Flags == 257 && k.Active && len(k.DS) > 0 {
+				ksk = true
+			}
+		}
+		if !ksk {
+			t.Errorf("no active key signing key with DS records in %#v", keys)
+		}
+	})
+
+}
+
+func TestRemoveContents(t *testing.T) {
+	for _, tst := range []struct {
+		name     string
+		existing []string
+		remove   []string
+		want     []string
+	}{
+		{
+			name:     "adjacent duplicates",
+			existing: []string{`"dup"`, `"dup"`, `"keep"`},
+			remove:   []string{`"dup"`},
+			want:     []string{`"keep"`},
+		},
+		{
+			name:     "duplicates spread out",
+			existing: []string{`"dup"`, `"keep"`, `"dup"`, `"dup"`},
+			remove:   []string{`"dup"`},
+			want:     []string{`"keep"`},
+		},
+		{
+			name:     "trailing dot ignored",
+			existing: []string{"a.example.org.", "a.example.org.", "b.example.org."},
+			remove:   []string{"a.example.org"},
+			want:     []string{"b.example.org."},
+		},
+		{
+			name:     "everything",
+			existing: []string{"x", "x"},
+			remove:   []string{"x"},
+			want:     []string{},
+		},
+	} {
+		t.Run(tst.name, func(t *testing.T) {
+			existing := append([]string(nil), tst.existing...)
+			have := removeContents(existing, tst.remove)
+			if !reflect.DeepEqual(have, tst.want) {
+				t.Errorf("have %#v want %#v", have, tst.want)
+			}
+			if !reflect.DeepEqual(existing, tst.existing) {
+				t.Errorf("input was modified: %#v", existing)
+			}
+		})
+	}
+}
+
+func TestAbsoluteName(t *testing.T) {
+	long := strings.Repeat("a", 64)
+	for _, tst := range []struct {
+		name, zone string
+		want       string
+		wantErr    bool
+	}{
+		{name: "www", zone: "example.org.", want: "www.example.org."},
+		{name: "WWW.Sub", zone: "example.org.", want: "www.sub.example.org."},
+		{name: "www", zone: "example.org", want: "www.example.org."},
+		{name: "www.example.org.", zone: "example.org.", want: "www.example.org."},
+		{name: "WWW.Example.ORG.", zone: "example.org.", want: "www.example.org."},
+		{name: "", zone: "example.org.", want: "example.org."},
+		{name: "@", zone: "example.org.", want: "example.org."},
+		{name: "a..b", zone: "example.org.", want: "a.b.example.org."},
+		{name: "www.", zone: "example.org.", want: "www."},
+		{name: "*.dev", zone: "example.org.", want: "*.dev.example.org."},
+		{name: "_acme-challenge", zone: "example.org.", want: "_acme-challenge.example.org."},
+		{name: long, zone: "example.org.", wantErr: true},
+		{name: "has space", zone: "example.org.", wantErr: true},
+		{name: strings.Repeat("abcdefghi.", 26), zone: "example.org.", wantErr: true},
+	} {
+		have, err := absoluteName(tst.name, tst.zone)
+		if tst.wantErr {
+			if err == nil {
+				t.Errorf("absoluteName(%q, %q) = %q, expected an error", tst.name, tst.zone, have)
+			}
+			continue
+		}
+		if err != nil || have != tst.want {
+			t.Errorf("absoluteName(%q, %q) = %q, %v, want %q", tst.name, tst.zone, have, err, tst.want)
+		}
+	}
 }
 
 func which(cmd string) (string, bool) {
@@ -0,0 +1,80 @@
+package powerdns
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/joeig/go-powerdns/v3"
+)
+
+// RecordComment is a comment attached to an rrset.
+type RecordComment struct {
+	Content string
+	Account string
+
+	// ModifiedAt is when the comment was last changed, or the zero time if
+	// the server did not report it.
+	ModifiedAt time.Time
+}
+
+// SetRecordComment replaces the comments of the rrset identified by name
+// and rrType with a single comment.  An empty comment removes all
+// comments.  The records and TTL of the rrset are left as they are.  In a
+// dry run nothing is sent.  Comments are not DNS data, so the zone is not
+// rectified afterwards.
+func (p *Provider) SetRecordComment(ctx context.Context, zone, name, rrType, comment, account string) error {
+	zone = p.normalizeZone(zone)
+	rrType = strings.ToUpper(rrType)
+	absName, err := absoluteName(name, zone)
+	if err != nil {
+		return err
+	}
+	c, err := p.client(ctx)
+	if err != nil {
+		return err
+	}
+	fullZone, err := c.getZone(ctx, zone)
+	if err != nil {
+		return p.zoneError(zone, err)
+	}
+	existing := findRRset(fullZone, absName, rrType)
+	if existing == nil {
+		return fmt.Errorf("%w: no %s rrset at %s in zone %s", ErrRecordNotFound, rrType, absName, zone)
+	}
+	if p.DryRun {
+		return nil
+	}
+
+	rrset := *existing
+	rrset.ChangeType = powerdns.ChangeTypePtr(powerdns.ChangeTypeReplace)
+	rrset.Comments = []powerdns.Comment{}
+	if comment != "" {
+		rrset.Comments = append(rrset.Comments, powerdns.Comment{
+			Content:    powerdns.String(comment),
+			Account:    powerdns.String(account),
+			ModifiedAt: powerdns.Uint64(uint64(time.Now().Unix())),
+		})
+	}
+	return wrapAPIError(c.Records.Patch(ctx, zone, &powerdns.RRsets{Sets: []powerdns.RRset{rrset}}), zone)
+}
+
+// convertComments turns PowerDNS comments into RecordComments
+func convertComments(comments []powerdns.Comment) []RecordComment {
+	if len(comments) == 0 {
+		return nil
+	}
+	out := make([]RecordComment, 0, len(comments))
+	for _, cm := range comments {
+		rc := RecordComment{
+			Content: powerdns.StringValue(cm.Content),
+			Account: powerdns.StringValue(cm.Account),
+		}
+		if ts := powerdns.Uint64Value(cm.ModifiedAt); ts != 0 {
+			rc.ModifiedAt = time.Unix(int64(ts), 0)
+		}
+		out = append(out, rc)
+	}
+	return out
+}
@@ -0,0 +1,78 @@
+package powerdns
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/joeig/go-powerdns/v3"
+)
+
+func TestRecordComments(t *testing.T) {
+	ctx := context.Background()
+	f := newFakePDNS(t)
+	mx := rrset("example.org.", "MX", 60, "10 mail.example.org.")
+	mx.Comments = []powerdns.Comment{
+		{Content: powerdns.String("primary"), Account: powerdns.String("alice"), ModifiedAt: powerdns.Uint64(1700000000)},
+		{Content: powerdns.String("see TICKET-7")},
+	}
+	www := rrset("www.example.org.", "A", 60, "127.0.0.1", "127.0.0.2")
+	www.Records[1].Disabled = powerdns.Bool(true)
+	f.AddZone("example.org.", mx, www)
+	p := f.provider()
+
+	if err := p.SetRecordComment(ctx, "example.org.", "www", "A", "TICKET-42", "ops"); err != nil {
+		t.Fatalf("SetRecordComment: %s", err)
+	}
+	stored := f.RRset("example.org.", "www.example.org.", "A")
+	if got := rrsetContents(stored); !reflect.DeepEqual(got, []string{"127.0.0.1", "127.0.0.2"}) || !powerdns.BoolValue(stored.Records[1].Disabled) {
+		t.Errorf("records changed by SetRecordComment: %#v", stored.Records)
+	}
+
+	recs, err := p.GetRecordsWithMeta(ctx, "example.org.")
+	if err != nil {
+		t.Fatalf("GetRecordsWithMeta: %s", err)
+	}
+	if len(recs) != 3 || !recs[2].Disabled {
+		t.Fatalf("expected 3 records, the last disabled, got %#v", recs)
+	}
+	want := []RecordComment{
+		{Content: "primary", Account: "alice", ModifiedAt: time.Unix(1700000000, 0)},
+		{Content: "see TICKET-7"},
+	}
+	if !reflect.DeepEqual(recs[0].Comments, want) {
+		t.Errorf("MX comments: have %#v want %#v", recs[0].Comments, want)
+	}
+	if c := recs[1].Comments; len(c) != 1 || c[0].Content != "TICKET-42" || c[0].Account != "ops" || c[0].ModifiedAt.IsZero() {
+		t.Errorf("www comments: %#v", c)
+	}
+	if !reflect.DeepEqual(recs[2].Comments, recs[1].Comments) {
+		t.Errorf("the disabled record lacks the comments of its rrset: %#v", recs[2].Comments)
+	}
+
+	if err := p.SetRecordComment(ctx, "example.org.", "www", "a", "", ""); err != nil {
+		t.Fatalf("clearing comment: %s", err)
+	}
+	if c := f.RRset("example.org.", "www.example.org.", "A").Comments; len(c) != 0 {
+		t.Errorf("comments not cleared: %#v", c)
+	}
+
+	err = p.SetRecordComment(ctx, "example.org.", "missing", "A", "x", "")
+	if !errors.Is(err, ErrRecordNotFound) || !strings.Contains(err.Error(), "missing.example.org.") {
+		t.Errorf("expected ErrRecordNotFound naming missing.example.org., got %v", err)
+	}
+
+	// a zone that is gone is dropped from the zone cache
+	p.ZoneCacheTTL = time.Minute
+	p.rememberZone("example.org.", zoneSettings{kind: "Native"})
+	delete(f.Zones, "example.org.")
+	if err := p.SetRecordComment(ctx, "example.org.", "www", "A", "x", ""); !errors.Is(err, ErrZoneNotFound) {
+		t.Errorf("expected ErrZoneNotFound, got %v", err)
+	}
+	if _, ok := p.cachedZone("example.org."); ok {
+		t.Error("deleted zone is still cached")
+	}
+}
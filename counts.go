@@ -0,0 +1,78 @@
+package powerdns
+
+import (
+	"context"
+	"time"
+
+	"github.com/libdns/libdns"
+)
+
+// ChangeCounts are how many record values a write created, updated and
+// deleted, e.g. for logging "added 3, removed 1".  A value whose rrset only
+// got a new TTL counts as updated; values that were already as requested
+// aren't counted at all.
+type ChangeCounts struct {
+	Created int
+	Updated int
+	Deleted int
+}
+
+// WriteResult is what AppendRecordsResult, SetRecordsResult and
+// DeleteRecordsResult return: the records the plain method returns, and
+// what the write changed.  In a dry run the counts are what it would
+// change.
+type WriteResult struct {
+	Records []libdns.Record
+	ChangeCounts
+}
+
+// AppendRecordsResult behaves like AppendRecords, but also counts the
+// values it added.
+func (p *Provider) AppendRecordsResult(ctx context.Context, zone string, records []libdns.Record) (_ WriteResult, err error) {
+	defer func(start time.Time) { p.observe("append", start, err) }(time.Now())
+	var res WriteResult
+	_, res.Records, err = p.appendRecords(ctx, zone, records, true, true, &res.ChangeCounts)
+	if err != nil {
+		return WriteResult{}, err
+	}
+	return res, nil
+}
+
+// SetRecordsResult behaves like SetRecords, but also counts the values it
+// created, updated and deleted.
+func (p *Provider) SetRecordsResult(ctx context.Context, zone string, records []libdns.Record) (_ WriteResult, err error) {
+	defer func(start time.Time) { p.observe("set", start, err) }(time.Now())
+	var res WriteResult
+	_, res.Records, err = p.setRecords(ctx, zone, records, true, true, &res.ChangeCounts)
+	if err != nil {
+		return WriteResult{}, err
+	}
+	return res, nil
+}
+
+// DeleteRecordsResult behaves like DeleteRecords, but also counts the
+// values it deleted.
+func (p *Provider) DeleteRecordsResult(ctx context.Context, zone string, records []libdns.Record) (_ WriteResult, err error) {
+	defer func(start time.Time) { p.observe("delete", start, err) }(time.Now())
+	var res WriteResult
+	_, err = p.deleteRecords(ctx, zone, records, true, &res.ChangeCounts)
+	if err != nil {
+		return WriteResult{}, err
+	}
+	res.Records = records
+	return res, nil
+}
+
+// add counts the changes of the plan; c may be nil
+func (c *ChangeCounts) add(zone string, pl writePlan) {
+	if c == nil {
+		return
+	}
+	for _, rs := range zoneDiff(zone, pl.before, pl.changes).RRsets {
+		c.Created += len(rs.Added)
+		c.Deleted += len(rs.Removed)
+		if rs.Action == ActionReplace && rs.TTLBefore != rs.TTLAfter {
+			c.Updated += len(rs.After) - len(rs.Added)
+		}
+	}
+}
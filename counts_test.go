@@ -0,0 +1,73 @@
+package powerdns
+
+import (
+	"context"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/libdns/libdns"
+)
+
+func TestChangeCounts(t *testing.T) {
+	ctx := context.Background()
+	f := newFakePDNS(t)
+	f.AddZone("example.org.",
+		rrset("www.example.org.", "A", 60, "127.0.0.1", "127.0.0.2"),
+		rrset("mail.example.org.", "A", 60, "127.0.0.3"),
+		rrset("example.org.", "TXT", 60, `"a"`, `"b"`),
+	)
+	p := f.provider()
+	addr := func(name, ip string, ttl time.Duration) libdns.Record {
+		return libdns.Address{Name: name, IP: netip.MustParseAddr(ip), TTL: ttl}
+	}
+
+	res, err := p.AppendRecordsResult(ctx, "example.org.", []libdns.Record{
+		addr("www", "127.0.0.1", time.Minute),
+		addr("www", "127.0.0.4", time.Minute),
+		addr("new", "127.0.0.5", time.Minute),
+	})
+	if err != nil {
+		t.Fatalf("AppendRecordsResult: %s", err)
+	}
+	if want := (ChangeCounts{Created: 2}); res.ChangeCounts != want || len(res.Records) != 2 {
+		t.Errorf("append: %+v, %d records; want %+v and 2 records", res.ChangeCounts, len(res.Records), want)
+	}
+
+	// www loses two of its three values, mail only gets a new TTL and the
+	// TXT rrset gets one value more
+	res, err = p.SetRecordsResult(ctx, "example.org.", []libdns.Record{
+		addr("www", "127.0.0.4", time.Minute),
+		addr("mail", "127.0.0.3", time.Hour),
+		libdns.TXT{Name: "@", TTL: time.Minute, Text: "a"},
+		libdns.TXT{Name: "@", TTL: time.Minute, Text: "b"},
+		libdns.TXT{Name: "@", TTL: time.Minute, Text: "c"},
+	})
+	if err != nil {
+		t.Fatalf("SetRecordsResult: %s", err)
+	}
+	if want := (ChangeCounts{Created: 1, Updated: 1, Deleted: 2}); res.ChangeCounts != want || len(res.Records) != 5 {
+		t.Errorf("set: %+v, %d records; want %+v and 5 records", res.ChangeCounts, len(res.Records), want)
+	}
+
+	res, err = p.DeleteRecordsResult(ctx, "example.org.", []libdns.Record{
+		libdns.RR{Name: "@", Type: "TXT"},
+		addr("new", "127.0.0.5", 0),
+		addr("mail", "127.0.0.9", 0),
+	})
+	if err != nil {
+		t.Fatalf("DeleteRecordsResult: %s", err)
+	}
+	if want := (ChangeCounts{Deleted: 4}); res.ChangeCounts != want {
+		t.Errorf("delete: %+v, want %+v", res.ChangeCounts, want)
+	}
+
+	p.DryRun = true
+	res, err = p.AppendRecordsResult(ctx, "example.org.", []libdns.Record{addr("www", "127.0.0.6", time.Minute)})
+	if err != nil || res.ChangeCounts != (ChangeCounts{Created: 1}) {
+		t.Errorf("dry run append: %+v, %v", res.ChangeCounts, err)
+	}
+	if n := f.CallCount("PATCH", "/zones/example.org."); n != 3 {
+		t.Errorf("expected 3 PATCHes, the dry run must not send one; got %d", n)
+	}
+}
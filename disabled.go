@@ -0,0 +1,53 @@
+package powerdns
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/joeig/go-powerdns/v3"
+)
+
+// SetRecordDisabled disables or enables all records of the rrset
+// identified by name and rrType.  Disabled records stay in the zone but are
+// not served, which suits staging a change or taking a name down for a
+// while.  The values, TTL and comments of the rrset are left as they are.
+//
+// Later changes through the provider keep values disabled, except
+// SetRecords, which writes exactly the given values and enables them.
+// The change honours DryRun and AutoRectify like the other writes, and an
+// rrset that is already disabled or enabled as asked is not written.
+func (p *Provider) SetRecordDisabled(ctx context.Context, zone, name, rrType string, disabled bool) error {
+	zone = p.normalizeZone(zone)
+	rrType = strings.ToUpper(rrType)
+	absName, err := absoluteName(name, zone)
+	if err != nil {
+		return err
+	}
+	c, err := p.client(ctx)
+	if err != nil {
+		return err
+	}
+	fullZone, err := c.getZone(ctx, zone)
+	if err != nil {
+		return p.zoneError(zone, err)
+	}
+	existing := findRRset(fullZone, absName, rrType)
+	if existing == nil {
+		return fmt.Errorf("%w: no %s rrset at %s in zone %s", ErrRecordNotFound, rrType, name, zone)
+	}
+
+	ch := rrsetChange{
+		name:     powerdns.StringValue(existing.Name),
+		rrType:   rrType,
+		ttl:      powerdns.Uint32Value(existing.TTL),
+		contents: rrsetContents(existing),
+		comments: existing.Comments,
+		disabled: make(map[string]bool, len(existing.Records)),
+	}
+	for _, content := range ch.contents {
+		ch.disabled[strings.TrimSuffix(content, ".")] = disabled
+	}
+	_, err = p.apply(ctx, c, zone, fullZone, nil, []rrsetChange{ch}, true)
+	return err
+}
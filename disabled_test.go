@@ -0,0 +1,84 @@
+package powerdns
+
+import (
+	"context"
+	"errors"
+	"net/netip"
+	"testing"
+
+	"github.com/joeig/go-powerdns/v3"
+	"github.com/libdns/libdns"
+)
+
+func TestSetRecordDisabled(t *testing.T) {
+	ctx := context.Background()
+	f := newFakePDNS(t)
+	www := rrset("www.example.org.", "A", 60, "192.0.2.1", "192.0.2.2")
+	www.Comments = []powerdns.Comment{{Content: powerdns.String("keep me")}}
+	f.AddZone("example.org.", www)
+	p := f.provider()
+
+	flags := func() []bool {
+		t.Helper()
+		z, err := p.GetRawZone(ctx, "example.org.")
+		if err != nil {
+			t.Fatalf("GetRawZone: %s", err)
+		}
+		rs := findRRset(z, "www.example.org.", "A")
+		if rs == nil {
+			t.Fatal("rrset is gone")
+		}
+		if len(rs.Comments) != 1 {
+			t.Errorf("comments were lost: %#v", rs.Comments)
+		}
+		out := make([]bool, 0, len(rs.Records))
+		for _, r := range rs.Records {
+			out = append(out, powerdns.BoolValue(r.Disabled))
+		}
+		return out
+	}
+	count := func() int {
+		t.Helper()
+		recs, err := p.GetRecords(ctx, "example.org.")
+		if err != nil {
+			t.Fatalf("GetRecords: %s", err)
+		}
+		return len(recs)
+	}
+
+	if err := p.SetRecordDisabled(ctx, "example.org.", "www", "A", true); err != nil {
+		t.Fatalf("SetRecordDisabled: %s", err)
+	}
+	if got := flags(); len(got) != 2 || !got[0] || !got[1] {
+		t.Errorf("expected both records disabled, got %v", got)
+	}
+	if n := count(); n != 0 {
+		t.Errorf("GetRecords returned %d disabled records", n)
+	}
+	p.IncludeDisabled = true
+	if n := count(); n != 2 {
+		t.Errorf("GetRecords with IncludeDisabled returned %d records, want 2", n)
+	}
+	p.IncludeDisabled = false
+
+	// appending leaves the disabled values disabled
+	if _, err := p.AppendRecords(ctx, "example.org.", []libdns.Record{
+		libdns.Address{Name: "www", IP: netip.MustParseAddr("192.0.2.3")},
+	}); err != nil {
+		t.Fatalf("AppendRecords: %s", err)
+	}
+	if got := flags(); len(got) != 3 || !got[0] || !got[1] || got[2] {
+		t.Errorf("unexpected flags after appending: %v", got)
+	}
+
+	if err := p.SetRecordDisabled(ctx, "example.org.", "www", "a", false); err != nil {
+		t.Fatalf("SetRecordDisabled: %s", err)
+	}
+	if got := flags(); len(got) != 3 || got[0] || got[1] || got[2] {
+		t.Errorf("expected all records enabled, got %v", got)
+	}
+
+	if err := p.SetRecordDisabled(ctx, "example.org.", "nope", "A", true); !errors.Is(err, ErrRecordNotFound) {
+		t.Errorf("expected ErrRecordNotFound, got %v", err)
+	}
+}
@@ -0,0 +1,137 @@
+package powerdns
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/joeig/go-powerdns/v3"
+)
+
+// EnableDNSSEC turns on signing for the zone and returns the DS records of
+// its active keys, for uploading to the parent zone.  PowerDNS creates a
+// default key pair when the zone is secured.  Enabling DNSSEC on a zone
+// that is already signed only returns the DS records.
+//
+// If the backend holding the zone can't do DNSSEC the error wraps
+// errors.ErrUnsupported.
+func (p *Provider) EnableDNSSEC(ctx context.Context, zone string) ([]string, error) {
+	zone = p.normalizeZone(zone)
+	c, err := p.client(ctx)
+	if err != nil {
+		return nil, err
+	}
+	fullZone, err := c.getZone(ctx, zone)
+	if err != nil {
+		return nil, err
+	}
+	if !powerdns.BoolValue(fullZone.DNSsec) {
+		if err := c.setDNSSEC(ctx, zone, true); err != nil {
+			return nil, err
+		}
+	}
+	keys, err := c.Cryptokeys.List(ctx, zone)
+	if err != nil {
+		return nil, wrapAPIError(err, zone)
+	}
+	var ds []string
+	for _, k := range keys {
+		if powerdns.BoolValue(k.Active) {
+			ds = append(ds, k.DS...)
+		}
+	}
+	return ds, nil
+}
+
+// DisableDNSSEC turns off signing for the zone.  PowerDNS removes all its
+// keys, so the DS records at the parent have to be removed first or the
+// zone will fail to validate.  Disabling an unsigned zone does nothing.
+func (p *Provider) DisableDNSSEC(ctx context.Context, zone string) error {
+	zone = p.normalizeZone(zone)
+	c, err := p.client(ctx)
+	if err != nil {
+		return err
+	}
+	fullZone, err := c.getZone(ctx, zone)
+	if err != nil {
+		return err
+	}
+	if !powerdns.BoolValue(fullZone.DNSsec) {
+		return nil
+	}
+	return c.setDNSSEC(ctx, zone, false)
+}
+
+// setDNSSEC changes the dnssec flag of the zone.  A backend without DNSSEC
+// support is refused with a 422, like invalid changes, so only a message
+// saying so is taken as unsupported.
+func (c *client) setDNSSEC(ctx context.Context, zone string, enabled bool) error {
+	err := c.Zones.Change(ctx, zone, &powerdns.Zone{DNSsec: powerdns.Bool(enabled)})
+	var apiErr *powerdns.Error
+	if errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusUnprocessableEntity && dnssecUnsupported(apiErr.Message) {
+		return fmt.Errorf("changing DNSSEC on %s: %s: %w", zone, apiErr.Message, errors.ErrUnsupported)
+	}
+	return wrapAPIError(err, zone)
+}
+
+// dnssecUnsupported reports whether an error message of the server says
+// that the backend can't do DNSSEC
+func dnssecUnsupported(message string) bool {
+	message = strings.ToLower(message)
+	return strings.Contains(message, "not support") || strings.Contains(message, "unsupported")
+}
+
+// DNSSECKey is a DNSSEC key of a zone as reported by PowerDNS.
+type DNSSECKey struct {
+	ID uint64
+
+	// KeyType is "ksk", "zsk" or "csk" (a combined signing key).
+	KeyType string
+
+	// Flags are the DNSKEY flags, 257 for key signing keys and 256 for
+	// zone signing keys.
+	Flags     uint16
+	Active    bool
+	Algorithm string
+
+	// DNSKEY is the content of the DNSKEY record, and DS the DS records
+	// PowerDNS computed for it, one per digest type.  Only key signing
+	// keys have DS records.
+	DNSKEY string
+	DS     []string
+}
+
+// GetDNSKEYs returns the DNSSEC keys of the zone, which is empty if the
+// zone is not signed.
+func (p *Provider) GetDNSKEYs(ctx context.Context, zone string) ([]DNSSECKey, error) {
+	zone = p.normalizeZone(zone)
+	c, err := p.readClient(ctx)
+	if err != nil {
+		return nil, err
+	}
+	keys, err := c.Cryptokeys.List(ctx, zone)
+	if err != nil {
+		return nil, c.checkSchema(ctx, wrapAPIError(err, zone))
+	}
+	out := make([]DNSSECKey, 0, len(keys))
+	for _, k := range keys {
+		key := DNSSECKey{
+			ID:        powerdns.Uint64Value(k.ID),
+			KeyType:   powerdns.StringValue(k.KeyType),
+			Active:    powerdns.BoolValue(k.Active),
+			Algorithm: powerdns.StringValue(k.Algorithm),
+			DNSKEY:    powerdns.StringValue(k.DNSkey),
+			DS:        k.DS,
+		}
+		if flags, _, ok := strings.Cut(key.DNSKEY, " "); ok {
+			if n, err := strconv.ParseUint(flags, 10, 16); err == nil {
+				key.Flags = uint16(n)
+			}
+		}
+		out = append(out, key)
+	}
+	return out, nil
+}
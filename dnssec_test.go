@@ -0,0 +1,95 @@
+package powerdns
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"reflect"
+	"testing"
+
+	"github.com/joeig/go-powerdns/v3"
+)
+
+func TestDNSSEC(t *testing.T) {
+	ctx := context.Background()
+	f := newFakePDNS(t)
+	f.AddZone("example.org.")
+	p := f.provider()
+
+	ds, err := p.EnableDNSSEC(ctx, "example.org.")
+	if err != nil {
+		t.Fatalf("EnableDNSSEC: %s", err)
+	}
+	want := []string{"4242 13 2 0123456789abcdef", "4242 13 4 fedcba9876543210"}
+	if !reflect.DeepEqual(ds, want) {
+		t.Errorf("DS records: have %v want %v", ds, want)
+	}
+	if !powerdns.BoolValue(f.Zone("example.org.").DNSsec) {
+		t.Errorf("zone not signed")
+	}
+
+	puts := f.CallCount("PUT", "/zones/example.org.")
+	ds, err = p.EnableDNSSEC(ctx, "example.org.")
+	if err != nil || !reflect.DeepEqual(ds, want) {
+		t.Errorf("enabling again: %v, %v", ds, err)
+	}
+	if f.CallCount("PUT", "/zones/example.org.") != puts {
+		t.Errorf("enabling a signed zone should not change it")
+	}
+
+	if err := p.DisableDNSSEC(ctx, "example.org."); err != nil {
+		t.Fatalf("DisableDNSSEC: %s", err)
+	}
+	if powerdns.BoolValue(f.Zone("example.org.").DNSsec) {
+		t.Errorf("zone still signed")
+	}
+	if err := p.DisableDNSSEC(ctx, "example.org."); err != nil {
+		t.Errorf("disabling an unsigned zone: %s", err)
+	}
+
+	f.NoDNSSEC = true
+	if _, err := p.EnableDNSSEC(ctx, "example.org."); !errors.Is(err, errors.ErrUnsupported) {
+		t.Errorf("expected ErrUnsupported, got %v", err)
+	}
+
+	// other refusals are validation errors, not missing support
+	f.Intercept = func(w http.ResponseWriter, r *http.Request) bool {
+		if r.Method == http.MethodPut {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusUnprocessableEntity)
+			_, _ = w.Write([]byte(`{"error": "Creating key failed: invalid key size 1000 for algorithm ECDSAP256SHA256"}`))
+			return true
+		}
+		return false
+	}
+	invalid := &Provider{ServerURL: f.URL, APIToken: "secret"}
+	_, err = invalid.EnableDNSSEC(ctx, "example.org.")
+	if !errors.Is(err, ErrValidation) || errors.Is(err, errors.ErrUnsupported) {
+		t.Errorf("expected ErrValidation and not ErrUnsupported, got %v", err)
+	}
+}
+
+func TestGetDNSKEYs(t *testing.T) {
+	ctx := context.Background()
+	f := newFakePDNS(t)
+	f.AddZone("example.org.")
+	p := f.provider()
+
+	keys, err := p.GetDNSKEYs(ctx, "example.org.")
+	if err != nil || len(keys) != 0 {
+		t.Fatalf("unsigned zone: %v, %v", keys, err)
+	}
+	if _, err := p.EnableDNSSEC(ctx, "example.org."); err != nil {
+		t.Fatal(err)
+	}
+	keys, err = p.GetDNSKEYs(ctx, "example.org.")
+	if err != nil {
+		t.Fatalf("GetDNSKEYs: %s", err)
+	}
+	if len(keys) != 1 || keys[0].Flags != 257 || keys[0].KeyType != "csk" || !keys[0].Active || len(keys[0].DS) != 2 {
+		t.Errorf("unexpected keys %#v", keys)
+	}
+	if _, err := p.GetDNSKEYs(ctx, "missing.org."); !errors.Is(err, ErrZoneNotFound) {
+		t.Errorf("expected ErrZoneNotFound, got %v", err)
+	}
+}
@@ -0,0 +1,170 @@
+package powerdns
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/joeig/go-powerdns/v3"
+)
+
+// ErrZoneNotFound is returned (wrapped) when the requested zone does not
+// exist on the server.
+var ErrZoneNotFound = errors.New("zone not found")
+
+// ErrRecordNotFound is returned (wrapped) when an rrset or record the
+// operation needs is not in the zone.
+var ErrRecordNotFound = errors.New("record not found")
+
+// ErrZoneExists is returned (wrapped) by CreateZone when the zone is
+// already on the server.
+var ErrZoneExists = errors.New("zone already exists")
+
+// ErrConcurrentModification is returned (wrapped) when a write gave up
+// because the zone kept changing under it, see Provider.ConflictRetries.
+var ErrConcurrentModification = errors.New("zone modified concurrently")
+
+// ErrUnauthorized is returned (wrapped) when the server rejects the API
+// token, or the token may not access the requested resource.
+var ErrUnauthorized = errors.New("not authorized by the server (check the API token)")
+
+// ErrNotFound is returned (wrapped) when the server answers that the
+// requested resource doesn't exist.  Missing zones additionally match
+// ErrZoneNotFound.
+var ErrNotFound = errors.New("not found")
+
+// ErrValidation is returned (wrapped) when the server rejects a request as
+// invalid, typically a malformed or out of zone record.  The server's
+// explanation is part of the error message.
+var ErrValidation = errors.New("rejected by the server")
+
+// APIError is an error response of the PowerDNS server.  It matches the
+// sentinel errors of this package that apply with errors.Is, and the
+// underlying *powerdns.Error with errors.As.
+type APIError struct {
+	StatusCode int
+
+	// Message is the explanation the server sent, if any.
+	Message string
+
+	kinds []error
+	err   error
+}
+
+func (e *APIError) Error() string {
+	msg := e.Message
+	if msg == "" {
+		msg = fmt.Sprintf("HTTP status %d", e.StatusCode)
+	}
+	if len(e.kinds) == 0 {
+		return msg
+	}
+	return e.kinds[0].Error() + ": " + msg
+}
+
+func (e *APIError) Unwrap() []error {
+	return append(slices.Clone(e.kinds), e.err)
+}
+
+// wrapAPIError translates errors from the server into an *APIError
+// carrying the matching sentinels.  zone is the zone the request was
+// about, if any; a "zone not found" answer about it becomes
+// ErrZoneNotFound.  Status codes without a sentinel are returned as is.
+func wrapAPIError(err error, zone string) error {
+	var perr *powerdns.Error
+	if !errors.As(err, &perr) {
+		return err
+	}
+	apiErr := &APIError{StatusCode: perr.StatusCode, Message: perr.Message, err: err}
+	switch {
+	case perr.StatusCode == http.StatusUnauthorized || perr.StatusCode == http.StatusForbidden:
+		apiErr.kinds = []error{ErrUnauthorized}
+	case zone != "" && isNotFound(err):
+		apiErr.kinds = []error{ErrZoneNotFound, ErrNotFound}
+		apiErr.Message = zone
+	case perr.StatusCode == http.StatusNotFound:
+		apiErr.kinds = []error{ErrNotFound}
+	case perr.StatusCode == http.StatusConflict || isExists(perr):
+		apiErr.kinds = []error{ErrZoneExists}
+	case perr.StatusCode == http.StatusUnprocessableEntity:
+		apiErr.kinds = []error{ErrValidation}
+	case perr.StatusCode == http.StatusServiceUnavailable:
+		apiErr.kinds = []error{ErrServerUnavailable}
+	case perr.StatusCode == http.StatusTooManyRequests:
+		apiErr.kinds = []error{ErrRateLimited}
+	default:
+		return err
+	}
+	return apiErr
+}
+
+// isNotFound reports whether err is the server telling us the zone doesn't
+// exist.  Recent PowerDNS versions answer with a 404, older ones with a 422
+// and a "Could not find domain" message.
+func isNotFound(err error) bool {
+	var perr *powerdns.Error
+	if !errors.As(err, &perr) {
+		return false
+	}
+	switch perr.StatusCode {
+	case http.StatusNotFound:
+		return true
+	case http.StatusUnprocessableEntity:
+		return strings.Contains(perr.Message, "Could not find domain")
+	}
+	return false
+}
+
+// isExists reports whether perr is the server refusing to create a zone
+// that is already there.  Current versions answer with a 409, some older
+// ones with a 422.
+func isExists(perr *powerdns.Error) bool {
+	return perr.StatusCode == http.StatusUnprocessableEntity && strings.Contains(perr.Message, "already exists")
+}
+
+// ErrServerUnavailable is returned (wrapped) when the server answers with
+// 503 Service Unavailable, typically while it is being reloaded or under
+// maintenance.  Such errors are transient; see Provider.MaxRetries.
+var ErrServerUnavailable = errors.New("server unavailable")
+
+// ErrRateLimited is returned (wrapped) when the server, or a proxy in front
+// of it, answers with 429 Too Many Requests.  Such errors are transient;
+// see Provider.MaxRetries and Provider.RateLimit.
+var ErrRateLimited = errors.New("rate limited by the server")
+
+// ErrSchemaMismatch is returned (wrapped) when a server response doesn't
+// have the shape this package expects, typically because a field changed
+// type between PowerDNS versions.  The error names the field and the
+// server version.
+var ErrSchemaMismatch = errors.New("unexpected API response")
+
+// checkSchema turns JSON decoding errors into ErrSchemaMismatch errors
+// that say which field was off and which server version sent it.  Other
+// errors are returned unchanged.
+func (c *client) checkSchema(ctx context.Context, err error) error {
+	var typeErr *json.UnmarshalTypeError
+	var syntaxErr *json.SyntaxError
+	var detail string
+	switch {
+	case errors.As(err, &typeErr):
+		field := typeErr.Field
+		if typeErr.Struct != "" {
+			field = typeErr.Struct + "." + field
+		}
+		detail = fmt.Sprintf("field %s is a JSON %s, expected %s", field, typeErr.Value, typeErr.Type)
+	case errors.As(err, &syntaxErr):
+		detail = fmt.Sprintf("malformed JSON at offset %d", syntaxErr.Offset)
+	default:
+		return err
+	}
+	version := "unknown"
+	// the version itself may be what failed to decode
+	if v, verr := c.serverVersion(ctx); verr == nil && v != "" {
+		version = v
+	}
+	return fmt.Errorf("%w from PowerDNS %s: %s: %w", ErrSchemaMismatch, version, detail, err)
+}
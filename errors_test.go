@@ -0,0 +1,150 @@
+package powerdns
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/joeig/go-powerdns/v3"
+	"github.com/libdns/libdns"
+)
+
+func TestSchemaMismatch(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/api/v1/servers/localhost":
+			_, _ = w.Write([]byte(`{"id": "localhost", "version": "9.1.0-beta1"}`))
+		case "/api/v1/servers/localhost/zones/example.org.":
+			// a future version changed the serial into a string
+			_, _ = w.Write([]byte(`{"id": "example.org.", "name": "example.org.", "serial": "2024010101", "rrsets": []}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+	p := &Provider{ServerURL: srv.URL, APIToken: "secret"}
+
+	_, err := p.GetRecords(context.Background(), "example.org.")
+	if !errors.Is(err, ErrSchemaMismatch) {
+		t.Fatalf("expected ErrSchemaMismatch, got %v", err)
+	}
+	for _, want := range []string{"field serial", "9.1.0-beta1", "JSON string"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error %q does not mention %q", err, want)
+		}
+	}
+}
+
+func TestTypedErrors(t *testing.T) {
+	ctx := context.Background()
+	f := newFakePDNS(t)
+	f.AddZone("example.org.", rrset("www.example.org.", "A", 60, "127.0.0.1"))
+	p := f.provider()
+
+	_, err := p.GetRecords(ctx, "missing.org.")
+	if !errors.Is(err, ErrZoneNotFound) {
+		t.Errorf("GetRecords on a missing zone: expected ErrZoneNotFound, got %v", err)
+	}
+	_, err = p.AppendRecords(ctx, "missing.org.", []libdns.Record{libdns.TXT{Name: "x", Text: "y"}})
+	if !errors.Is(err, ErrZoneNotFound) {
+		t.Errorf("AppendRecords on a missing zone: expected ErrZoneNotFound, got %v", err)
+	}
+
+	err = p.SetRecordComment(ctx, "example.org.", "nope", "A", "c", "")
+	if !errors.Is(err, ErrRecordNotFound) {
+		t.Errorf("SetRecordComment on a missing rrset: expected ErrRecordNotFound, got %v", err)
+	}
+
+	bad := &Provider{ServerURL: f.URL, APIToken: "wrong"}
+	_, err = bad.GetRecords(ctx, "example.org.")
+	if !errors.Is(err, ErrUnauthorized) {
+		t.Errorf("GetRecords with a bad token: expected ErrUnauthorized, got %v", err)
+	}
+	var perr *powerdns.Error
+	if !errors.As(err, &perr) || perr.StatusCode != http.StatusUnauthorized {
+		t.Errorf("the server error should stay in the chain, got %v", err)
+	}
+	_, err = bad.AppendRecords(ctx, "example.org.", []libdns.Record{libdns.TXT{Name: "x", Text: "y"}})
+	if !errors.Is(err, ErrUnauthorized) {
+		t.Errorf("AppendRecords with a bad token: expected ErrUnauthorized, got %v", err)
+	}
+	err = bad.DeleteZone(ctx, "example.org.")
+	if !errors.Is(err, ErrUnauthorized) {
+		t.Errorf("DeleteZone with a bad token: expected ErrUnauthorized, got %v", err)
+	}
+}
+
+func TestStatusMapping(t *testing.T) {
+	ctx := context.Background()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/api/v1/servers/localhost/zones/gone.org.":
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write([]byte(`{"error": "Not Found"}`))
+		case "/api/v1/servers/localhost/zones/old.org.":
+			w.WriteHeader(http.StatusUnprocessableEntity)
+			_, _ = w.Write([]byte(`{"error": "Could not find domain 'old.org.'"}`))
+		case "/api/v1/servers/localhost/zones/invalid.org.":
+			w.WriteHeader(http.StatusUnprocessableEntity)
+			_, _ = w.Write([]byte(`{"error": "Record www.invalid.org./A '1.2.3': Parsing record content failed"}`))
+		case "/api/v1/servers/localhost/zones/reloading.org.":
+			w.Header().Set("Content-Type", "text/html")
+			w.WriteHeader(http.StatusServiceUnavailable)
+			_, _ = w.Write([]byte(`<h1>503 Service Unavailable</h1>`))
+		case "/api/v1/servers/localhost/zones/busy.org.":
+			w.WriteHeader(http.StatusTooManyRequests)
+			_, _ = w.Write([]byte(`{"error": "Too Many Requests"}`))
+		case "/api/v1/servers/localhost/zones/forbidden.org.":
+			w.WriteHeader(http.StatusForbidden)
+			_, _ = w.Write([]byte(`{"error": "Forbidden"}`))
+		default:
+			w.WriteHeader(http.StatusInternalServerError)
+			_, _ = w.Write([]byte(`{"error": "Internal Server Error"}`))
+		}
+	}))
+	defer srv.Close()
+	p := &Provider{ServerURL: srv.URL, APIToken: "secret"}
+
+	for _, tc := range []struct {
+		zone    string
+		is      []error
+		isNot   []error
+		message string
+	}{
+		{zone: "gone.org.", is: []error{ErrNotFound, ErrZoneNotFound}, isNot: []error{ErrValidation}},
+		{zone: "old.org.", is: []error{ErrNotFound, ErrZoneNotFound}, isNot: []error{ErrValidation}},
+		{zone: "invalid.org.", is: []error{ErrValidation}, isNot: []error{ErrNotFound}, message: "Parsing record content failed"},
+		{zone: "forbidden.org.", is: []error{ErrUnauthorized}, isNot: []error{ErrNotFound}},
+		{zone: "reloading.org.", is: []error{ErrServerUnavailable}, isNot: []error{ErrNotFound, ErrZoneNotFound}},
+		{zone: "busy.org.", is: []error{ErrRateLimited}, isNot: []error{ErrServerUnavailable}},
+		{zone: "broken.org.", isNot: []error{ErrNotFound, ErrValidation, ErrUnauthorized, ErrServerUnavailable, ErrRateLimited}},
+	} {
+		_, err := p.GetRecords(ctx, tc.zone)
+		if err == nil {
+			t.Errorf("%s: expected an error", tc.zone)
+			continue
+		}
+		for _, want := range tc.is {
+			if !errors.Is(err, want) {
+				t.Errorf("%s: %v should match %v", tc.zone, err, want)
+			}
+		}
+		for _, unwanted := range tc.isNot {
+			if errors.Is(err, unwanted) {
+				t.Errorf("%s: %v should not match %v", tc.zone, err, unwanted)
+			}
+		}
+		if !strings.Contains(err.Error(), tc.message) {
+			t.Errorf("%s: %q does not carry the server message %q", tc.zone, err, tc.message)
+		}
+		var perr *powerdns.Error
+		if !errors.As(err, &perr) {
+			t.Errorf("%s: original error lost: %v", tc.zone, err)
+		}
+	}
+}
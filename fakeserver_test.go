@@ -0,0 +1,31 @@
+package powerdns
+
+import (
+	"testing"
+
+	"github.com/joeig/go-powerdns/v3"
+	"github.com/libdns/powerdns/internal/fakepdns"
+)
+
+// fakePDNS is the in-memory PowerDNS server pdnstest is built on, good
+// enough to exercise the provider without a real server.
+type fakePDNS struct {
+	*fakepdns.Server
+}
+
+func newFakePDNS(t *testing.T) *fakePDNS {
+	t.Helper()
+	return &fakePDNS{fakepdns.New(t, "secret")}
+}
+
+// provider returns a Provider talking to the fake server.
+func (f *fakePDNS) provider() *Provider {
+	return &Provider{
+		ServerURL: f.URL,
+		APIToken:  "secret",
+	}
+}
+
+func rrset(name, rrType string, ttl uint32, contents ...string) powerdns.RRset {
+	return fakepdns.NewRRset(name, rrType, ttl, contents...)
+}
@@ -5,4 +5,5 @@ go 1.22.7
 require (
 	github.com/joeig/go-powerdns/v3 v3.20.0
 	github.com/libdns/libdns v1.1.1
+	golang.org/x/time v0.8.0
 )
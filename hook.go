@@ -0,0 +1,35 @@
+package powerdns
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/joeig/go-powerdns/v3"
+)
+
+// hookTransport wraps http.RoundTripper to report every request to a
+// Provider.RequestHook
+type hookTransport struct {
+	transport http.RoundTripper
+	hook      func(ctx context.Context, method, url string, err error, dur time.Duration)
+}
+
+func (h *hookTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	start := time.Now()
+	resp, err := h.transport.RoundTrip(req)
+	outcome := err
+	if err == nil && (resp.StatusCode < 200 || resp.StatusCode > 299) {
+		outcome = &powerdns.Error{StatusCode: resp.StatusCode, Status: resp.Status}
+	}
+	h.call(req, outcome, time.Since(start))
+	return resp, err
+}
+
+// call runs the hook, which must not break the request if it panics
+func (h *hookTransport) call(req *http.Request, err error, dur time.Duration) {
+	defer func() {
+		_ = recover()
+	}()
+	h.hook(req.Context(), req.Method, req.URL.String(), err, dur)
+}
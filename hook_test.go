@@ -0,0 +1,56 @@
+package powerdns
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/joeig/go-powerdns/v3"
+)
+
+func TestRequestHook(t *testing.T) {
+	ctx := context.Background()
+	f := newFakePDNS(t)
+	f.AddZone("example.org.", rrset("www.example.org.", "A", 60, "192.0.2.1"))
+
+	type call struct {
+		method, url string
+		err         error
+	}
+	var calls []call
+	p := f.provider()
+	p.RequestHook = func(ctx context.Context, method, url string, err error, dur time.Duration) {
+		if dur <= 0 {
+			t.Errorf("bad duration %s", dur)
+		}
+		calls = append(calls, call{method, url, err})
+	}
+
+	if _, err := p.GetRecords(ctx, "example.org."); err != nil {
+		t.Fatalf("GetRecords: %s", err)
+	}
+	if len(calls) != 1 || calls[0].method != http.MethodGet || !strings.HasSuffix(calls[0].url, "/zones/example.org.") || calls[0].err != nil {
+		t.Errorf("unexpected calls %+v", calls)
+	}
+
+	calls = nil
+	if _, err := p.GetRecords(ctx, "missing.org."); err == nil {
+		t.Fatal("expected an error for a missing zone")
+	}
+	var perr *powerdns.Error
+	if len(calls) != 1 || !errors.As(calls[0].err, &perr) || perr.StatusCode != http.StatusNotFound {
+		t.Errorf("the failure was not reported: %+v", calls)
+	}
+
+	// a panicking hook doesn't get in the way
+	p = f.provider()
+	p.RequestHook = func(context.Context, string, string, error, time.Duration) {
+		panic("hook failed")
+	}
+	if _, err := p.GetRecords(ctx, "example.org."); err != nil {
+		t.Errorf("GetRecords with a panicking hook: %s", err)
+	}
+}
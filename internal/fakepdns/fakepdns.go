@@ -0,0 +1,643 @@
+// Package fakepdns is the in-memory PowerDNS HTTP API behind pdnstest and
+// the provider's own tests.
+//
+// The server keeps its zones, metadata and keys in exported maps and logs
+// every request, so tests can set up and inspect state directly.  All of it
+// is guarded by the embedded mutex, which is held while a request is
+// served; tests that only touch it between requests need not lock.
+package fakepdns
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	api "github.com/joeig/go-powerdns/v3"
+)
+
+// Server is a fake PowerDNS server.
+type Server struct {
+	// URL is the base URL of the server, for Provider.ServerURL.
+	URL string
+
+	sync.Mutex
+
+	// Token is the API key requests must carry.
+	Token string
+	// Version is the PowerDNS version the server reports.
+	Version string
+	// NoDNSSEC makes the server behave like a backend without DNSSEC
+	// support.
+	NoDNSSEC bool
+	// NoRRsetFilter makes the server ignore rrset_name and rrset_type,
+	// like servers from before they were added.
+	NoRRsetFilter bool
+	// OnZoneGet, if set, is called with the zone before a GET of it is
+	// answered, e.g. to change it the way another client would.
+	OnZoneGet func(z *api.Zone)
+	// Intercept, if set, is called with every request before it is
+	// served.  If it returns true it has answered the request itself, e.g.
+	// with an injected error status.
+	Intercept func(w http.ResponseWriter, r *http.Request) bool
+
+	// Zones, Metadata and Keys are the server's state by zone name.
+	Zones    map[string]*api.Zone
+	Metadata map[string]map[string][]string
+	Keys     map[string][]api.Cryptokey
+
+	// Calls holds the method and path of every request, Queries its raw
+	// query and Patches the rrsets of every PATCH.
+	Calls   []string
+	Queries []string
+	Patches [][]api.RRset
+
+	srv *httptest.Server
+}
+
+// New starts a server without zones that accepts token.  It is shut down
+// when the test and its subtests are done.
+func New(t testing.TB, token string) *Server {
+	t.Helper()
+	s := &Server{
+		Token:    token,
+		Version:  "4.9.0",
+		Zones:    make(map[string]*api.Zone),
+		Metadata: make(map[string]map[string][]string),
+		Keys:     make(map[string][]api.Cryptokey),
+	}
+	s.srv = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+	s.URL = s.srv.URL
+	t.Cleanup(s.srv.Close)
+	return s
+}
+
+// AddZone stores a Native zone with exactly the given rrsets, without the
+// SOA creating it through the API would add.  Adding a zone that exists
+// replaces it.
+func (s *Server) AddZone(name string, rrsets ...api.RRset) {
+	s.Lock()
+	defer s.Unlock()
+	s.createZone(&api.Zone{Name: api.String(name), RRsets: rrsets})
+}
+
+// CreateZone creates a Native zone with an SOA record, as creating it
+// through the API would.  Creating a zone that exists replaces it.
+func (s *Server) CreateZone(name string) {
+	s.Lock()
+	defer s.Unlock()
+	z := &api.Zone{Name: api.String(name)}
+	addSOA(z)
+	s.createZone(z)
+}
+
+// ZoneNames returns the names of the zones on the server, sorted.
+func (s *Server) ZoneNames() []string {
+	s.Lock()
+	defer s.Unlock()
+	names := make([]string, 0, len(s.Zones))
+	for name := range s.Zones {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Zone returns a copy of the stored zone, or nil.
+func (s *Server) Zone(name string) *api.Zone {
+	s.Lock()
+	defer s.Unlock()
+	z, ok := s.Zones[Canonical(name)]
+	if !ok {
+		return nil
+	}
+	cp := *z
+	cp.RRsets = slices.Clone(z.RRsets)
+	return &cp
+}
+
+// RRset returns the stored rrset for name and type, or nil.
+func (s *Server) RRset(zone, name, rrType string) *api.RRset {
+	z := s.Zone(zone)
+	if z == nil {
+		return nil
+	}
+	return findRRset(z, Canonical(name), rrType)
+}
+
+// CallCount returns how many requests matched the method and path suffix.
+func (s *Server) CallCount(method, pathSuffix string) int {
+	s.Lock()
+	defer s.Unlock()
+	n := 0
+	for _, c := range s.Calls {
+		m, p, _ := strings.Cut(c, " ")
+		if m == method && strings.HasSuffix(p, pathSuffix) {
+			n++
+		}
+	}
+	return n
+}
+
+// BumpSerial increases the SOA serial of z, as SOA-EDIT-API does on API
+// edits.  The caller must hold the lock, as OnZoneGet does.
+func (s *Server) BumpSerial(z *api.Zone) {
+	soa := findRRset(z, api.StringValue(z.Name), "SOA")
+	if soa == nil || len(soa.Records) == 0 {
+		return
+	}
+	fields := strings.Fields(api.StringValue(soa.Records[0].Content))
+	if len(fields) != 7 {
+		return
+	}
+	serial, _ := strconv.ParseUint(fields[2], 10, 32)
+	fields[2] = strconv.FormatUint(serial+1, 10)
+	soa.Records = slices.Clone(soa.Records)
+	soa.Records[0].Content = api.String(strings.Join(fields, " "))
+	z.Serial = api.Uint32(soaSerial(z))
+}
+
+// NewRRset returns an rrset of enabled records with the given contents.
+func NewRRset(name, rrType string, ttl uint32, contents ...string) api.RRset {
+	rs := api.RRset{
+		Name: api.String(name),
+		Type: api.RRTypePtr(api.RRType(rrType)),
+		TTL:  api.Uint32(ttl),
+	}
+	for _, c := range contents {
+		rs.Records = append(rs.Records, api.Record{Content: api.String(c), Disabled: api.Bool(false)})
+	}
+	return rs
+}
+
+// Canonical returns name in lowercase with a trailing dot, the way the
+// server stores names.
+func Canonical(name string) string {
+	return strings.ToLower(strings.TrimSuffix(name, ".")) + "."
+}
+
+// createZone stores a new zone, filling in what PowerDNS would
+func (s *Server) createZone(z *api.Zone) *api.Zone {
+	name := Canonical(api.StringValue(z.Name))
+	z.ID = api.String(name)
+	z.Name = api.String(name)
+	z.Type = nil
+	if z.Kind == nil {
+		z.Kind = api.ZoneKindPtr(api.NativeZoneKind)
+	}
+	for i := range z.RRsets {
+		z.RRsets[i].ChangeType = nil
+		z.RRsets[i].Name = api.String(Canonical(api.StringValue(z.RRsets[i].Name)))
+	}
+	if len(z.Nameservers) > 0 && findRRset(z, name, "NS") == nil {
+		z.RRsets = append(z.RRsets, NewRRset(name, "NS", 3600, z.Nameservers...))
+	}
+	z.Nameservers = nil
+	z.Serial = api.Uint32(soaSerial(z))
+	s.Zones[name] = z
+	return z
+}
+
+// addSOA gives z the SOA PowerDNS creates zones with, unless it has one
+func addSOA(z *api.Zone) {
+	name := Canonical(api.StringValue(z.Name))
+	if findRRset(z, name, "SOA") == nil {
+		soa := NewRRset(name, "SOA", 3600, fmt.Sprintf("a.misconfigured.dns.server.invalid. hostmaster.%s 1 10800 3600 604800 3600", name))
+		z.RRsets = append([]api.RRset{soa}, z.RRsets...)
+	}
+}
+
+func (s *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	s.Lock()
+	defer s.Unlock()
+	s.Calls = append(s.Calls, r.Method+" "+r.URL.Path)
+	s.Queries = append(s.Queries, r.URL.RawQuery)
+
+	if s.Intercept != nil && s.Intercept(w, r) {
+		return
+	}
+	if r.Header.Get("X-API-Key") != s.Token {
+		writeError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+	rest, ok := strings.CutPrefix(r.URL.Path, "/api/v1/servers/localhost")
+	if !ok {
+		writeError(w, http.StatusNotFound, "Not Found")
+		return
+	}
+	// parts[0] is the empty string before the leading slash
+	parts := strings.Split(rest, "/")
+	switch {
+	case len(parts) == 1 && r.Method == http.MethodGet:
+		writeJSON(w, http.StatusOK, api.Server{
+			ID:         api.String("localhost"),
+			DaemonType: api.String("authoritative"),
+			Version:    api.String(s.Version),
+		})
+		return
+	case len(parts) == 2 && parts[1] == "search-data" && r.Method == http.MethodGet:
+		s.serveSearch(w, r)
+		return
+	case len(parts) < 2 || parts[1] != "zones":
+		writeError(w, http.StatusNotFound, "Not Found")
+		return
+	case len(parts) == 2:
+		s.serveZones(w, r)
+		return
+	}
+	// zone IDs are matched exactly, mixed case doesn't find a zone
+	z, ok := s.Zones[parts[2]]
+	if !ok {
+		writeError(w, http.StatusNotFound, fmt.Sprintf("Could not find domain '%s'", parts[2]))
+		return
+	}
+	if len(parts) == 3 {
+		s.serveZone(w, r, z)
+		return
+	}
+	switch parts[3] {
+	case "metadata":
+		s.serveMetadata(w, r, z, parts[4:])
+		return
+	case "rectify":
+		if r.Method == http.MethodPut {
+			if api.BoolValue(z.Presigned) {
+				writeError(w, http.StatusUnprocessableEntity, "Zone is pre-signed, not rectifying.")
+				return
+			}
+			writeJSON(w, http.StatusOK, map[string]string{"result": "Rectified"})
+			return
+		}
+	case "axfr-retrieve":
+		if r.Method == http.MethodPut {
+			writeJSON(w, http.StatusOK, map[string]string{"result": "Added retrieval request for '" + *z.ID + "' from primary " + strings.Join(z.Masters, ",")})
+			return
+		}
+	case "notify":
+		if r.Method == http.MethodPut {
+			writeJSON(w, http.StatusOK, map[string]string{"result": "Notification queued"})
+			return
+		}
+	case "export":
+		if r.Method == http.MethodGet {
+			w.Header().Set("Content-Type", "text/plain")
+			var b strings.Builder
+			for _, rr := range z.RRsets {
+				for _, rec := range rr.Records {
+					fmt.Fprintf(&b, "%s\t%d\tIN\t%s\t%s\n", api.StringValue(rr.Name), api.Uint32Value(rr.TTL), *rr.Type, api.StringValue(rec.Content))
+				}
+			}
+			_, _ = w.Write([]byte(b.String()))
+			return
+		}
+	case "cryptokeys":
+		if r.Method == http.MethodGet && len(parts) == 4 {
+			writeJSON(w, http.StatusOK, append([]api.Cryptokey{}, s.Keys[*z.ID]...))
+			return
+		}
+	}
+	writeError(w, http.StatusNotFound, "Not Found")
+}
+
+func (s *Server) serveZones(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		out := make([]api.Zone, 0, len(s.Zones))
+		for _, z := range s.Zones {
+			cp := *z
+			cp.RRsets = nil
+			out = append(out, cp)
+		}
+		sort.Slice(out, func(i, j int) bool { return *out[i].Name < *out[j].Name })
+		writeJSON(w, http.StatusOK, out)
+	case http.MethodPost:
+		var z api.Zone
+		if err := json.NewDecoder(r.Body).Decode(&z); err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		name := Canonical(api.StringValue(z.Name))
+		if _, ok := s.Zones[name]; ok {
+			writeError(w, http.StatusConflict, fmt.Sprintf("Domain '%s' already exists", name))
+			return
+		}
+		addSOA(&z)
+		writeJSON(w, http.StatusCreated, s.createZone(&z))
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "Method Not Allowed")
+	}
+}
+
+func (s *Server) serveZone(w http.ResponseWriter, r *http.Request, z *api.Zone) {
+	switch r.Method {
+	case http.MethodGet:
+		if s.OnZoneGet != nil {
+			s.OnZoneGet(z)
+		}
+		q := r.URL.Query()
+		cp := *z
+		switch name, rrType := strings.ToLower(q.Get("rrset_name")), q.Get("rrset_type"); {
+		case q.Get("rrsets") == "false":
+			cp.RRsets = nil
+		case name != "" && !s.NoRRsetFilter:
+			cp.RRsets = nil
+			for _, rs := range z.RRsets {
+				if *rs.Name == name && (rrType == "" || string(*rs.Type) == rrType) {
+					cp.RRsets = append(cp.RRsets, rs)
+				}
+			}
+		}
+		writeJSON(w, http.StatusOK, &cp)
+	case http.MethodDelete:
+		delete(s.Zones, *z.ID)
+		delete(s.Metadata, *z.ID)
+		delete(s.Keys, *z.ID)
+		w.WriteHeader(http.StatusNoContent)
+	case http.MethodPut:
+		var change api.Zone
+		if err := json.NewDecoder(r.Body).Decode(&change); err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		if err := s.change(z, &change); err != nil {
+			writeError(w, http.StatusUnprocessableEntity, err.Error())
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	case http.MethodPatch:
+		var payload api.RRsets
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		s.Patches = append(s.Patches, payload.Sets)
+		if err := patch(z, payload.Sets); err != nil {
+			writeError(w, http.StatusUnprocessableEntity, err.Error())
+			return
+		}
+		s.BumpSerial(z)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "Method Not Allowed")
+	}
+}
+
+// patch applies rrset changes in the all-or-nothing way PowerDNS does,
+// with its checks on names, duplicates and CNAME conflicts
+func patch(z *api.Zone, sets []api.RRset) error {
+	rrsets := slices.Clone(z.RRsets)
+	for _, set := range sets {
+		if set.Name == nil || set.Type == nil || set.ChangeType == nil {
+			return fmt.Errorf("RRset is missing name, type or changetype")
+		}
+		name := strings.ToLower(*set.Name)
+		if !strings.HasSuffix(name, ".") {
+			return fmt.Errorf("RRset %s IN %s: Name is not canonical", name, *set.Type)
+		}
+		if name != *z.Name && !strings.HasSuffix(name, "."+*z.Name) {
+			return fmt.Errorf("RRset %s IN %s: Name is out of zone", name, *set.Type)
+		}
+		idx := slices.IndexFunc(rrsets, func(rs api.RRset) bool { return *rs.Name == name && *rs.Type == *set.Type })
+		switch *set.ChangeType {
+		case api.ChangeTypeDelete:
+			if idx >= 0 {
+				rrsets = slices.Delete(rrsets, idx, idx+1)
+			}
+			continue
+		case api.ChangeTypeReplace:
+		default:
+			return fmt.Errorf("RRset %s IN %s: unknown changetype %s", name, *set.Type, *set.ChangeType)
+		}
+		if len(set.Records) == 0 {
+			if idx >= 0 {
+				rrsets = slices.Delete(rrsets, idx, idx+1)
+			}
+			continue
+		}
+		if set.TTL == nil {
+			return fmt.Errorf("RRset %s IN %s: missing TTL", name, *set.Type)
+		}
+		seen := make(map[string]bool)
+		for _, rec := range set.Records {
+			content := api.StringValue(rec.Content)
+			if seen[content] {
+				return fmt.Errorf("RRset %s IN %s has duplicate record %q", name, *set.Type, content)
+			}
+			seen[content] = true
+		}
+		set.Name = api.String(name)
+		set.ChangeType = nil
+		if idx >= 0 {
+			rrsets[idx] = set
+		} else {
+			rrsets = append(rrsets, set)
+		}
+	}
+	for _, rs := range rrsets {
+		if *rs.Type != api.RRTypeCNAME {
+			continue
+		}
+		for _, other := range rrsets {
+			if *other.Name == *rs.Name && *other.Type != api.RRTypeCNAME {
+				return fmt.Errorf("RRset %s IN %s: Conflicts with pre-existing RRset", *rs.Name, *other.Type)
+			}
+		}
+	}
+	z.RRsets = rrsets
+	return nil
+}
+
+// change applies the settings of a zone PUT.  Only the fields the provider
+// changes are supported.
+func (s *Server) change(z *api.Zone, change *api.Zone) error {
+	if change.DNSsec != nil && *change.DNSsec != api.BoolValue(z.DNSsec) {
+		if s.NoDNSSEC {
+			return fmt.Errorf("Zone '%s' can not be secured: backend does not support DNSSEC", *z.Name)
+		}
+		z.DNSsec = change.DNSsec
+		if *change.DNSsec {
+			s.Keys[*z.ID] = []api.Cryptokey{{
+				ID:        api.Uint64(1),
+				KeyType:   api.String("csk"),
+				Active:    api.Bool(true),
+				Algorithm: api.String("ECDSAP256SHA256"),
+				DNSkey:    api.String("257 3 13 dGVzdGtleQ=="),
+				DS:        []string{"4242 13 2 0123456789abcdef", "4242 13 4 fedcba9876543210"},
+			}}
+		} else {
+			delete(s.Keys, *z.ID)
+		}
+	}
+	if change.Kind != nil {
+		z.Kind = change.Kind
+	}
+	if change.Masters != nil {
+		z.Masters = change.Masters
+	}
+	if change.Account != nil {
+		z.Account = change.Account
+	}
+	if change.SOAEditAPI != nil {
+		z.SOAEditAPI = change.SOAEditAPI
+	}
+	if change.Catalog != nil {
+		z.Catalog = change.Catalog
+	}
+	return nil
+}
+
+func (s *Server) serveMetadata(w http.ResponseWriter, r *http.Request, z *api.Zone, rest []string) {
+	md := s.Metadata[*z.ID]
+	if md == nil {
+		md = make(map[string][]string)
+		s.Metadata[*z.ID] = md
+	}
+	if len(rest) == 0 {
+		switch r.Method {
+		case http.MethodGet:
+			out := make([]api.Metadata, 0, len(md))
+			for kind, values := range md {
+				out = append(out, api.Metadata{Kind: api.MetadataKindPtr(api.MetadataKind(kind)), Metadata: values})
+			}
+			writeJSON(w, http.StatusOK, out)
+		case http.MethodPost:
+			var m api.Metadata
+			if err := json.NewDecoder(r.Body).Decode(&m); err != nil {
+				writeError(w, http.StatusBadRequest, err.Error())
+				return
+			}
+			kind := string(*m.Kind)
+			md[kind] = append(md[kind], m.Metadata...)
+			writeJSON(w, http.StatusCreated, api.Metadata{Kind: m.Kind, Metadata: md[kind]})
+		default:
+			writeError(w, http.StatusMethodNotAllowed, "Method Not Allowed")
+		}
+		return
+	}
+
+	kind := rest[0]
+	switch r.Method {
+	case http.MethodGet:
+		values := md[kind]
+		if values == nil {
+			values = []string{}
+		}
+		writeJSON(w, http.StatusOK, api.Metadata{Kind: api.MetadataKindPtr(api.MetadataKind(kind)), Metadata: values})
+	case http.MethodPut:
+		var m api.Metadata
+		if err := json.NewDecoder(r.Body).Decode(&m); err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		md[kind] = m.Metadata
+		writeJSON(w, http.StatusOK, api.Metadata{Kind: api.MetadataKindPtr(api.MetadataKind(kind)), Metadata: md[kind]})
+	case http.MethodDelete:
+		delete(md, kind)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "Method Not Allowed")
+	}
+}
+
+// serveSearch answers search-data queries, matching the query with * and
+// ? wildcards against zone names, record names and contents and comments
+// as PowerDNS does
+func (s *Server) serveSearch(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	pattern := "^" + strings.NewReplacer(`\*`, ".*", `\?`, ".").Replace(regexp.QuoteMeta(strings.ToLower(q.Get("q")))) + "$"
+	re := regexp.MustCompile(pattern)
+	max, err := strconv.Atoi(q.Get("max"))
+	if err != nil {
+		writeError(w, http.StatusUnprocessableEntity, "max is not a number")
+		return
+	}
+	objectType := q.Get("object_type")
+	wants := func(t string) bool { return objectType == "" || objectType == "all" || objectType == t }
+	names := make([]string, 0, len(s.Zones))
+	for name := range s.Zones {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	out := make([]api.SearchResult, 0)
+	for _, name := range names {
+		z := s.Zones[name]
+		if wants("zone") && re.MatchString(name) {
+			out = append(out, api.SearchResult{ObjectType: api.String("zone"), Name: z.Name, ZoneID: z.ID})
+		}
+		for _, rr := range z.RRsets {
+			for _, cm := range rr.Comments {
+				if wants("comment") && re.MatchString(strings.ToLower(api.StringValue(cm.Content))) {
+					out = append(out, api.SearchResult{
+						ObjectType: api.String("comment"),
+						Zone:       z.Name,
+						ZoneID:     z.ID,
+						Name:       rr.Name,
+						Type:       api.String(string(*rr.Type)),
+						Content:    cm.Content,
+					})
+				}
+			}
+			if !wants("record") {
+				continue
+			}
+			for _, rec := range rr.Records {
+				if !re.MatchString(strings.ToLower(*rr.Name)) && !re.MatchString(strings.ToLower(*rec.Content)) {
+					continue
+				}
+				out = append(out, api.SearchResult{
+					ObjectType: api.String("record"),
+					Zone:       z.Name,
+					ZoneID:     z.ID,
+					Name:       rr.Name,
+					Type:       api.String(string(*rr.Type)),
+					Content:    rec.Content,
+					TTL:        rr.TTL,
+					Disabled:   api.Bool(api.BoolValue(rec.Disabled)),
+				})
+			}
+		}
+	}
+	if len(out) > max {
+		out = out[:max]
+	}
+	writeJSON(w, http.StatusOK, out)
+}
+
+func soaSerial(z *api.Zone) uint32 {
+	soa := findRRset(z, api.StringValue(z.Name), "SOA")
+	if soa == nil || len(soa.Records) == 0 {
+		return 0
+	}
+	fields := strings.Fields(api.StringValue(soa.Records[0].Content))
+	if len(fields) != 7 {
+		return 0
+	}
+	serial, _ := strconv.ParseUint(fields[2], 10, 32)
+	return uint32(serial)
+}
+
+func findRRset(z *api.Zone, name, rrType string) *api.RRset {
+	for i, rs := range z.RRsets {
+		if api.StringValue(rs.Name) == name && string(*rs.Type) == rrType {
+			return &z.RRsets[i]
+		}
+	}
+	return nil
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, msg string) {
+	writeJSON(w, status, map[string]string{"error": msg})
+}
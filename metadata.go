@@ -0,0 +1,57 @@
+package powerdns
+
+import (
+	"context"
+
+	"github.com/joeig/go-powerdns/v3"
+)
+
+// GetMetadata returns the values of the metadata kind of the zone, such as
+// ALLOW-AXFR-FROM or SOA-EDIT-API.  Kinds holding a single value return it
+// as a slice of one, and kinds that are not set an empty slice.
+func (p *Provider) GetMetadata(ctx context.Context, zone, kind string) ([]string, error) {
+	zone = p.normalizeZone(zone)
+	c, err := p.readClient(ctx)
+	if err != nil {
+		return nil, err
+	}
+	md, err := c.Metadata.Get(ctx, zone, powerdns.MetadataKind(kind))
+	if err != nil {
+		return nil, p.zoneError(zone, wrapAPIError(err, zone))
+	}
+	values := make([]string, 0)
+	if md != nil {
+		values = append(values, md.Metadata...)
+	}
+	return values, nil
+}
+
+// SetMetadata replaces the values of the metadata kind of the zone.  Kinds
+// that take a single value must be given exactly one.  The server rejects
+// kinds it doesn't allow to be changed through the API with an error
+// wrapping ErrValidation.
+func (p *Provider) SetMetadata(ctx context.Context, zone, kind string, values []string) error {
+	zone = p.normalizeZone(zone)
+	c, err := p.client(ctx)
+	if err != nil {
+		return err
+	}
+	// metadata like API-RECTIFY changes how the zone is treated
+	defer p.InvalidateZoneCache(zone)
+	if values == nil {
+		values = []string{}
+	}
+	_, err = c.Metadata.Set(ctx, zone, powerdns.MetadataKind(kind), values)
+	return p.zoneError(zone, wrapAPIError(err, zone))
+}
+
+// DeleteMetadata removes all values of the metadata kind of the zone.
+func (p *Provider) DeleteMetadata(ctx context.Context, zone, kind string) error {
+	zone = p.normalizeZone(zone)
+	c, err := p.client(ctx)
+	if err != nil {
+		return err
+	}
+	defer p.InvalidateZoneCache(zone)
+	return p.zoneError(zone, wrapAPIError(c.Metadata.Delete(ctx, zone, powerdns.MetadataKind(kind)), zone))
+}
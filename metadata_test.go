@@ -0,0 +1,69 @@
+package powerdns
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestMetadata(t *testing.T) {
+	ctx := context.Background()
+	f := newFakePDNS(t)
+	f.AddZone("example.org.")
+	f.Metadata["example.org."] = map[string][]string{
+		"SOA-EDIT-API":    {"DEFAULT"},
+		"ALLOW-AXFR-FROM": {"192.0.2.0/24", "2001:db8::/32"},
+	}
+	p := f.provider()
+
+	for kind, want := range map[string][]string{
+		"SOA-EDIT-API":    {"DEFAULT"},
+		"ALLOW-AXFR-FROM": {"192.0.2.0/24", "2001:db8::/32"},
+		"PUBLISH-CDS":     {},
+	} {
+		got, err := p.GetMetadata(ctx, "example.org.", kind)
+		if err != nil {
+			t.Fatalf("GetMetadata(%s): %s", kind, err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: have %q want %q", kind, got, want)
+		}
+	}
+
+	if err := p.SetMetadata(ctx, "example.org.", "PUBLISH-CDS", []string{"2", "4"}); err != nil {
+		t.Fatalf("SetMetadata: %s", err)
+	}
+	if got := f.Metadata["example.org."]["PUBLISH-CDS"]; !reflect.DeepEqual(got, []string{"2", "4"}) {
+		t.Errorf("stored %q", got)
+	}
+	if err := p.SetMetadata(ctx, "example.org.", "SOA-EDIT-API", []string{"INCREASE"}); err != nil {
+		t.Fatalf("SetMetadata: %s", err)
+	}
+	if got, _ := p.GetMetadata(ctx, "example.org.", "SOA-EDIT-API"); !reflect.DeepEqual(got, []string{"INCREASE"}) {
+		t.Errorf("SOA-EDIT-API is %q after setting it", got)
+	}
+
+	if err := p.DeleteMetadata(ctx, "example.org.", "ALLOW-AXFR-FROM"); err != nil {
+		t.Fatalf("DeleteMetadata: %s", err)
+	}
+	if _, ok := f.Metadata["example.org."]["ALLOW-AXFR-FROM"]; ok {
+		t.Error("ALLOW-AXFR-FROM is still set")
+	}
+	if n := f.CallCount(http.MethodDelete, "/zones/example.org./metadata/ALLOW-AXFR-FROM"); n != 1 {
+		t.Errorf("expected one DELETE of the metadata, got %d", n)
+	}
+
+	// the zone is addressed by name, without fetching it for an ID
+	for _, c := range f.Calls {
+		if !strings.Contains(c, "/zones/example.org./metadata") {
+			t.Errorf("unexpected request %s", c)
+		}
+	}
+
+	if _, err := p.GetMetadata(ctx, "missing.org.", "SOA-EDIT-API"); !errors.Is(err, ErrZoneNotFound) {
+		t.Errorf("expected ErrZoneNotFound, got %v", err)
+	}
+}
@@ -0,0 +1,26 @@
+package powerdns
+
+import "time"
+
+// Metrics receives a measurement for every call of GetRecords,
+// AppendRecords, SetRecords, DeleteRecords, ReplaceZoneRecords and
+// ReplaceZone, to be turned into counters and latency histograms, e.g.
+// with a Prometheus client.  op is "get", "append", "set", "delete" or
+// "replace", and err what the call returned.
+// Implementations must be safe for concurrent use.
+type Metrics interface {
+	ObserveOp(op string, dur time.Duration, err error)
+}
+
+type noopMetrics struct{}
+
+func (noopMetrics) ObserveOp(string, time.Duration, error) {}
+
+// observe reports a finished operation to p.Metrics
+func (p *Provider) observe(op string, start time.Time, err error) {
+	m := p.Metrics
+	if m == nil {
+		m = noopMetrics{}
+	}
+	m.ObserveOp(op, time.Since(start), err)
+}
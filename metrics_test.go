@@ -0,0 +1,64 @@
+package powerdns
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/libdns/libdns"
+)
+
+type fakeMetrics struct {
+	mu  sync.Mutex
+	ops []string
+}
+
+func (m *fakeMetrics) ObserveOp(op string, dur time.Duration, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	outcome := "ok"
+	if err != nil {
+		outcome = "error"
+	}
+	m.ops = append(m.ops, op+" "+outcome)
+}
+
+func TestMetrics(t *testing.T) {
+	ctx := context.Background()
+	f := newFakePDNS(t)
+	f.AddZone("example.org.")
+	m := &fakeMetrics{}
+	p := f.provider()
+	p.Metrics = m
+	txt := []libdns.Record{libdns.TXT{Name: "www", Text: "hello"}}
+
+	if _, err := p.AppendRecords(ctx, "example.org.", txt); err != nil {
+		t.Fatalf("AppendRecords: %s", err)
+	}
+	if _, err := p.SetRecords(ctx, "example.org.", txt); err != nil {
+		t.Fatalf("SetRecords: %s", err)
+	}
+	if _, err := p.GetRecords(ctx, "example.org."); err != nil {
+		t.Fatalf("GetRecords: %s", err)
+	}
+	if _, err := p.DeleteRecords(ctx, "example.org.", txt); err != nil {
+		t.Fatalf("DeleteRecords: %s", err)
+	}
+	if _, err := p.GetRecords(ctx, "missing.org."); !errors.Is(err, ErrZoneNotFound) {
+		t.Fatalf("expected ErrZoneNotFound, got %v", err)
+	}
+
+	want := []string{"append ok", "set ok", "get ok", "delete ok", "get error"}
+	if !reflect.DeepEqual(m.ops, want) {
+		t.Errorf("have %q want %q", m.ops, want)
+	}
+
+	// without Metrics nothing breaks
+	p.Metrics = nil
+	if _, err := p.GetRecords(ctx, "example.org."); err != nil {
+		t.Errorf("GetRecords without Metrics: %s", err)
+	}
+}
@@ -0,0 +1,191 @@
+package powerdns
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/libdns/libdns"
+)
+
+// NAPTR is a naming authority pointer record (RFC 3403), as used for ENUM
+// and SIP, which libdns has no struct for.  GetRecords returns NAPTR
+// records as this type, and it can be written like any other record.
+type NAPTR struct {
+	Name string
+	TTL  time.Duration
+
+	// Order and Preference say in which order the records are tried:
+	// lower orders first, and within an order lower preferences first.
+	Order      uint16
+	Preference uint16
+
+	// Flags, Service and Regexp are the character strings of the record,
+	// without the quoting and escapes of zone files, e.g. "U", "E2U+sip"
+	// and "!^.*$!sip:info@example.org!".  They are quoted when written.
+	Flags   string
+	Service string
+	Regexp  string
+
+	// Replacement is the domain name to look up next, or "." if Regexp is
+	// used instead.  A relative name is taken to be in the zone.
+	Replacement string
+}
+
+// RR returns the record in the form PowerDNS stores it.
+func (n NAPTR) RR() libdns.RR {
+	replacement := n.Replacement
+	if replacement == "" {
+		replacement = "."
+	}
+	return libdns.RR{
+		Name: n.Name,
+		TTL:  n.TTL,
+		Type: "NAPTR",
+		Data: fmt.Sprintf("%d %d %s %s %s %s", n.Order, n.Preference,
+			quoteCharString(n.Flags), quoteCharString(n.Service), quoteCharString(n.Regexp), replacement),
+	}
+}
+
+// parseNAPTR turns NAPTR data in zone file form into a NAPTR
+func parseNAPTR(rr libdns.RR) (libdns.Record, error) {
+	fields, err := charStringFields(rr.Data)
+	if err != nil || len(fields) != 6 {
+		return nil, fmt.Errorf(`malformed NAPTR value %q; expected 'order preference "flags" "service" "regexp" replacement'`, rr.Data)
+	}
+	var nums [2]uint16
+	for i, name := range []string{"order", "preference"} {
+		n, err := strconv.ParseUint(fields[i], 10, 16)
+		if err != nil {
+			return nil, fmt.Errorf("invalid NAPTR %s %s: %v", name, fields[i], err)
+		}
+		nums[i] = uint16(n)
+	}
+	var strs [3]string
+	for i, name := range []string{"flags", "service", "regexp"} {
+		s, err := unquoteCharString(fields[2+i])
+		if err != nil {
+			return nil, fmt.Errorf("invalid NAPTR %s %s: %v", name, fields[2+i], err)
+		}
+		strs[i] = s
+	}
+	return NAPTR{
+		Name:        rr.Name,
+		TTL:         rr.TTL,
+		Order:       nums[0],
+		Preference:  nums[1],
+		Flags:       strs[0],
+		Service:     strs[1],
+		Regexp:      strs[2],
+		Replacement: fields[5],
+	}, nil
+}
+
+// charStringFields splits zone file data into its fields, keeping quoted
+// character strings, which may contain spaces, in one piece with their
+// quotes and escapes
+func charStringFields(data string) ([]string, error) {
+	var fields []string
+	for i := 0; i < len(data); {
+		switch data[i] {
+		case ' ', '\t':
+			i++
+			continue
+		}
+		j := i
+		if data[i] == '"' {
+			for j++; j < len(data) && data[j] != '"'; j++ {
+				if data[j] == '\\' {
+					j++
+				}
+			}
+			if j >= len(data) {
+				return nil, errors.New("unterminated quoted string")
+			}
+			j++
+		} else {
+			for ; j < len(data) && data[j] != ' ' && data[j] != '\t'; j++ {
+				switch data[j] {
+				case '\\':
+					j++
+				case '"':
+					return nil, errors.New("quote inside an unquoted string")
+				}
+			}
+			j = min(j, len(data))
+		}
+		fields = append(fields, data[i:j])
+		i = j
+	}
+	return fields, nil
+}
+
+// qualifyNAPTR makes the replacement of NAPTR data fully qualified, taking
+// relative names to be in the zone, and writes the strings with the
+// quoting PowerDNS stores.  Data that doesn't parse is left for the server
+// to reject.
+func qualifyNAPTR(data, zone string) string {
+	rec, err := parseNAPTR(libdns.RR{Data: data})
+	if err != nil {
+		return data
+	}
+	n := rec.(NAPTR)
+	if n.Replacement != "." {
+		n.Replacement = libdns.AbsoluteName(n.Replacement, zone)
+		if !strings.HasSuffix(n.Replacement, ".") {
+			n.Replacement += "."
+		}
+	}
+	return n.RR().Data
+}
+
+func validateNAPTR(n NAPTR) []error {
+	var errs []error
+	for _, ch := range n.Flags {
+		if (ch < 'a' || ch > 'z') && (ch < 'A' || ch > 'Z') && (ch < '0' || ch > '9') {
+			errs = append(errs, fmt.Errorf("invalid NAPTR flags %q, expected letters and digits", n.Flags))
+			break
+		}
+	}
+	hasReplacement := n.Replacement != "" && n.Replacement != "."
+	switch {
+	case n.Regexp != "" && hasReplacement:
+		errs = append(errs, errors.New("a NAPTR record has either a regexp or a replacement, not both"))
+	case n.Regexp == "" && !hasReplacement:
+		errs = append(errs, errors.New("a NAPTR record needs a regexp or a replacement"))
+	case n.Regexp != "":
+		if err := validateNAPTRRegexp(n.Regexp); err != nil {
+			errs = append(errs, err)
+		}
+	default:
+		if err := validateTarget("NAPTR replacement", n.Replacement); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errs
+}
+
+// validateNAPTRRegexp checks the shape of a substitution expression, which
+// RFC 3402 defines as delim-char ere delim-char repl delim-char *flags.
+// The regular expression itself is left to the applications using it.
+func validateNAPTRRegexp(re string) error {
+	delim := re[0]
+	if delim == '\\' || delim == 'i' || (delim >= '1' && delim <= '9') {
+		return fmt.Errorf("invalid NAPTR regexp %q: bad delimiter %q", re, delim)
+	}
+	parts := 1
+	for i := 1; i < len(re); i++ {
+		switch re[i] {
+		case '\\':
+			i++
+		case delim:
+			parts++
+		}
+	}
+	if parts != 3 || strings.Trim(re[strings.LastIndexByte(re, delim)+1:], "i") != "" {
+		return fmt.Errorf("invalid NAPTR regexp %q, expected %cregexp%creplacement%c", re, delim, delim, delim)
+	}
+	return nil
+}
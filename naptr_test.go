@@ -0,0 +1,96 @@
+package powerdns
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/libdns/libdns"
+)
+
+func TestNAPTRRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	f := newFakePDNS(t)
+	f.AddZone("4.4.e164.arpa.")
+	p := f.provider()
+
+	enum := NAPTR{
+		Name:        "3.8.0.0.6.9.2.3.6.1",
+		TTL:         time.Hour,
+		Order:       100,
+		Preference:  10,
+		Flags:       "u",
+		Service:     "E2U+sip",
+		Regexp:      `!^\+441632960083$!sip:info@example.org!`,
+		Replacement: ".",
+	}
+	next := NAPTR{
+		Name:        "3.8.0.0.6.9.2.3.6.1",
+		TTL:         time.Hour,
+		Order:       200,
+		Preference:  10,
+		Flags:       "s",
+		Service:     "SIP+D2U",
+		Replacement: "_sip._udp",
+	}
+	if _, err := p.AppendRecords(ctx, "4.4.e164.arpa.", []libdns.Record{enum, next}); err != nil {
+		t.Fatalf("AppendRecords: %s", err)
+	}
+	want := []string{
+		`100 10 "u" "E2U+sip" "!^\\+441632960083$!sip:info@example.org!" .`,
+		`200 10 "s" "SIP+D2U" "" _sip._udp.4.4.e164.arpa.`,
+	}
+	if got := rrsetContents(f.RRset("4.4.e164.arpa.", "3.8.0.0.6.9.2.3.6.1.4.4.e164.arpa.", "NAPTR")); !reflect.DeepEqual(got, want) {
+		t.Errorf("stored NAPTR contents:\nhave %q\nwant %q", got, want)
+	}
+
+	out, err := p.GetRecords(ctx, "4.4.e164.arpa.")
+	if err != nil {
+		t.Fatalf("GetRecords: %s", err)
+	}
+	next.Replacement = "_sip._udp.4.4.e164.arpa."
+	if !reflect.DeepEqual(out, []libdns.Record{enum, next}) {
+		t.Errorf("round trip:\nhave %#v\nwant %#v", out, []libdns.Record{enum, next})
+	}
+
+	// the same value as a plain RR with unquoted flags is already there
+	added, err := p.AppendRecords(ctx, "4.4.e164.arpa.", []libdns.Record{
+		libdns.RR{Name: enum.Name, TTL: time.Hour, Type: "NAPTR", Data: `100  10 u E2U+sip "!^\\+441632960083$!sip:info@example.org!" .`},
+	})
+	if err != nil || len(added) != 0 {
+		t.Errorf("appending the same value as a plain RR added %v, %v", added, err)
+	}
+}
+
+func TestValidateNAPTR(t *testing.T) {
+	valid := []libdns.Record{
+		NAPTR{Name: "1.2", Order: 100, Preference: 10, Flags: "U", Service: "E2U+sip", Regexp: "!^.*$!sip:\\1@example.org!", Replacement: "."},
+		NAPTR{Name: "1.2", Order: 100, Preference: 10, Flags: "u", Service: "E2U+web:http", Regexp: "/^(.*)$/http:\\/\\/example.org\\/\\1/i"},
+		NAPTR{Name: "@", Order: 10, Preference: 0, Flags: "S", Service: "SIP+D2T", Replacement: "_sip._tcp.example.org."},
+		libdns.RR{Name: "@", Type: "NAPTR", Data: `10 0 "s" "SIP+D2U" "" _sip._udp.example.org.`},
+	}
+	if errs := ValidateRecords(valid); errs != nil {
+		t.Errorf("valid records reported as invalid: %v", errs)
+	}
+
+	for _, tc := range []struct {
+		rec  libdns.Record
+		want string
+	}{
+		{NAPTR{Name: "@", Flags: "s", Regexp: "!^.*$!sip:x@example.org!", Replacement: "_sip._udp"}, "not both"},
+		{NAPTR{Name: "@", Flags: "s", Replacement: "."}, "needs a regexp or a replacement"},
+		{NAPTR{Name: "@", Flags: "u+", Regexp: "!^.*$!sip:x@example.org!"}, "invalid NAPTR flags"},
+		{NAPTR{Name: "@", Flags: "u", Regexp: "!^.*$!sip:x@example.org"}, "invalid NAPTR regexp"},
+		{NAPTR{Name: "@", Flags: "u", Regexp: "1^.*$1sip:x@example.org1"}, "bad delimiter"},
+		{libdns.RR{Name: "@", Type: "NAPTR", Data: `10 0 "s" "SIP+D2U" _sip._udp.example.org.`}, "malformed NAPTR value"},
+		{libdns.RR{Name: "@", Type: "NAPTR", Data: `10 0 "s "SIP+D2U" "" .`}, "malformed NAPTR value"},
+		{libdns.RR{Name: "@", Type: "NAPTR", Data: `70000 0 "s" "SIP+D2U" "" _sip._udp.example.org.`}, "invalid NAPTR order"},
+	} {
+		errs := ValidateRecords([]libdns.Record{tc.rec})
+		if len(errs) == 0 || !strings.Contains(errs[0].Error(), tc.want) {
+			t.Errorf("%#v: expected an error about %q, got %v", tc.rec, tc.want, errs)
+		}
+	}
+}
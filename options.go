@@ -0,0 +1,159 @@
+package powerdns
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+	"time"
+)
+
+// Option configures a Provider built by NewProvider.
+type Option func(*Provider) error
+
+// NewProvider returns a Provider for the server at serverURL, checking the
+// configuration up front instead of on the first request.  A Provider
+// built as a struct literal keeps working as well; NewProvider is just a
+// validating way to set one up.
+func NewProvider(serverURL, apiToken string, opts ...Option) (*Provider, error) {
+	serverURL, err := normalizeServerURL("server URL", serverURL)
+	if err != nil {
+		return nil, err
+	}
+	if apiToken == "" {
+		return nil, errors.New("an API token is required")
+	}
+	p := &Provider{
+		ServerURL: serverURL,
+		APIToken:  apiToken,
+	}
+	for _, opt := range opts {
+		if err := opt(p); err != nil {
+			return nil, err
+		}
+	}
+	return p, nil
+}
+
+// ProviderFromEnv returns a Provider configured from the environment:
+// POWERDNS_SERVER_URL and POWERDNS_API_TOKEN are required, and
+// POWERDNS_SERVER_ID and POWERDNS_DEBUG set ServerID and Debug if present.
+func ProviderFromEnv() (*Provider, error) {
+	var missing []string
+	get := func(name string, required bool) string {
+		v := strings.TrimSpace(os.Getenv(name))
+		if v == "" && required {
+			missing = append(missing, name)
+		}
+		return v
+	}
+	serverURL := get("POWERDNS_SERVER_URL", true)
+	apiToken := get("POWERDNS_API_TOKEN", true)
+	serverID := get("POWERDNS_SERVER_ID", false)
+	debug := get("POWERDNS_DEBUG", false)
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("missing environment variables: %s", strings.Join(missing, ", "))
+	}
+	var opts []Option
+	if serverID != "" {
+		opts = append(opts, WithServerID(serverID))
+	}
+	p, err := NewProvider(serverURL, apiToken, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("from the environment: %w", err)
+	}
+	p.Debug = debug
+	return p, nil
+}
+
+// normalizeServerURL checks that raw is the base URL of a PowerDNS server,
+// as ServerURL and ReadURL expect, and returns it without trailing
+// slashes, so that "http://127.0.0.1:8081/" and "http://127.0.0.1:8081"
+// are the same.  A path is kept for servers behind a reverse proxy, but an
+// /api/v1 suffix, which the API client adds itself, is dropped.  field
+// names the setting in errors.
+func normalizeServerURL(field, raw string) (string, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return "", fmt.Errorf("%s is required", field)
+	}
+	if !strings.Contains(raw, "://") {
+		return "", fmt.Errorf("invalid %s %q: missing the http:// or https:// scheme", field, raw)
+	}
+	u, err := url.Parse(raw)
+	if err != nil {
+		return "", fmt.Errorf("invalid %s: %w", field, err)
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return "", fmt.Errorf("invalid %s %q: expected http(s)://host[:port]", field, raw)
+	}
+	if u.RawQuery != "" || u.Fragment != "" {
+		return "", fmt.Errorf("invalid %s %q: must not have a query or fragment", field, raw)
+	}
+	p := path.Clean("/" + u.Path)
+	p = strings.TrimSuffix(strings.TrimSuffix(p, "/api/v1"), "/api")
+	if strings.Contains(p+"/", "/api/v1/") {
+		return "", fmt.Errorf("invalid %s %q: expected the base URL of the server, without /api/v1/...", field, raw)
+	}
+	u.Path = strings.TrimSuffix(p, "/")
+	u.RawPath = ""
+	return u.String(), nil
+}
+
+// WithServerID sets the id of the server, localhost by default.
+func WithServerID(id string) Option {
+	return func(p *Provider) error {
+		if id == "" {
+			return errors.New("server id must not be empty")
+		}
+		p.ServerID = id
+		return nil
+	}
+}
+
+// WithTimeout limits how long a single request to the server may take.
+func WithTimeout(timeout time.Duration) Option {
+	return func(p *Provider) error {
+		if timeout <= 0 {
+			return fmt.Errorf("invalid timeout %s", timeout)
+		}
+		p.timeout = timeout
+		return nil
+	}
+}
+
+// WithUserAgent sends ua as the User-Agent header of every request.
+func WithUserAgent(ua string) Option {
+	return func(p *Provider) error {
+		if ua == "" {
+			return errors.New("user agent must not be empty")
+		}
+		p.UserAgent = ua
+		return nil
+	}
+}
+
+// WithHTTPClient makes the provider send its requests through c, e.g. to
+// use custom TLS settings or a proxy.
+func WithHTTPClient(c *http.Client) Option {
+	return func(p *Provider) error {
+		if c == nil {
+			return errors.New("http client must not be nil")
+		}
+		p.httpClient = c
+		return nil
+	}
+}
+
+// WithDebugWriter dumps every request and response to w, like the Debug
+// field does for stdout and stderr.  The dumps contain the API token.
+func WithDebugWriter(w io.Writer) Option {
+	return func(p *Provider) error {
+		p.debugWriter = w
+		return nil
+	}
+}
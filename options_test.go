@@ -0,0 +1,165 @@
+package powerdns
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNewProvider(t *testing.T) {
+	f := newFakePDNS(t)
+	f.AddZone("example.org.", rrset("www.example.org.", "A", 60, "127.0.0.1"))
+
+	var debug bytes.Buffer
+	p, err := NewProvider(f.URL, "secret",
+		WithServerID("localhost"),
+		WithTimeout(5*time.Second),
+		WithHTTPClient(&http.Client{}),
+		WithDebugWriter(&debug),
+	)
+	if err != nil {
+		t.Fatalf("NewProvider: %s", err)
+	}
+	recs, err := p.GetRecords(context.Background(), "example.org.")
+	if err != nil || len(recs) != 1 {
+		t.Fatalf("GetRecords: %v, %v", recs, err)
+	}
+	if !strings.Contains(debug.String(), "GET /api/v1/servers/localhost/zones/example.org.") {
+		t.Errorf("request was not written to the debug writer")
+	}
+
+	for name, tc := range map[string]struct {
+		url, token string
+		opts       []Option
+	}{
+		"unparsable url": {url: "http://[::1", token: "secret"},
+		"missing scheme": {url: "localhost:8081", token: "secret"},
+		"missing token":  {url: "http://localhost:8081"},
+		"empty serverid": {url: "http://localhost:8081", token: "secret", opts: []Option{WithServerID("")}},
+		"bad timeout":    {url: "http://localhost:8081", token: "secret", opts: []Option{WithTimeout(0)}},
+		"empty agent":    {url: "http://localhost:8081", token: "secret", opts: []Option{WithUserAgent("")}},
+	} {
+		if _, err := NewProvider(tc.url, tc.token, tc.opts...); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestProviderFromEnv(t *testing.T) {
+	t.Setenv("POWERDNS_SERVER_URL", "http://127.0.0.1:8081/")
+	t.Setenv("POWERDNS_SERVER_ID", "pdns1")
+	t.Setenv("POWERDNS_API_TOKEN", "secret")
+	t.Setenv("POWERDNS_DEBUG", "stderr")
+	p, err := ProviderFromEnv()
+	if err != nil {
+		t.Fatalf("ProviderFromEnv: %s", err)
+	}
+	want := &Provider{ServerURL: "http://127.0.0.1:8081", ServerID: "pdns1", APIToken: "secret", Debug: "stderr"}
+	if !reflect.DeepEqual(p, want) {
+		t.Errorf("ProviderFromEnv = %+v, want %+v", p, want)
+	}
+
+	t.Setenv("POWERDNS_SERVER_URL", "")
+	t.Setenv("POWERDNS_API_TOKEN", "")
+	_, err = ProviderFromEnv()
+	if err == nil || err.Error() != "missing environment variables: POWERDNS_SERVER_URL, POWERDNS_API_TOKEN" {
+		t.Errorf("expected the missing variables to be listed, got %v", err)
+	}
+
+	t.Setenv("POWERDNS_SERVER_URL", "localhost:8081")
+	t.Setenv("POWERDNS_API_TOKEN", "secret")
+	if _, err := ProviderFromEnv(); err == nil {
+		t.Errorf("expected an error for an invalid server URL")
+	}
+}
+
+func TestNormalizeServerURL(t *testing.T) {
+	for in, want := range map[string]string{
+		"http://127.0.0.1:8081":             "http://127.0.0.1:8081",
+		"http://127.0.0.1:8081/":            "http://127.0.0.1:8081",
+		"http://127.0.0.1:8081//":           "http://127.0.0.1:8081",
+		" https://pdns.example.org ":        "https://pdns.example.org",
+		"http://127.0.0.1:8081/api/v1":      "http://127.0.0.1:8081",
+		"http://127.0.0.1:8081/api/v1/":     "http://127.0.0.1:8081",
+		"https://proxy.example.org/pdns/":   "https://proxy.example.org/pdns",
+		"https://proxy.example.org//pdns//": "https://proxy.example.org/pdns",
+	} {
+		got, err := normalizeServerURL("server_url", in)
+		if err != nil || got != want {
+			t.Errorf("normalizeServerURL(%q) = %q, %v, want %q", in, got, err, want)
+		}
+	}
+	for in, want := range map[string]string{
+		"":                      "server_url is required",
+		"127.0.0.1:8081":        "missing the http:// or https:// scheme",
+		"localhost":             "missing the http:// or https:// scheme",
+		"ftp://127.0.0.1":       "expected http(s)://host[:port]",
+		"http://127.0.0.1/?x=1": "must not have a query",
+		"http://127.0.0.1/api/v1/servers/localhost": "without /api/v1/...",
+	} {
+		_, err := normalizeServerURL("server_url", in)
+		if err == nil || !strings.Contains(err.Error(), want) || !strings.Contains(err.Error(), "server_url") {
+			t.Errorf("normalizeServerURL(%q): expected an error about %q naming the field, got %v", in, want, err)
+		}
+	}
+
+	// both spellings reach the same server
+	f := newFakePDNS(t)
+	f.AddZone("example.org.")
+	for _, u := range []string{f.URL, f.URL + "/", f.URL + "/api/v1"} {
+		p := &Provider{ServerURL: u, APIToken: "secret"}
+		if _, err := p.GetRecords(context.Background(), "example.org."); err != nil {
+			t.Errorf("GetRecords with server_url %q: %s", u, err)
+		}
+	}
+	p := &Provider{ServerURL: "localhost:8081", APIToken: "secret"}
+	if _, err := p.GetRecords(context.Background(), "example.org."); err == nil || !strings.Contains(err.Error(), "server_url") {
+		t.Errorf("expected an error naming server_url, got %v", err)
+	}
+}
+
+func TestUserAgent(t *testing.T) {
+	var agents []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		agents = append(agents, r.Header.Get("User-Agent"))
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte("[]"))
+	}))
+	defer srv.Close()
+	ctx := context.Background()
+
+	p, err := NewProvider(srv.URL, "secret", WithUserAgent("my-controller/1.2.3 libdns-powerdns"))
+	if err != nil {
+		t.Fatalf("NewProvider: %s", err)
+	}
+	if _, err := p.ListZones(ctx); err != nil {
+		t.Fatalf("ListZones: %s", err)
+	}
+	// and so do the requests the client library does not cover
+	c, err := p.client(ctx)
+	if err != nil {
+		t.Fatalf("client: %s", err)
+	}
+	resp, err := c.doRaw(ctx, http.MethodGet, "zones", nil, nil)
+	if err != nil {
+		t.Fatalf("doRaw: %s", err)
+	}
+	resp.Body.Close()
+	if want := []string{"my-controller/1.2.3 libdns-powerdns", "my-controller/1.2.3 libdns-powerdns"}; !reflect.DeepEqual(agents, want) {
+		t.Errorf("User-Agent = %q, want %q", agents, want)
+	}
+
+	agents = nil
+	p = &Provider{ServerURL: srv.URL, APIToken: "secret"}
+	if _, err := p.ListZones(ctx); err != nil {
+		t.Fatalf("ListZones: %s", err)
+	}
+	if want := []string{"go-powerdns"}; !reflect.DeepEqual(agents, want) {
+		t.Errorf("default User-Agent = %q, want %q", agents, want)
+	}
+}
@@ -0,0 +1,160 @@
+// Package pdnstest provides an in-memory stand-in for the PowerDNS HTTP
+// API, so code using the powerdns provider can be tested without a real
+// server.
+//
+// The fake speaks the same API the provider does, so a Provider pointed at
+// it goes through its usual request path, and appends, sets and deletes
+// behave as they do against PowerDNS: rrsets are replaced atomically per
+// PATCH, names are stored in lowercase, the SOA serial increases on every
+// change and out of zone or conflicting rrsets are rejected.  Zones, their
+// records, metadata, DNSSEC and search are implemented; anything else is
+// answered with 404 Not Found.  It is the same fake the provider's own
+// tests run against.
+//
+//	srv := pdnstest.NewServer(t)
+//	srv.AddZone("example.org.")
+//	p := srv.Provider()
+//	// use p, then inspect srv.Contents("example.org.", "www.example.org.", "A")
+package pdnstest
+
+import (
+	"net/http"
+	"testing"
+
+	api "github.com/joeig/go-powerdns/v3"
+	"github.com/libdns/powerdns"
+	"github.com/libdns/powerdns/internal/fakepdns"
+)
+
+// APIToken is the token the fake server accepts.
+const APIToken = "pdnstest-token"
+
+// Version is the PowerDNS version the fake server reports unless
+// SetVersion changes it.
+const Version = "4.9.0"
+
+// Server is a fake PowerDNS server holding its zones in memory.  It is
+// safe for concurrent use.
+type Server struct {
+	// URL is the base URL of the server, for Provider.ServerURL.
+	URL string
+
+	fake *fakepdns.Server
+}
+
+// NewServer starts a fake server without zones.  It is shut down when the
+// test and its subtests are done.
+func NewServer(t testing.TB) *Server {
+	t.Helper()
+	fake := fakepdns.New(t, APIToken)
+	fake.Version = Version
+	return &Server{URL: fake.URL, fake: fake}
+}
+
+// Provider returns a Provider talking to the server.
+func (s *Server) Provider() *powerdns.Provider {
+	return &powerdns.Provider{ServerURL: s.URL, APIToken: APIToken}
+}
+
+// AddZone creates a Native zone with an SOA record, as creating it through
+// the API would.  Adding a zone that exists replaces it.
+func (s *Server) AddZone(zone string) {
+	s.fake.CreateZone(zone)
+}
+
+// Zones returns the names of the zones on the server, sorted.
+func (s *Server) Zones() []string {
+	return s.fake.ZoneNames()
+}
+
+// Contents returns the record contents of an rrset as the server stores
+// them, or nil if the zone or rrset doesn't exist.  zone and name must be
+// fully qualified.
+func (s *Server) Contents(zone, name, rrType string) []string {
+	rs := s.fake.RRset(zone, name, rrType)
+	if rs == nil {
+		return nil
+	}
+	out := make([]string, 0, len(rs.Records))
+	for _, rec := range rs.Records {
+		out = append(out, api.StringValue(rec.Content))
+	}
+	return out
+}
+
+// Serial returns the SOA serial of the zone, or 0 if it doesn't exist.
+func (s *Server) Serial(zone string) uint32 {
+	z := s.fake.Zone(zone)
+	if z == nil {
+		return 0
+	}
+	return api.Uint32Value(z.Serial)
+}
+
+// Metadata returns the values of a metadata kind of the zone.
+func (s *Server) Metadata(zone, kind string) []string {
+	s.fake.Lock()
+	defer s.fake.Unlock()
+	return append([]string(nil), s.fake.Metadata[fakepdns.Canonical(zone)][kind]...)
+}
+
+// SetMetadata sets a metadata kind of the zone, or removes it if no values
+// are given.
+func (s *Server) SetMetadata(zone, kind string, values ...string) {
+	s.fake.Lock()
+	defer s.fake.Unlock()
+	zone = fakepdns.Canonical(zone)
+	md := s.fake.Metadata[zone]
+	if md == nil {
+		md = make(map[string][]string)
+		s.fake.Metadata[zone] = md
+	}
+	if len(values) == 0 {
+		delete(md, kind)
+		return
+	}
+	md[kind] = values
+}
+
+// Calls returns the method and path of every request the server got, in
+// order, like "PATCH /api/v1/servers/localhost/zones/example.org.".
+func (s *Server) Calls() []string {
+	s.fake.Lock()
+	defer s.fake.Unlock()
+	return append([]string(nil), s.fake.Calls...)
+}
+
+// SetVersion changes the PowerDNS version the server reports, e.g. to test
+// how code handles servers missing a feature.
+func (s *Server) SetVersion(version string) {
+	s.fake.Lock()
+	defer s.fake.Unlock()
+	s.fake.Version = version
+}
+
+// OnZoneGet sets a function called with the stored zone before a GET of it
+// is answered, e.g. to change it the way another client would.  It runs
+// with the server locked, so it must not call the methods of s except
+// BumpSerial.  A nil fn removes the hook.
+func (s *Server) OnZoneGet(fn func(z *api.Zone)) {
+	s.fake.Lock()
+	defer s.fake.Unlock()
+	s.fake.OnZoneGet = fn
+}
+
+// BumpSerial increases the SOA serial of z as an edit would.  It is meant
+// for OnZoneGet, to make a zone look changed by someone else.
+func (s *Server) BumpSerial(z *api.Zone) {
+	s.fake.BumpSerial(z)
+}
+
+// Intercept sets a function called with every request before the server
+// handles it.  If it returns true it has answered the request itself, so
+// it can inject errors like a 503 from a reloading server.  It runs with
+// the server locked, so it must not call the methods of s.  A nil fn
+// removes the hook.
+func (s *Server) Intercept(fn func(w http.ResponseWriter, r *http.Request) bool) {
+	s.fake.Lock()
+	defer s.fake.Unlock()
+	s.fake.Intercept = fn
+}
@@ -0,0 +1,186 @@
+package pdnstest
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/netip"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/libdns/libdns"
+	"github.com/libdns/powerdns"
+)
+
+func TestAppendSetDelete(t *testing.T) {
+	ctx := context.Background()
+	srv := NewServer(t)
+	srv.AddZone("example.org.")
+	p := srv.Provider()
+
+	addr := func(name, ip string) libdns.Record {
+		return libdns.Address{Name: name, IP: netip.MustParseAddr(ip), TTL: time.Minute}
+	}
+	added, err := p.AppendRecords(ctx, "example.org.", []libdns.Record{
+		addr("1", "127.0.0.1"), addr("1", "127.0.0.2"), addr("2", "127.0.0.4"),
+	})
+	if err != nil || len(added) != 3 {
+		t.Fatalf("AppendRecords = %v, %v", added, err)
+	}
+	// appending a value that is there already adds nothing
+	added, err = p.AppendRecords(ctx, "example.org.", []libdns.Record{addr("1", "127.0.0.1"), addr("2", "127.0.0.5")})
+	if err != nil || !reflect.DeepEqual(added, []libdns.Record{addr("2", "127.0.0.5")}) {
+		t.Errorf("AppendRecords of an existing value = %v, %v", added, err)
+	}
+	if got := srv.Contents("example.org.", "2.example.org.", "A"); !reflect.DeepEqual(got, []string{"127.0.0.4", "127.0.0.5"}) {
+		t.Errorf("after append 2.example.org. A = %q", got)
+	}
+
+	// set replaces the rrsets it names and leaves the others alone
+	if _, err := p.SetRecords(ctx, "example.org.", []libdns.Record{addr("2", "127.0.0.1")}); err != nil {
+		t.Fatalf("SetRecords: %s", err)
+	}
+	if got := srv.Contents("example.org.", "2.example.org.", "A"); !reflect.DeepEqual(got, []string{"127.0.0.1"}) {
+		t.Errorf("after set 2.example.org. A = %q", got)
+	}
+	if got := srv.Contents("example.org.", "1.example.org.", "A"); !reflect.DeepEqual(got, []string{"127.0.0.1", "127.0.0.2"}) {
+		t.Errorf("set touched 1.example.org. A: %q", got)
+	}
+
+	// delete removes single values, or the whole rrset for empty data
+	if _, err := p.DeleteRecords(ctx, "example.org.", []libdns.Record{addr("1", "127.0.0.2"), addr("1", "127.0.0.9")}); err != nil {
+		t.Fatalf("DeleteRecords: %s", err)
+	}
+	if got := srv.Contents("example.org.", "1.example.org.", "A"); !reflect.DeepEqual(got, []string{"127.0.0.1"}) {
+		t.Errorf("after delete 1.example.org. A = %q", got)
+	}
+	if _, err := p.DeleteRecords(ctx, "example.org.", []libdns.Record{libdns.RR{Name: "2", Type: "A"}}); err != nil {
+		t.Fatalf("DeleteRecords of the rrset: %s", err)
+	}
+	if got := srv.Contents("example.org.", "2.example.org.", "A"); got != nil {
+		t.Errorf("2.example.org. A should be gone, have %q", got)
+	}
+
+	recs, err := p.GetRecords(ctx, "example.org.")
+	if err != nil {
+		t.Fatalf("GetRecords: %s", err)
+	}
+	var addrs []libdns.Record
+	for _, r := range recs {
+		if r.RR().Type == "A" {
+			addrs = append(addrs, r)
+		}
+	}
+	if !reflect.DeepEqual(addrs, []libdns.Record{addr("1", "127.0.0.1")}) {
+		t.Errorf("GetRecords A = %v", addrs)
+	}
+	if serial := srv.Serial("example.org."); serial != 6 {
+		t.Errorf("expected the serial to be bumped on each of the 5 changes, have %d", serial)
+	}
+}
+
+func TestServerChecks(t *testing.T) {
+	ctx := context.Background()
+	srv := NewServer(t)
+	srv.AddZone("example.org.")
+	p := srv.Provider()
+
+	_, err := p.AppendRecords(ctx, "missing.org.", []libdns.Record{libdns.TXT{Name: "x", Text: "y"}})
+	if !errors.Is(err, powerdns.ErrZoneNotFound) {
+		t.Errorf("expected ErrZoneNotFound, got %v", err)
+	}
+
+	if _, err := p.AppendRecords(ctx, "example.org.", []libdns.Record{libdns.CNAME{Name: "www", Target: "example.net."}}); err != nil {
+		t.Fatalf("AppendRecords: %s", err)
+	}
+	_, err = p.AppendRecords(ctx, "example.org.", []libdns.Record{libdns.TXT{Name: "www", Text: "next to a CNAME"}})
+	if !errors.Is(err, powerdns.ErrValidation) {
+		t.Errorf("a record next to a CNAME should be rejected, got %v", err)
+	}
+	if got := srv.Contents("example.org.", "www.example.org.", "TXT"); got != nil {
+		t.Errorf("the rejected change was stored: %q", got)
+	}
+
+	bad := &powerdns.Provider{ServerURL: srv.URL, APIToken: "wrong"}
+	if _, err := bad.GetRecords(ctx, "example.org."); !errors.Is(err, powerdns.ErrUnauthorized) {
+		t.Errorf("expected ErrUnauthorized, got %v", err)
+	}
+}
+
+func TestZones(t *testing.T) {
+	ctx := context.Background()
+	srv := NewServer(t)
+	p := srv.Provider()
+
+	if err := p.CreateZone(ctx, "Example.ORG", powerdns.CreateZoneOptions{Nameservers: []string{"ns1.example.net."}}); err != nil {
+		t.Fatalf("CreateZone: %s", err)
+	}
+	if err := p.CreateZone(ctx, "example.org.", powerdns.CreateZoneOptions{}); !errors.Is(err, powerdns.ErrZoneExists) {
+		t.Errorf("expected ErrZoneExists, got %v", err)
+	}
+	if got := srv.Contents("example.org.", "example.org.", "NS"); !reflect.DeepEqual(got, []string{"ns1.example.net."}) {
+		t.Errorf("apex NS = %q", got)
+	}
+	zones, err := p.ListZones(ctx)
+	if err != nil || !reflect.DeepEqual(zones, []libdns.Zone{{Name: "example.org."}}) {
+		t.Errorf("ListZones = %v, %v", zones, err)
+	}
+	if err := p.DeleteZone(ctx, "example.org."); err != nil {
+		t.Fatalf("DeleteZone: %s", err)
+	}
+	if got := srv.Zones(); len(got) != 0 {
+		t.Errorf("zones left after delete: %q", got)
+	}
+}
+
+func TestHooks(t *testing.T) {
+	ctx := context.Background()
+	srv := NewServer(t)
+	srv.AddZone("example.org.")
+
+	srv.SetVersion("4.7.1")
+	info, err := srv.Provider().ServerInfo(ctx)
+	if err != nil || info.Version != "4.7.1" {
+		t.Errorf("ServerInfo = %+v, %v", info, err)
+	}
+
+	p := srv.Provider()
+	srv.SetMetadata("example.org.", "ALLOW-AXFR-FROM", "192.0.2.0/24")
+	if got, err := p.GetMetadata(ctx, "example.org.", "ALLOW-AXFR-FROM"); err != nil || !reflect.DeepEqual(got, []string{"192.0.2.0/24"}) {
+		t.Errorf("GetMetadata = %q, %v", got, err)
+	}
+	if err := p.SetMetadata(ctx, "example.org.", "PUBLISH-CDS", []string{"2"}); err != nil {
+		t.Fatalf("SetMetadata: %s", err)
+	}
+	if got := srv.Metadata("example.org.", "PUBLISH-CDS"); !reflect.DeepEqual(got, []string{"2"}) {
+		t.Errorf("PUBLISH-CDS = %q", got)
+	}
+
+	// another writer changing the zone between the read and the write
+	// is seen as a conflict
+	srv.OnZoneGet(srv.BumpSerial)
+	p.ConflictRetries = 1
+	_, err = p.AppendRecords(ctx, "example.org.", []libdns.Record{libdns.TXT{Name: "www", Text: "x"}})
+	if !errors.Is(err, powerdns.ErrConcurrentModification) {
+		t.Errorf("expected ErrConcurrentModification, got %v", err)
+	}
+	srv.OnZoneGet(nil)
+
+	srv.Intercept(func(w http.ResponseWriter, r *http.Request) bool {
+		if r.Method != http.MethodPatch {
+			return false
+		}
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return true
+	})
+	_, err = srv.Provider().AppendRecords(ctx, "example.org.", []libdns.Record{libdns.TXT{Name: "www", Text: "x"}})
+	if !errors.Is(err, powerdns.ErrServerUnavailable) {
+		t.Errorf("expected ErrServerUnavailable, got %v", err)
+	}
+	calls := srv.Calls()
+	if last := calls[len(calls)-1]; last != "PATCH /api/v1/servers/localhost/zones/example.org." {
+		t.Errorf("last call = %q", last)
+	}
+	srv.Intercept(nil)
+}
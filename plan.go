@@ -0,0 +1,153 @@
+package powerdns
+
+import (
+	"context"
+	"strings"
+
+	"github.com/joeig/go-powerdns/v3"
+	"github.com/libdns/libdns"
+)
+
+// Operation is one of the ways records can be written to a zone.
+type Operation string
+
+const (
+	// OperationAppend adds records, as AppendRecords does.
+	OperationAppend Operation = "append"
+	// OperationSet replaces rrsets, as SetRecords does.
+	OperationSet Operation = "set"
+	// OperationDelete removes records, as DeleteRecords does.
+	OperationDelete Operation = "delete"
+)
+
+// ZoneDiff describes the changes an operation makes to a zone.  It
+// marshals to JSON, e.g. for showing a plan for approval before it is
+// applied.
+type ZoneDiff struct {
+	Zone string `json:"zone"`
+
+	// RRsets are the rrsets that change, in the order of the input
+	// records.  Rrsets the operation leaves as they are aren't listed.
+	RRsets []RRsetDiff `json:"rrsets"`
+}
+
+// Action is what happens to an rrset.
+type Action string
+
+const (
+	// ActionAdd creates an rrset that didn't exist.
+	ActionAdd Action = "add"
+	// ActionRemove deletes the whole rrset.
+	ActionRemove Action = "remove"
+	// ActionReplace changes the values or the TTL of an existing rrset.
+	ActionReplace Action = "replace"
+)
+
+// RRsetDiff is the change of a single rrset, identified by its fully
+// qualified name and type.  Values are in the form PowerDNS stores.  A new
+// rrset has no values before, a deleted one none after.
+type RRsetDiff struct {
+	Name   string `json:"name"`
+	Type   string `json:"type"`
+	Action Action `json:"action"`
+
+	Before []string `json:"before"`
+	After  []string `json:"after"`
+
+	// Added and Removed are the values only in After and only in Before.
+	// Both are empty for a change of the TTL alone.
+	Added   []string `json:"added"`
+	Removed []string `json:"removed"`
+
+	// TTLBefore and TTLAfter are the TTLs in seconds, zero where the
+	// rrset doesn't exist.
+	TTLBefore uint32 `json:"ttl_before,omitempty"`
+	TTLAfter  uint32 `json:"ttl_after,omitempty"`
+}
+
+// Additions returns the rrsets the operation creates.
+func (d ZoneDiff) Additions() []RRsetDiff {
+	return d.withAction(ActionAdd)
+}
+
+// Removals returns the rrsets the operation deletes.
+func (d ZoneDiff) Removals() []RRsetDiff {
+	return d.withAction(ActionRemove)
+}
+
+// Replacements returns the existing rrsets the operation changes.
+func (d ZoneDiff) Replacements() []RRsetDiff {
+	return d.withAction(ActionReplace)
+}
+
+func (d ZoneDiff) withAction(action Action) []RRsetDiff {
+	out := make([]RRsetDiff, 0)
+	for _, rs := range d.RRsets {
+		if rs.Action == action {
+			out = append(out, rs)
+		}
+	}
+	return out
+}
+
+// PlanChanges works out what writing the records to the zone with op would
+// change, without changing anything.  The zone is read from ServerURL, as
+// for the actual write.
+func (p *Provider) PlanChanges(ctx context.Context, zone string, op Operation, records []libdns.Record) (ZoneDiff, error) {
+	zone = p.normalizeZone(zone)
+	pl, err := p.planOnce(ctx, zone, op, records)
+	if err != nil {
+		return ZoneDiff{}, err
+	}
+	return zoneDiff(zone, pl.before, pl.changes), nil
+}
+
+// zoneDiff compares the planned changes with the zone they are made to
+func zoneDiff(zone string, before *powerdns.Zone, changes []rrsetChange) ZoneDiff {
+	diff := ZoneDiff{Zone: canonicalZone(zone), RRsets: make([]RRsetDiff, 0, len(changes))}
+	for _, ch := range changes {
+		existing := findRRset(before, ch.name, ch.rrType)
+		old := rrsetContents(existing)
+		rs := RRsetDiff{
+			Name:    ch.name,
+			Type:    ch.rrType,
+			Action:  ActionReplace,
+			Before:  append([]string{}, old...),
+			After:   append([]string{}, ch.contents...),
+			Added:   missingContents(ch.contents, old),
+			Removed: missingContents(old, ch.contents),
+		}
+		switch {
+		case existing == nil:
+			rs.Action = ActionAdd
+			rs.TTLAfter = ch.ttl
+		case len(ch.contents) == 0:
+			rs.Action = ActionRemove
+			rs.TTLBefore = powerdns.Uint32Value(existing.TTL)
+		default:
+			rs.TTLBefore = powerdns.Uint32Value(existing.TTL)
+			rs.TTLAfter = ch.ttl
+			if len(rs.Added) == 0 && len(rs.Removed) == 0 && rs.TTLBefore == rs.TTLAfter {
+				continue
+			}
+		}
+		diff.RRsets = append(diff.RRsets, rs)
+	}
+	return diff
+}
+
+// missingContents returns the contents of a that are not in b, ignoring
+// trailing dots as the planners do
+func missingContents(a, b []string) []string {
+	in := make(map[string]bool, len(b))
+	for _, c := range b {
+		in[strings.TrimSuffix(c, ".")] = true
+	}
+	out := make([]string, 0)
+	for _, c := range a {
+		if !in[strings.TrimSuffix(c, ".")] {
+			out = append(out, c)
+		}
+	}
+	return out
+}
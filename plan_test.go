@@ -0,0 +1,253 @@
+package powerdns
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/netip"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/libdns/libdns"
+)
+
+func TestDryRun(t *testing.T) {
+	ctx := context.Background()
+	f := newFakePDNS(t)
+	f.AddZone("example.org.",
+		rrset("www.example.org.", "A", 60, "192.0.2.1"),
+		rrset("old.example.org.", "TXT", 60, `"bye"`),
+	)
+	p := f.provider()
+	p.DryRun = true
+	p.AutoCreateZone = true
+
+	www := libdns.Address{Name: "www", IP: netip.MustParseAddr("192.0.2.2"), TTL: time.Minute}
+	added, err := p.AppendRecords(ctx, "example.org.", []libdns.Record{www})
+	if err != nil {
+		t.Fatalf("AppendRecords: %s", err)
+	}
+	if want := []libdns.Record{www}; !reflect.DeepEqual(added, want) {
+		t.Errorf("AppendRecords: have %#v want %#v", added, want)
+	}
+	if _, err := p.SetRecords(ctx, "example.org.", []libdns.Record{www}); err != nil {
+		t.Fatalf("SetRecords: %s", err)
+	}
+	results, err := p.DeleteRecordsWithResults(ctx, "example.org.", []libdns.Record{
+		libdns.TXT{Name: "old", Text: "bye"},
+		libdns.TXT{Name: "old", Text: "never there"},
+	})
+	if err != nil {
+		t.Fatalf("DeleteRecordsWithResults: %s", err)
+	}
+	if !results[0].Applied || results[1].Applied {
+		t.Errorf("unexpected results %#v", results)
+	}
+	if _, err := p.AppendRecords(ctx, "new.org.", []libdns.Record{www}); err != nil {
+		t.Fatalf("AppendRecords to a missing zone: %s", err)
+	}
+
+	if n := f.CallCount(http.MethodPatch, ""); n != 0 {
+		t.Errorf("%d PATCH requests in a dry run", n)
+	}
+	if n := f.CallCount(http.MethodPost, "/zones"); n != 0 || f.Zone("new.org.") != nil {
+		t.Error("a zone was created in a dry run")
+	}
+	if got := rrsetContents(f.RRset("example.org.", "www.example.org.", "A")); !reflect.DeepEqual(got, []string{"192.0.2.1"}) {
+		t.Errorf("zone changed in a dry run: %q", got)
+	}
+
+	diff, err := p.PlanChanges(ctx, "example.org.", OperationAppend, []libdns.Record{www})
+	if err != nil {
+		t.Fatalf("PlanChanges: %s", err)
+	}
+	want := ZoneDiff{Zone: "example.org.", RRsets: []RRsetDiff{{
+		Name:      "www.example.org.",
+		Type:      "A",
+		Action:    ActionReplace,
+		Before:    []string{"192.0.2.1"},
+		After:     []string{"192.0.2.1", "192.0.2.2"},
+		Added:     []string{"192.0.2.2"},
+		Removed:   []string{},
+		TTLBefore: 60,
+		TTLAfter:  60,
+	}}}
+	if !reflect.DeepEqual(diff, want) {
+		t.Errorf("PlanChanges: have %#v want %#v", diff, want)
+	}
+}
+
+func TestPlanChanges(t *testing.T) {
+	ctx := context.Background()
+	f := newFakePDNS(t)
+	f.AddZone("example.org.",
+		rrset("www.example.org.", "A", 60, "192.0.2.1", "192.0.2.2"),
+		rrset("mail.example.org.", "MX", 300, "10 mx.example.org."),
+		rrset("txt.example.org.", "TXT", 60, `"a"`),
+	)
+	p := f.provider()
+	ip := func(s string) netip.Addr { return netip.MustParseAddr(s) }
+
+	for _, tc := range []struct {
+		name    string
+		op      Operation
+		records []libdns.Record
+		want    []RRsetDiff
+	}{
+		{
+			name: "append",
+			op:   OperationAppend,
+			records: []libdns.Record{
+				libdns.Address{Name: "www", IP: ip("192.0.2.1"), TTL: time.Minute},
+				libdns.Address{Name: "www", IP: ip("192.0.2.3"), TTL: time.Minute},
+				libdns.Address{Name: "new", IP: ip("2001:db8::1"), TTL: time.Hour},
+				libdns.TXT{Name: "txt", Text: "a", TTL: time.Minute},
+			},
+			want: []RRsetDiff{
+				{Name: "www.example.org.", Type: "A", Action: ActionReplace,
+					Before: []string{"192.0.2.1", "192.0.2.2"}, After: []string{"192.0.2.1", "192.0.2.2", "192.0.2.3"},
+					Added: []string{"192.0.2.3"}, Removed: []string{}, TTLBefore: 60, TTLAfter: 60},
+				{Name: "new.example.org.", Type: "AAAA", Action: ActionAdd,
+					Before: []string{}, After: []string{"2001:db8::1"},
+					Added: []string{"2001:db8::1"}, Removed: []string{}, TTLAfter: 3600},
+			},
+		},
+		{
+			name: "set",
+			op:   OperationSet,
+			records: []libdns.Record{
+				libdns.Address{Name: "www", IP: ip("192.0.2.2"), TTL: time.Minute},
+				libdns.MX{Name: "mail", Preference: 10, Target: "mx.example.org.", TTL: time.Hour},
+			},
+			want: []RRsetDiff{
+				{Name: "www.example.org.", Type: "A", Action: ActionReplace,
+					Before: []string{"192.0.2.1", "192.0.2.2"}, After: []string{"192.0.2.2"},
+					Added: []string{}, Removed: []string{"192.0.2.1"}, TTLBefore: 60, TTLAfter: 60},
+				{Name: "mail.example.org.", Type: "MX", Action: ActionReplace,
+					Before: []string{"10 mx.example.org."}, After: []string{"10 mx.example.org."},
+					Added: []string{}, Removed: []string{}, TTLBefore: 300, TTLAfter: 3600},
+			},
+		},
+		{
+			name: "delete",
+			op:   OperationDelete,
+			records: []libdns.Record{
+				libdns.Address{Name: "www", IP: ip("192.0.2.1")},
+				libdns.RR{Name: "txt", Type: "TXT"},
+				libdns.Address{Name: "missing", IP: ip("192.0.2.9")},
+			},
+			want: []RRsetDiff{
+				{Name: "www.example.org.", Type: "A", Action: ActionReplace,
+					Before: []string{"192.0.2.1", "192.0.2.2"}, After: []string{"192.0.2.2"},
+					Added: []string{}, Removed: []string{"192.0.2.1"}, TTLBefore: 60, TTLAfter: 60},
+				{Name: "txt.example.org.", Type: "TXT", Action: ActionRemove,
+					Before: []string{`"a"`}, After: []string{},
+					Added: []string{}, Removed: []string{`"a"`}, TTLBefore: 60},
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			diff, err := p.PlanChanges(ctx, "example.org.", tc.op, tc.records)
+			if err != nil {
+				t.Fatalf("PlanChanges: %s", err)
+			}
+			if !reflect.DeepEqual(diff.RRsets, tc.want) {
+				t.Errorf("have %#v\nwant %#v", diff.RRsets, tc.want)
+			}
+			if n := len(diff.Additions()) + len(diff.Removals()) + len(diff.Replacements()); n != len(tc.want) {
+				t.Errorf("the actions cover %d of %d rrsets", n, len(tc.want))
+			}
+
+			data, err := json.Marshal(diff)
+			if err != nil {
+				t.Fatalf("Marshal: %s", err)
+			}
+			var back ZoneDiff
+			if err := json.Unmarshal(data, &back); err != nil || !reflect.DeepEqual(back, diff) {
+				t.Errorf("JSON round trip changed the diff: %s, %v", data, err)
+			}
+		})
+	}
+	if n := f.CallCount(http.MethodPatch, ""); n != 0 {
+		t.Errorf("PlanChanges sent %d PATCH requests", n)
+	}
+}
+
+func TestDryRunEntryPoints(t *testing.T) {
+	ctx := context.Background()
+	www := libdns.Address{Name: "www", IP: netip.MustParseAddr("192.0.2.2"), TTL: time.Minute}
+	for _, tc := range []struct {
+		name  string
+		write func(p *Provider) error
+	}{
+		{"AppendRecordsResult", func(p *Provider) error {
+			_, err := p.AppendRecordsResult(ctx, "example.org.", []libdns.Record{www})
+			return err
+		}},
+		{"SetRecordsResult", func(p *Provider) error {
+			_, err := p.SetRecordsResult(ctx, "example.org.", []libdns.Record{www})
+			return err
+		}},
+		{"DeleteRecordsResult", func(p *Provider) error {
+			_, err := p.DeleteRecordsResult(ctx, "example.org.", []libdns.Record{libdns.TXT{Name: "old", Text: "bye"}})
+			return err
+		}},
+		{"DeleteRecordsMulti", func(p *Provider) error {
+			_, err := p.DeleteRecordsMulti(ctx, map[string][]libdns.Record{"example.org.": {libdns.TXT{Name: "old", Text: "bye"}}})
+			return err
+		}},
+		{"Apply", func(p *Provider) error {
+			_, err := p.Apply(ctx, "example.org.", []libdns.Record{www}, []libdns.Record{libdns.TXT{Name: "old", Text: "bye"}})
+			return err
+		}},
+		{"ReplaceZoneRecords", func(p *Provider) error {
+			return p.ReplaceZoneRecords(ctx, "example.org.", []libdns.Record{www})
+		}},
+		{"ReplaceZone", func(p *Provider) error {
+			_, err := p.ReplaceZone(ctx, "example.org.", []libdns.Record{www})
+			return err
+		}},
+		{"SetRecordDisabled", func(p *Provider) error {
+			return p.SetRecordDisabled(ctx, "example.org.", "www", "A", true)
+		}},
+		{"SetRecordComment", func(p *Provider) error {
+			return p.SetRecordComment(ctx, "example.org.", "www", "A", "TICKET-42", "ops")
+		}},
+		{"BumpSerial", func(p *Provider) error {
+			return p.BumpSerial(ctx, "example.org.")
+		}},
+		{"SetSOAPrimary", func(p *Provider) error {
+			return p.SetSOAPrimary(ctx, "example.org.", "ns2.example.org.")
+		}},
+		{"SetSOAHostmaster", func(p *Provider) error {
+			return p.SetSOAHostmaster(ctx, "example.org.", "dns@example.org")
+		}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			f := newFakePDNS(t)
+			f.AddZone("example.org.",
+				rrset("example.org.", "SOA", 3600, "ns1.example.org. hostmaster.example.org. 7 10800 3600 604800 3600"),
+				rrset("www.example.org.", "A", 60, "192.0.2.1"),
+				rrset("old.example.org.", "TXT", 60, `"bye"`),
+			)
+			before := f.Zone("example.org.")
+			p := f.provider()
+			p.DryRun = true
+			p.AutoRectify = true
+
+			if err := tc.write(p); err != nil {
+				t.Fatalf("%s: %s", tc.name, err)
+			}
+			if n := f.CallCount(http.MethodPatch, ""); n != 0 {
+				t.Errorf("%d PATCH requests in a dry run", n)
+			}
+			if n := f.CallCount(http.MethodPut, "/rectify"); n != 0 {
+				t.Errorf("%d rectify requests in a dry run", n)
+			}
+			if after := f.Zone("example.org."); !reflect.DeepEqual(after, before) {
+				t.Errorf("zone changed in a dry run:\nbefore %#v\nafter  %#v", before, after)
+			}
+		})
+	}
+}
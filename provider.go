@@ -3,41 +3,253 @@ package powerdns
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
 	"os"
+	"slices"
 	"strings"
 	"sync"
 	"time"
 
 	"github.com/joeig/go-powerdns/v3"
 	"github.com/libdns/libdns"
+	"golang.org/x/time/rate"
 )
 
 // Provider facilitates DNS record manipulation with PowerDNS.
 type Provider struct {
-	// ServerURL is the location of the pdns server.
+	// ServerURL is the location of the pdns server, e.g.
+	// http://127.0.0.1:8081.  Trailing slashes and an /api/v1 suffix are
+	// ignored; a path in front of that is kept for reverse proxies.
 	ServerURL string `json:"server_url"`
 
 	// ServerID is the id of the server.  localhost will be used
 	// if this is omitted.
 	ServerID string `json:"server_id,omitempty"`
 
+	// ReadURL is the location of a read-only pdns server, for instance a
+	// replica, to send read requests like GetRecords to.  Changes always
+	// go to ServerURL.  If omitted, ServerURL is used for everything.
+	ReadURL string `json:"read_url,omitempty"`
+
 	// APIToken is the auth token.
 	APIToken string `json:"api_token,omitempty"`
 
+	// APITokenFile is the path of a file holding the auth token, for
+	// setups where secrets are mounted as files.  Surrounding whitespace
+	// is trimmed.  It is an error to set both APIToken and APITokenFile.
+	APITokenFile string `json:"api_token_file,omitempty"`
+
+	// Logger, if set, receives every request and response at debug
+	// level, with the API token masked.  It takes precedence over Debug.
+	Logger *slog.Logger `json:"-"`
+
+	// RequestHook, if set, is called after every HTTP request to the
+	// server with its method, URL, duration and outcome: the transport
+	// error, a *powerdns.Error for a status outside 2xx, or nil.  Retried
+	// requests are reported once per attempt.  A panicking hook doesn't
+	// fail the request.
+	RequestHook func(ctx context.Context, method, url string, err error, dur time.Duration) `json:"-"`
+
+	// Metrics, if set, is told about every GetRecords, AppendRecords,
+	// SetRecords, DeleteRecords, ReplaceZoneRecords and ReplaceZone call.
+	Metrics Metrics `json:"-"`
+
+	// AutoRectify rectifies the zone after every change to its records
+	// made through the provider, for signed zones without API-RECTIFY:
+	// the writes DryRun lists, except SetRecordComment, since comments
+	// are not DNS data.  Zones with API-RECTIFY are left to the server,
+	// and presigned zones are never rectified.
+	AutoRectify bool `json:"auto_rectify,omitempty"`
+
+	// NormalizeZoneCase lowercases zone names before sending them to the
+	// server, which stores zones in lowercase, so "Example.ORG." finds
+	// the zone example.org.  It is on unless set to false.
+	NormalizeZoneCase *bool `json:"normalize_zone_case,omitempty"`
+
+	// DefaultTTL is used for records that are appended or set with a TTL
+	// of zero.  If it is zero as well, 5 minutes are used.  Records
+	// appended to an existing rrset without a TTL keep the TTL the rrset
+	// has instead.
+	DefaultTTL time.Duration `json:"default_ttl,omitempty"`
+
+	// DefaultZoneKind is the kind of zones created by CreateZone without
+	// an explicit kind: Native, Master, Slave, Producer or Consumer.  If it
+	// is empty, Native is used.
+	DefaultZoneKind string `json:"default_zone_kind,omitempty"`
+
+	// AutoCreateZone makes AppendRecords, SetRecords and Apply create the
+	// zone when it doesn't exist yet, with DefaultZoneKind,
+	// DefaultNameservers and DefaultAccount, instead of failing with
+	// ErrZoneNotFound.
+	AutoCreateZone bool `json:"auto_create_zone,omitempty"`
+
+	// DefaultNameservers are put in the apex NS rrset of zones created by
+	// AutoCreateZone.
+	DefaultNameservers []string `json:"default_nameservers,omitempty"`
+
+	// DefaultAccount is the account of zones created by CreateZone
+	// without an explicit one, and so of zones created by
+	// AutoCreateZone, e.g. to tag them for billing or access control.
+	DefaultAccount string `json:"default_account,omitempty"`
+
+	// ConflictRetries, if positive, guards writes against changes other
+	// clients make to the zone at the same time.  The zone serial seen
+	// when planning a write is checked again right before it is applied;
+	// if it changed, the write is planned again on the new state of the
+	// zone, up to ConflictRetries times, and then fails with
+	// ErrConcurrentModification.  This needs a zone whose serial changes
+	// on every edit, see SetSOAEdit, and only narrows the window for a
+	// conflict: PowerDNS has no conditional PATCH to close it.
+	ConflictRetries int `json:"conflict_retries,omitempty"`
+
+	// AllowApexDeletion lets writes delete the SOA or NS rrset of the zone
+	// apex.  PowerDNS can't serve a zone without them, so by default
+	// DeleteRecords, Apply and ReplaceZoneRecords leave these rrsets in
+	// place when a change would remove them entirely, e.g. when deleting
+	// everything GetRecords returned.  Removing some of their values, or
+	// replacing them with new ones, is always possible.
+	AllowApexDeletion bool `json:"allow_apex_deletion,omitempty"`
+
+	// MultiZoneStopOnError makes DeleteRecordsMulti stop at the first zone
+	// that fails instead of going on with the others.  Zones are written
+	// in sorted order, so which ones were written before is predictable.
+	MultiZoneStopOnError bool `json:"multi_zone_stop_on_error,omitempty"`
+
+	// DryRun makes the record writes work out their changes without
+	// sending them, and return what they would have returned:
+	// AppendRecords, SetRecords and DeleteRecords with their WithResults
+	// and Result variants, DeleteRecordsMulti, Apply, ReplaceZoneRecords,
+	// ReplaceZone, SetRecordDisabled, SetRecordComment, BumpSerial,
+	// SetSOAPrimary and SetSOAHostmaster, as well as AppendAddresses,
+	// SetAddresses, DeleteAddresses and AppendPTR, which use them.  Zones
+	// are not auto created either.  Zone level calls such as CreateZone,
+	// DeleteZone and the metadata setters are not covered and always
+	// write.  Use PlanChanges to see the changes themselves.
+	DryRun bool `json:"dry_run,omitempty"`
+
+	// IncludeDisabled makes GetRecords and its filtering variants return
+	// disabled records, which PowerDNS keeps but does not serve, as well.
+	// Use GetRecordsWithMeta to tell them apart.
+	IncludeDisabled bool `json:"include_disabled,omitempty"`
+
+	// ZoneCacheTTL, if positive, is how long settings of a zone that
+	// rarely change, like its kind and whether it is presigned or has
+	// API-RECTIFY, are remembered.  That saves requests for operations
+	// that only need those.  Records are never cached.  Use
+	// InvalidateZoneCache after changing the settings of a zone outside
+	// of the provider.
+	ZoneCacheTTL time.Duration `json:"zone_cache_ttl,omitempty"`
+
+	// MaxRetries is how often a request the server answered with 503
+	// Service Unavailable, e.g. during a reload, or with 429 Too Many
+	// Requests is retried, waiting longer before every attempt, or as long
+	// as a Retry-After header in the answer asks.  Zero disables retries,
+	// except that a 429 answer with a Retry-After header is always retried
+	// up to twice, since the server said when to come back.
+	MaxRetries int `json:"max_retries,omitempty"`
+
+	// MaxRetryAfter caps how long a retry waits for a Retry-After header,
+	// 1 minute by default.  Longer waits are cut short to it.
+	MaxRetryAfter time.Duration `json:"max_retry_after,omitempty"`
+
+	// RateLimit, if positive, is how many requests per second are sent to
+	// the server at most, for servers with a request quota.  Requests over
+	// the limit wait for their turn, or until their context is done.
+	// Burst is how many requests may go out at once after a quiet period;
+	// it is at least 1.  The ServerURL and ReadURL servers are limited
+	// separately.
+	RateLimit rate.Limit `json:"rate_limit,omitempty"`
+	Burst     int        `json:"burst,omitempty"`
+
+	// UserAgent, if set, is sent as the User-Agent header of every
+	// request, e.g. "my-controller/1.2.3 libdns-powerdns", so the
+	// server's operators can tell which tool is calling.
+	UserAgent string `json:"user_agent,omitempty"`
+
 	// Debug - can set this to stdout or stderr to dump
 	// debugging information about the API interaction with
 	// powerdns.  This will dump your auth token in plain text
-	// so be careful.
+	// so be careful; Logger is the safer alternative.
 	Debug string `json:"debug,omitempty"`
 
-	mu sync.Mutex
-	c  *client
+	// set through the options of NewProvider
+	httpClient  *http.Client
+	timeout     time.Duration
+	debugWriter io.Writer
+
+	mu        sync.Mutex
+	c         *client
+	readC     *client
+	cInit     *clientInit
+	readInit  *clientInit
+	zoneCache map[string]cachedZone
+}
+
+// RecordMeta is a record together with PowerDNS specific state that the
+// libdns types have no room for.
+type RecordMeta struct {
+	Record libdns.Record
+
+	// Disabled is true for records that are stored in the zone but not
+	// served by PowerDNS.
+	Disabled bool
+
+	// Comments are the comments of the rrset the record belongs to.
+	// PowerDNS keeps comments per rrset, so all records of an rrset share
+	// the same slice.
+	Comments []RecordComment
+}
+
+// GetRecords lists all the records in the zone.  Records that are disabled
+// in PowerDNS are not served, so they are left out unless IncludeDisabled
+// is set; use GetRecordsWithMeta to see which they are.
+//
+// Records are returned in the order the server reports them, so the values
+// of an rrset keep their stored order from one call to the next.
+//
+// TXT text is returned without the quoting PowerDNS stores it with, see
+// txtsanitize.TXTUnsanitize: what AppendRecords or SetRecords wrote reads
+// back the same, and can be written back without changing the record.
+// Text longer than 255 bytes, like DKIM keys, is written as several
+// character strings (see txtsanitize.TXTSplit) and joined again here.
+//
+// Zones are addressed by name, which PowerDNS uses as their ID as well, so
+// neither this nor any other method, the metadata ones included, looks the
+// zone up in a listing or fetches it for its ID first: a call costs the
+// same as one addressing the zone by ID would.
+//
+// Record types libdns has no struct for are returned as libdns.RR.  That
+// includes ALIAS, the PowerDNS answer to CNAME at the apex, which can be
+// written the same way; ALIAS targets are made fully qualified.  Note that
+// PowerDNS only resolves ALIAS records when expand-alias is enabled and a
+// resolver is configured on the server.
+func (p *Provider) GetRecords(ctx context.Context, zone string) (_ []libdns.Record, err error) {
+	defer func(start time.Time) { p.observe("get", start, err) }(time.Now())
+	metas, err := p.GetRecordsWithMeta(ctx, zone)
+	if err != nil {
+		return nil, err
+	}
+	recs := make([]libdns.Record, 0, len(metas))
+	for _, m := range metas {
+		if m.Disabled && !p.IncludeDisabled {
+			continue
+		}
+		recs = append(recs, m.Record)
+	}
+	return recs, nil
 }
 
-// GetRecords lists all the records in the zone.
-func (p *Provider) GetRecords(ctx context.Context, zone string) ([]libdns.Record, error) {
-	c, err := p.client()
+// GetRecordsWithMeta lists all the records in the zone, including disabled
+// ones, along with their PowerDNS specific state and the comments of their
+// rrsets.
+func (p *Provider) GetRecordsWithMeta(ctx context.Context, zone string) ([]RecordMeta, error) {
+	zone = p.normalizeZone(zone)
+	c, err := p.readClient(ctx)
 	if err != nil {
 		return nil, err
 	}
@@ -45,200 +257,663 @@ func (p *Provider) GetRecords(ctx context.Context, zone string) ([]libdns.Record
 	if err != nil {
 		return nil, err
 	}
+	return zoneRecords(fullZone, zone)
+}
+
+// GetRecordsFunc calls fn for every record in the zone, including disabled
+// ones, in the same order as GetRecordsWithMeta.  The zone is decoded while
+// it is being read from the server, so memory use doesn't grow with the
+// size of the zone.  If fn returns an error, iteration stops and that error
+// is returned.
+func (p *Provider) GetRecordsFunc(ctx context.Context, zone string, fn func(RecordMeta) error) error {
+	zone = p.normalizeZone(zone)
+	c, err := p.readClient(ctx)
+	if err != nil {
+		return err
+	}
+	return c.streamRRsets(ctx, zone, nil, func(rrset powerdns.RRset) error {
+		recs, err := rrsetRecords(rrset, zone)
+		if err != nil {
+			return err
+		}
+		for _, r := range recs {
+			if err := fn(r); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// GetRecordsByTypes lists the records in the zone whose type is one of
+// types, like GetRecords does for all types.  PowerDNS can only filter on a
+// single type, so the zone is streamed and filtered here.
+func (p *Provider) GetRecordsByTypes(ctx context.Context, zone string, types []string) ([]libdns.Record, error) {
+	want := make(map[string]bool, len(types))
+	for _, t := range types {
+		want[strings.ToUpper(t)] = true
+	}
+	recs := make([]libdns.Record, 0)
+	err := p.GetRecordsFunc(ctx, zone, func(m RecordMeta) error {
+		if (!m.Disabled || p.IncludeDisabled) && want[m.Record.RR().Type] {
+			recs = append(recs, m.Record)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return recs, nil
+}
+
+// FilterOptions selects the records GetRecordsFiltered returns.  Empty
+// fields match everything.
+type FilterOptions struct {
+	// Name is the name of the records, relative to the zone or fully
+	// qualified, with "@" for the apex
+	Name string
+
+	// Type is the record type, such as "A"
+	Type string
+}
+
+// GetRecordsFiltered lists the records in the zone matching opts, like
+// GetRecords does for the whole zone.  When a name is given the server is
+// asked for just that name, and also just that type if one is given, so
+// only the matching rrsets are transferred.  PowerDNS can't filter on the
+// type alone, and servers too old to filter at all send the whole zone, so
+// the records are filtered here as well.
+func (p *Provider) GetRecordsFiltered(ctx context.Context, zone string, opts FilterOptions) ([]libdns.Record, error) {
+	zone = p.normalizeZone(zone)
+	query := url.Values{}
+	var name string
+	if opts.Name != "" {
+		var err error
+		if name, err = absoluteName(opts.Name, zone); err != nil {
+			return nil, err
+		}
+		query.Set("rrset_name", name)
+		if opts.Type != "" {
+			query.Set("rrset_type", strings.ToUpper(opts.Type))
+		}
+	}
+	c, err := p.readClient(ctx)
+	if err != nil {
+		return nil, err
+	}
 	recs := make([]libdns.Record, 0)
-	for _, rrset := range fullZone.RRsets {
-		if rrset.Type == nil {
-			continue
+	err = c.streamRRsets(ctx, zone, query, func(rrset powerdns.RRset) error {
+		if name != "" && powerdns.StringValue(rrset.Name) != name {
+			return nil
 		}
-		rrType := string(*rrset.Type)
-		rrName := powerdns.StringValue(rrset.Name)
-		ttl := time.Second * time.Duration(powerdns.Uint32Value(rrset.TTL))
-		for _, r := range rrset.Records {
-			content := powerdns.StringValue(r.Content)
-			lrec, err := (libdns.RR{
-				Type: rrType,
-				Name: libdns.RelativeName(rrName, zone),
-				Data: content,
-				TTL:  ttl,
-			}).Parse()
-			if err != nil {
-				return nil, err
+		if opts.Type != "" && (rrset.Type == nil || !strings.EqualFold(string(*rrset.Type), opts.Type)) {
+			return nil
+		}
+		metas, err := rrsetRecords(rrset, zone)
+		if err != nil {
+			return err
+		}
+		for _, m := range metas {
+			if !m.Disabled || p.IncludeDisabled {
+				recs = append(recs, m.Record)
 			}
-			recs = append(recs, lrec)
 		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
 	return recs, nil
 }
 
+// GetRecord returns the records of the rrset of the given name and type,
+// or an empty slice if the zone has none, fetching only that rrset from
+// servers that can filter.  See GetRecordsFiltered.
+func (p *Provider) GetRecord(ctx context.Context, zone, name, rrType string) ([]libdns.Record, error) {
+	if name == "" || rrType == "" {
+		return nil, fmt.Errorf("zone %s: GetRecord needs both a name and a type", zone)
+	}
+	return p.GetRecordsFiltered(ctx, zone, FilterOptions{Name: name, Type: rrType})
+}
+
+// RecordResult reports what happened to a single input record in one of the
+// *WithResults methods.  Applied is true when the record changed the zone
+// (it was created, modified or deleted).  A record that was skipped because
+// the zone was already in the requested state has Applied false and a nil
+// Err.  Err is set when the change carrying this record failed.
+type RecordResult struct {
+	Record  libdns.Record
+	Applied bool
+	Err     error
+}
+
 // AppendRecords adds records to the zone. It returns the records that were added.
-func (p *Provider) AppendRecords(ctx context.Context, zone string, records []libdns.Record) ([]libdns.Record, error) {
-	c, err := p.client()
+// Values that are already in the zone, or that appear twice in the input,
+// are added only once and are not returned again, so appending the same
+// records twice is harmless.  The records are returned as the server
+// stored them, so names are canonical, TTLs defaulted and TXT text has gone
+// through txtsanitize.TXTSanitize and back.
+//
+// All rrset changes are submitted in a single PATCH, which PowerDNS applies
+// atomically, so on error the zone is left untouched.  The same holds for
+// SetRecords and DeleteRecords.  Rrsets that already are as requested, with
+// the same values and TTL, are left out of it, and no PATCH is sent at all
+// when nothing changes, so the serial isn't bumped for nothing.
+func (p *Provider) AppendRecords(ctx context.Context, zone string, records []libdns.Record) (_ []libdns.Record, err error) {
+	defer func(start time.Time) { p.observe("append", start, err) }(time.Now())
+	_, added, err := p.appendRecords(ctx, zone, records, true, true, nil)
 	if err != nil {
 		return nil, err
 	}
+	return added, nil
+}
 
-	// Get current zone state
-	fullZone, err := c.getZone(ctx, zone)
+// AppendRecordsWithResults behaves like AppendRecords, but reports the
+// outcome of every input record.  Records whose value is already present
+// are reported as skipped.  All changes are sent in one atomic request, so
+// if it fails every record carries the error.
+func (p *Provider) AppendRecordsWithResults(ctx context.Context, zone string, records []libdns.Record) ([]RecordResult, error) {
+	results, _, err := p.appendRecords(ctx, zone, records, false, false, nil)
+	return results, err
+}
+
+// SetRecords sets the records in the zone, either by updating existing records or creating new ones.
+// It returns the updated records, as the server stored them: all values of
+// every rrset in the input.
+//
+// For every name+type present in the input, the resulting rrset contains
+// exactly the supplied values: values that were there before but are not in
+// the input are removed.  Rrsets of other types at the same name, and names
+// not mentioned in the input, are left alone.  The TTL of each rrset is
+// taken from the first input record for it.
+func (p *Provider) SetRecords(ctx context.Context, zone string, records []libdns.Record) (_ []libdns.Record, err error) {
+	defer func(start time.Time) { p.observe("set", start, err) }(time.Now())
+	_, set, err := p.setRecords(ctx, zone, records, true, true, nil)
 	if err != nil {
 		return nil, err
 	}
+	return set, nil
+}
 
-	// Convert input records to absolute names
-	absRecords := convertNamesToAbsolute(zone, records)
-	recHash := makeLDRecHash(absRecords)
+// SetRecordsWithResults behaves like SetRecords, but reports the outcome of
+// every input record.
+func (p *Provider) SetRecordsWithResults(ctx context.Context, zone string, records []libdns.Record) ([]RecordResult, error) {
+	results, _, err := p.setRecords(ctx, zone, records, false, false, nil)
+	return results, err
+}
 
-	// Process each unique name+type combination
-	for _, recs := range recHash {
-		if len(recs) == 0 {
-			continue
+// DeleteRecords deletes the records from the zone. It returns the records that were deleted.
+// A libdns.RR with a name and type but empty data deletes the whole rrset
+// of that name and type, whatever its values.  The SOA and NS rrsets of the
+// apex are not deleted entirely unless AllowApexDeletion is set; the
+// records asking for that are skipped.  Skipped records, like those that
+// were not in the zone, are left out of the returned ones.
+func (p *Provider) DeleteRecords(ctx context.Context, zone string, records []libdns.Record) (_ []libdns.Record, err error) {
+	defer func(start time.Time) { p.observe("delete", start, err) }(time.Now())
+	results, err := p.deleteRecords(ctx, zone, records, true, nil)
+	if err != nil {
+		return nil, err
+	}
+	deleted := make([]libdns.Record, 0, len(results))
+	for _, r := range results {
+		if r.Applied {
+			deleted = append(deleted, r.Record)
 		}
+	}
+	return deleted, nil
+}
 
-		name := recs[0].Name
-		rrType := recs[0].Type
-		ttl := uint32(recs[0].TTL.Seconds())
+// DeleteRecordsWithResults behaves like DeleteRecords, but reports the
+// outcome of every input record.  Records that were not present in the
+// zone are reported as skipped.
+func (p *Provider) DeleteRecordsWithResults(ctx context.Context, zone string, records []libdns.Record) ([]RecordResult, error) {
+	return p.deleteRecords(ctx, zone, records, false, nil)
+}
 
-		// Get new content values
-		newContents := make([]string, 0, len(recs))
-		for _, r := range recs {
-			newContents = append(newContents, r.Data)
+// DeleteRecordsMulti deletes records from several zones, with the records
+// for each zone as DeleteRecords takes them.  The zones are written one
+// after another in sorted order, each atomically on its own, and a zone
+// that fails, e.g. because it doesn't exist, doesn't stop the others
+// unless MultiZoneStopOnError is set.  It returns the deleted records of
+// the zones that succeeded, and an error joining those of the zones that
+// failed, each naming its zone and wrapping the error DeleteRecords
+// returned.
+func (p *Provider) DeleteRecordsMulti(ctx context.Context, records map[string][]libdns.Record) (map[string][]libdns.Record, error) {
+	zones := make([]string, 0, len(records))
+	for zone := range records {
+		zones = append(zones, zone)
+	}
+	slices.Sort(zones)
+	deleted := make(map[string][]libdns.Record, len(zones))
+	var errs []error
+	for _, zone := range zones {
+		recs, err := p.DeleteRecords(ctx, zone, records[zone])
+		if err != nil {
+			errs = append(errs, fmt.Errorf("zone %s: %w", zone, err))
+			if p.MultiZoneStopOnError {
+				break
+			}
+			continue
 		}
+		deleted[zone] = recs
+	}
+	return deleted, errors.Join(errs...)
+}
 
-		// Find existing RRset and merge
-		existingRRset := findRRset(fullZone, name, rrType)
-		existingContents := rrsetContents(existingRRset)
-		mergedContents := mergeContents(existingContents, newContents)
-
-		// Use Records.Change to update (works for both new and existing)
-		err = c.Records.Change(ctx, zone, name, powerdns.RRType(rrType), ttl, mergedContents)
-		if err != nil {
-			return nil, err
+// appendRecords, setRecords and deleteRecords do the writes, and count
+// what they changed in counts unless it is nil
+func (p *Provider) appendRecords(ctx context.Context, zone string, records []libdns.Record, failFast, stored bool, counts *ChangeCounts) ([]RecordResult, []libdns.Record, error) {
+	zone = p.normalizeZone(zone)
+	pl, err := p.plan(ctx, zone, OperationAppend, records)
+	if err != nil {
+		return nil, nil, err
+	}
+	results, err := p.apply(ctx, pl.c, zone, pl.before, records, pl.changes, failFast)
+	if err == nil {
+		counts.add(zone, pl)
+	}
+	if err != nil || !stored {
+		return results, nil, err
+	}
+	if p.DryRun {
+		added := make([]libdns.Record, 0, len(results))
+		for _, r := range results {
+			if r.Applied {
+				added = append(added, r.Record)
+			}
 		}
+		return results, added, nil
 	}
+	added, err := p.storedRecords(ctx, pl.c, zone, pl.before, pl.changes, true)
+	return results, added, err
+}
 
-	return records, nil
+func (p *Provider) setRecords(ctx context.Context, zone string, records []libdns.Record, failFast, stored bool, counts *ChangeCounts) ([]RecordResult, []libdns.Record, error) {
+	zone = p.normalizeZone(zone)
+	pl, err := p.plan(ctx, zone, OperationSet, records)
+	if err != nil {
+		return nil, nil, err
+	}
+	results, err := p.apply(ctx, pl.c, zone, pl.before, records, pl.changes, failFast)
+	if err == nil {
+		counts.add(zone, pl)
+	}
+	if err != nil || !stored {
+		return results, nil, err
+	}
+	if p.DryRun {
+		return results, records, nil
+	}
+	set, err := p.storedRecords(ctx, pl.c, zone, pl.before, pl.changes, false)
+	return results, set, err
 }
 
-// SetRecords sets the records in the zone, either by updating existing records or creating new ones.
-// It returns the updated records.
-func (p *Provider) SetRecords(ctx context.Context, zone string, records []libdns.Record) ([]libdns.Record, error) {
-	c, err := p.client()
+func (p *Provider) deleteRecords(ctx context.Context, zone string, records []libdns.Record, failFast bool, counts *ChangeCounts) ([]RecordResult, error) {
+	zone = p.normalizeZone(zone)
+	pl, err := p.plan(ctx, zone, OperationDelete, records)
 	if err != nil {
 		return nil, err
 	}
+	results, err := p.apply(ctx, pl.c, zone, pl.before, records, pl.changes, failFast)
+	if err == nil {
+		counts.add(zone, pl)
+	}
+	return results, err
+}
 
-	// Convert input records to absolute names
-	absRecords := convertNamesToAbsolute(zone, records)
-	recHash := makeLDRecHash(absRecords)
-
-	// Process each unique name+type combination
-	for _, recs := range recHash {
-		if len(recs) == 0 {
+// keepApex drops the changes that would delete the SOA or NS rrset of the
+// zone apex, unless AllowApexDeletion is set.  The records that asked for
+// them are left reported as not applied.
+func (p *Provider) keepApex(zone string, changes []rrsetChange) []rrsetChange {
+	if p.AllowApexDeletion {
+		return changes
+	}
+	apex := canonicalZone(zone)
+	kept := make([]rrsetChange, 0, len(changes))
+	for _, ch := range changes {
+		if len(ch.contents) == 0 && (ch.rrType == "SOA" || ch.rrType == "NS") && strings.EqualFold(ch.name, apex) {
 			continue
 		}
+		kept = append(kept, ch)
+	}
+	return kept
+}
 
-		name := recs[0].Name
-		rrType := recs[0].Type
-		ttl := uint32(recs[0].TTL.Seconds())
+// writePlan is what a write is going to do to a zone
+type writePlan struct {
+	c       *client
+	before  *powerdns.Zone
+	changes []rrsetChange
+}
 
-		// Collect all content values for this name+type
-		contents := make([]string, 0, len(recs))
-		for _, r := range recs {
-			contents = append(contents, r.Data)
-		}
+// plan works out the changes op makes with the records in the zone, which
+// must have been normalized, guarding against concurrent changes as
+// ConflictRetries asks for.  Nothing is changed yet.
+func (p *Provider) plan(ctx context.Context, zone string, op Operation, records []libdns.Record) (writePlan, error) {
+	return p.checkedPlan(ctx, zone, func() (writePlan, error) {
+		return p.planOnce(ctx, zone, op, records)
+	})
+}
 
-		// Use Records.Change to replace
-		err = c.Records.Change(ctx, zone, name, powerdns.RRType(rrType), ttl, contents)
+// checkedPlan calls plan and, if ConflictRetries is set, then makes sure
+// the serial of the zone is still the one plan saw.  If it isn't, someone
+// else changed the zone in the meantime and the plan may undo that, so it
+// is made again, up to ConflictRetries times.
+func (p *Provider) checkedPlan(ctx context.Context, zone string, plan func() (writePlan, error)) (writePlan, error) {
+	for attempt := 0; ; attempt++ {
+		pl, err := plan()
+		if err != nil || p.ConflictRetries <= 0 || p.DryRun {
+			return pl, err
+		}
+		seen := powerdns.Uint32Value(pl.before.Serial)
+		serial, err := pl.c.zoneSerial(ctx, zone)
 		if err != nil {
-			return nil, err
+			return writePlan{}, p.zoneError(zone, err)
+		}
+		if serial == seen {
+			return pl, nil
+		}
+		if attempt >= p.ConflictRetries {
+			return writePlan{}, fmt.Errorf("zone %s kept changing while planning a write, serial %d is now %d: %w", zone, seen, serial, ErrConcurrentModification)
 		}
 	}
-
-	return records, nil
 }
 
-// DeleteRecords deletes the records from the zone. It returns the records that were deleted.
-func (p *Provider) DeleteRecords(ctx context.Context, zone string, records []libdns.Record) ([]libdns.Record, error) {
-	c, err := p.client()
+// planOnce is plan without the check for concurrent changes.
+func (p *Provider) planOnce(ctx context.Context, zone string, op Operation, records []libdns.Record) (writePlan, error) {
+	absRecords, err := convertNamesToAbsolute(zone, records)
 	if err != nil {
-		return nil, err
+		return writePlan{}, err
+	}
+	if op == OperationDelete {
+		wholeRRsets(records, absRecords)
+	}
+	c, err := p.client(ctx)
+	if err != nil {
+		return writePlan{}, err
 	}
 
-	// Get current zone state
-	fullZone, err := c.getZone(ctx, zone)
+	// Get current zone state, which also has the comments of replaced
+	// rrsets
+	var fullZone *powerdns.Zone
+	if op == OperationDelete {
+		fullZone, err = c.getZone(ctx, zone)
+	} else {
+		fullZone, err = p.writableZone(ctx, c, zone)
+	}
 	if err != nil {
-		return nil, err
+		return writePlan{}, p.zoneError(zone, err)
+	}
+	if op == OperationAppend {
+		keepExistingTTL(fullZone, absRecords)
 	}
+	if op != OperationDelete {
+		absRecords = p.withDefaultTTL(absRecords)
+	}
+
+	pl := writePlan{c: c, before: fullZone}
+	switch op {
+	case OperationAppend:
+		pl.changes = planAppend(fullZone, absRecords)
+	case OperationSet:
+		pl.changes = planSet(fullZone, absRecords)
+	case OperationDelete:
+		pl.changes = planDelete(fullZone, absRecords)
+	default:
+		return writePlan{}, fmt.Errorf("unknown operation %q", op)
+	}
+	pl.changes = p.keepApex(zone, pl.changes)
+	return pl, nil
+}
+
+// apply submits the changes and then rectifies the zone if AutoRectify
+// asks for it.  In a dry run nothing is sent, and the results say what
+// would have been applied.
+func (p *Provider) apply(ctx context.Context, c *client, zone string, fullZone *powerdns.Zone, records []libdns.Record, changes []rrsetChange, failFast bool) ([]RecordResult, error) {
+	changes = effectiveChanges(fullZone, changes)
+	if p.DryRun {
+		results := make([]RecordResult, len(records))
+		for i, r := range records {
+			results[i].Record = r
+		}
+		for _, ch := range changes {
+			for i, idx := range ch.inputs {
+				results[idx].Applied = ch.applied[i]
+			}
+		}
+		return results, nil
+	}
+	results, err := applyChanges(ctx, c, zone, records, changes, failFast)
+	if err != nil || len(changes) == 0 {
+		return results, err
+	}
+	for _, r := range results {
+		if r.Err != nil {
+			// the PATCH failed, so there is nothing to rectify
+			return results, nil
+		}
+	}
+	return results, p.autoRectify(ctx, c, fullZone)
+}
 
-	// Convert input records to absolute names
-	absRecords := convertNamesToAbsolute(zone, records)
-	recHash := makeLDRecHash(absRecords)
+// writableZone fetches the zone that records are about to be written to,
+// creating it first if it is missing and AutoCreateZone is set, except in
+// a dry run.  A zone
+// that a concurrent write created in the meantime is just as good.
+func (p *Provider) writableZone(ctx context.Context, c *client, zone string) (*powerdns.Zone, error) {
+	fullZone, err := c.getZone(ctx, zone)
+	if err == nil || !p.AutoCreateZone || !errors.Is(err, ErrZoneNotFound) {
+		return fullZone, err
+	}
+	if p.DryRun {
+		// plan against the empty zone that would be created
+		return &powerdns.Zone{Name: powerdns.String(canonicalZone(zone))}, nil
+	}
+	p.InvalidateZoneCache(zone)
+	err = p.CreateZone(ctx, zone, CreateZoneOptions{
+		Nameservers: p.DefaultNameservers,
+		Account:     p.DefaultAccount,
+		IfNotExists: true,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("creating zone %s: %w", zone, err)
+	}
+	return c.getZone(ctx, zone)
+}
 
-	// Process each unique name+type combination
-	for _, recs := range recHash {
-		if len(recs) == 0 {
+// storedRecords fetches the changed rrsets again after the changes were
+// applied and returns their records as the server has them now.  With
+// onlyNew, values the rrsets already had in before are left out.
+func (p *Provider) storedRecords(ctx context.Context, c *client, zone string, before *powerdns.Zone, changes []rrsetChange, onlyNew bool) ([]libdns.Record, error) {
+	recs := make([]libdns.Record, 0)
+	if len(changes) == 0 {
+		return recs, nil
+	}
+	after, err := c.changedRRsets(ctx, zone, changes)
+	if err != nil {
+		return nil, p.zoneError(zone, err)
+	}
+	for _, ch := range changes {
+		rrset := findRRset(after, ch.name, ch.rrType)
+		if rrset == nil {
 			continue
 		}
+		old := make(map[string]bool)
+		if onlyNew {
+			for _, content := range rrsetContents(findRRset(before, ch.name, ch.rrType)) {
+				old[strings.TrimSuffix(content, ".")] = true
+			}
+		}
+		fresh := *rrset
+		fresh.Records = nil
+		for _, r := range rrset.Records {
+			if !old[strings.TrimSuffix(powerdns.StringValue(r.Content), ".")] {
+				fresh.Records = append(fresh.Records, r)
+			}
+		}
+		metas, err := rrsetRecords(fresh, zone)
+		if err != nil {
+			return nil, err
+		}
+		for _, m := range metas {
+			recs = append(recs, m.Record)
+		}
+	}
+	return recs, nil
+}
+
+// normalizeZone returns the zone name as it should be sent to the server
+func (p *Provider) normalizeZone(zone string) string {
+	if p.NormalizeZoneCase == nil || *p.NormalizeZoneCase {
+		return strings.ToLower(zone)
+	}
+	return zone
+}
 
-		name := recs[0].Name
-		rrType := recs[0].Type
+// defaultTTL is the TTL used when none could be found elsewhere
+const defaultTTL = 300 * time.Second
 
-		// Find existing RRset
-		existingRRset := findRRset(fullZone, name, rrType)
-		if existingRRset == nil {
-			// Nothing to delete
+// keepExistingTTL gives records without a TTL the TTL of the rrset they
+// are appended to, so the default TTL only applies to new rrsets and
+// appending never changes the TTL of an existing one by accident
+func keepExistingTTL(zone *powerdns.Zone, records []libdns.RR) {
+	for i := range records {
+		if records[i].TTL != 0 {
 			continue
 		}
+		if existing := findRRset(zone, records[i].Name, records[i].Type); existing != nil {
+			records[i].TTL = time.Duration(powerdns.Uint32Value(existing.TTL)) * time.Second
+		}
+	}
+}
 
-		// Get contents to remove
-		toRemove := make([]string, 0, len(recs))
-		for _, r := range recs {
-			toRemove = append(toRemove, r.Data)
+// withDefaultTTL substitutes the default TTL for zero TTLs in records
+func (p *Provider) withDefaultTTL(records []libdns.RR) []libdns.RR {
+	ttl := p.DefaultTTL
+	if ttl <= 0 {
+		ttl = defaultTTL
+	}
+	for i := range records {
+		if records[i].TTL == 0 {
+			records[i].TTL = ttl
 		}
+	}
+	return records
+}
 
-		// Remove specified contents from existing
-		existingContents := rrsetContents(existingRRset)
-		remainingContents := removeContents(existingContents, toRemove)
+// client returns the client for the server, building it on first use.
+// Building it can block, e.g. on reading APITokenFile, so it is done
+// without holding p.mu; concurrent callers wait for the same build, each
+// for as long as its own ctx allows.
+func (p *Provider) client(ctx context.Context) (*client, error) {
+	return p.lazyClient(ctx, &p.c, &p.cInit, "server_url", p.ServerURL)
+}
 
-		if len(remainingContents) == 0 {
-			// Delete entire RRset
-			err = c.Records.Delete(ctx, zone, name, powerdns.RRType(rrType))
-			if err != nil {
-				return nil, err
-			}
-		} else {
-			// Update with remaining contents
-			ttl := powerdns.Uint32Value(existingRRset.TTL)
-			err = c.Records.Change(ctx, zone, name, powerdns.RRType(rrType), ttl, remainingContents)
-			if err != nil {
-				return nil, err
-			}
-		}
+// readClient returns the client for requests that only read, which talks
+// to ReadURL if one is set.  Reads done to plan a change go through
+// client() instead, so they don't see a lagging replica.
+func (p *Provider) readClient(ctx context.Context) (*client, error) {
+	if p.ReadURL == "" {
+		return p.client(ctx)
 	}
+	return p.lazyClient(ctx, &p.readC, &p.readInit, "read_url", p.ReadURL)
+}
 
-	return records, nil
+// clientInit is a client being built by lazyClient
+type clientInit struct {
+	done chan struct{}
+	c    *client
+	err  error
 }
 
-func (p *Provider) client() (*client, error) {
+// lazyClient returns *slot, building it for serverURL, the setting named
+// field, if it is nil.  *pending, like *slot guarded by p.mu, is the build
+// in progress.  A failed build is not remembered, so the next call tries
+// again.
+func (p *Provider) lazyClient(ctx context.Context, slot **client, pending **clientInit, field, serverURL string) (*client, error) {
 	p.mu.Lock()
-	defer p.mu.Unlock()
-	if p.c == nil {
-		var err error
-		if p.ServerID == "" {
-			p.ServerID = "localhost"
-		}
-		var debug io.Writer
+	if c := *slot; c != nil {
+		p.mu.Unlock()
+		return c, nil
+	}
+	init := *pending
+	if init == nil {
+		init = &clientInit{done: make(chan struct{})}
+		*pending = init
+		go func() {
+			c, err := p.newClient(field, serverURL)
+			p.mu.Lock()
+			init.c, init.err = c, err
+			if err == nil {
+				*slot = c
+			}
+			*pending = nil
+			p.mu.Unlock()
+			close(init.done)
+		}()
+	}
+	p.mu.Unlock()
+
+	select {
+	case <-init.done:
+		return init.c, init.err
+	case <-ctx.Done():
+		return nil, fmt.Errorf("setting up the PowerDNS client: %w", ctx.Err())
+	}
+}
+
+// newClient builds a client for serverURL from the provider settings.
+// field names the setting serverURL comes from in errors.
+func (p *Provider) newClient(field, serverURL string) (*client, error) {
+	serverURL, err := normalizeServerURL(field, serverURL)
+	if err != nil {
+		return nil, err
+	}
+	serverID := p.ServerID
+	if serverID == "" {
+		serverID = "localhost"
+	}
+	if _, err := parseZoneKind(p.DefaultZoneKind); err != nil {
+		return nil, fmt.Errorf("default_zone_kind: %w", err)
+	}
+	debug := p.debugWriter
+	if debug == nil {
 		switch strings.ToLower(p.Debug) {
 		case "stdout", "yes", "true", "1":
 			debug = os.Stdout
 		case "stderr":
 			debug = os.Stderr
 		}
-		p.c, err = newClient(p.ServerID, p.ServerURL, p.APIToken, debug)
+	}
+	httpClient := p.httpClient
+	if p.timeout > 0 {
+		if httpClient == nil {
+			httpClient = http.DefaultClient
+		}
+		withTimeout := *httpClient
+		withTimeout.Timeout = p.timeout
+		httpClient = &withTimeout
+	}
+	token := p.APIToken
+	if p.APITokenFile != "" {
+		if token != "" {
+			return nil, fmt.Errorf("only one of api_token and api_token_file may be set")
+		}
+		raw, err := os.ReadFile(p.APITokenFile)
 		if err != nil {
-			return nil, err
+			return nil, fmt.Errorf("reading api_token_file: %w", err)
 		}
+		token = strings.TrimSpace(string(raw))
+	}
+	maxRetryAfter := p.MaxRetryAfter
+	if maxRetryAfter <= 0 {
+		maxRetryAfter = defaultMaxRetryAfter
+	}
+	var limiter *rate.Limiter
+	if p.RateLimit > 0 {
+		limiter = rate.NewLimiter(p.RateLimit, max(p.Burst, 1))
 	}
-	return p.c, nil
+	return newClient(serverID, serverURL, token, httpClient, debug, p.Logger, p.MaxRetries, maxRetryAfter, limiter, p.UserAgent, p.RequestHook)
 }
 
 // Interface guards
@@ -247,4 +922,5 @@ var (
 	_ libdns.RecordAppender = (*Provider)(nil)
 	_ libdns.RecordSetter   = (*Provider)(nil)
 	_ libdns.RecordDeleter  = (*Provider)(nil)
+	_ libdns.ZoneLister     = (*Provider)(nil)
 )
@@ -0,0 +1,1522 @@
+package powerdns
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/joeig/go-powerdns/v3"
+	"github.com/libdns/libdns"
+)
+
+func TestRecordsWithResults(t *testing.T) {
+	ctx := context.Background()
+	f := newFakePDNS(t)
+	f.AddZone("example.org.",
+		rrset("www.example.org.", "A", 60, "127.0.0.1"),
+		rrset("mail.example.org.", "A", 60, "127.0.0.2", "127.0.0.3"),
+	)
+	p := f.provider()
+
+	type outcome struct {
+		applied bool
+		failed  bool
+	}
+	check := func(t *testing.T, results []RecordResult, want []outcome) {
+		t.Helper()
+		if len(results) != len(want) {
+			t.Fatalf("expected %d results, got %d", len(want), len(results))
+		}
+		for i, r := range results {
+			if r.Applied != want[i].applied || (r.Err != nil) != want[i].failed {
+				t.Errorf("result %d (%s): applied=%v err=%v, want applied=%v failed=%v",
+					i, r.Record.RR().Name, r.Applied, r.Err, want[i].applied, want[i].failed)
+			}
+		}
+	}
+
+	t.Run("append", func(t *testing.T) {
+		results, err := p.AppendRecordsWithResults(ctx, "example.org.", []libdns.Record{
+			libdns.Address{Name: "www", IP: netip.MustParseAddr("127.0.0.1")},
+			libdns.Address{Name: "www", IP: netip.MustParseAddr("127.0.0.9")},
+			libdns.Address{Name: "new", IP: netip.MustParseAddr("127.0.0.10")},
+		})
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		check(t, results, []outcome{{false, false}, {true, false}, {true, false}})
+		if results[0].Record.RR().Name != "www" {
+			t.Errorf("results should carry the input record, got %#v", results[0].Record)
+		}
+	})
+
+	t.Run("append failure is atomic", func(t *testing.T) {
+		results, err := p.AppendRecordsWithResults(ctx, "example.org.", []libdns.Record{
+			libdns.Address{Name: "www", IP: netip.MustParseAddr("127.0.0.20")},
+			libdns.Address{Name: "out.example.net.", IP: netip.MustParseAddr("127.0.0.11")},
+		})
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		check(t, results, []outcome{{false, true}, {false, true}})
+		if got := rrsetContents(f.RRset("example.org.", "www.example.org.", "A")); len(got) != 2 {
+			t.Errorf("zone should be unchanged after a failed batch, got %v", got)
+		}
+	})
+
+	t.Run("set", func(t *testing.T) {
+		results, err := p.SetRecordsWithResults(ctx, "example.org.", []libdns.Record{
+			libdns.Address{Name: "www", IP: netip.MustParseAddr("127.0.0.5")},
+			libdns.Address{Name: "out.example.net.", IP: netip.MustParseAddr("127.0.0.11")},
+		})
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		check(t, results, []outcome{{false, true}, {false, true}})
+
+		results, err = p.SetRecordsWithResults(ctx, "example.org.", []libdns.Record{
+			libdns.Address{Name: "www", IP: netip.MustParseAddr("127.0.0.5")},
+		})
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		check(t, results, []outcome{{true, false}})
+	})
+
+	t.Run("delete", func(t *testing.T) {
+		results, err := p.DeleteRecordsWithResults(ctx, "example.org.", []libdns.Record{
+			libdns.Address{Name: "mail", IP: netip.MustParseAddr("127.0.0.2")},
+			libdns.Address{Name: "mail", IP: netip.MustParseAddr("127.0.0.99")},
+			libdns.Address{Name: "missing", IP: netip.MustParseAddr("127.0.0.1")},
+		})
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		check(t, results, []outcome{{true, false}, {false, false}, {false, false}})
+		if got := rrsetContents(f.RRset("example.org.", "mail.example.org.", "A")); len(got) != 1 || got[0] != "127.0.0.3" {
+			t.Errorf("unexpected remaining contents %v", got)
+		}
+	})
+}
+
+func TestAPITokenFile(t *testing.T) {
+	f := newFakePDNS(t)
+	f.AddZone("example.org.", rrset("www.example.org.", "A", 60, "127.0.0.1"))
+
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	if err := os.WriteFile(tokenFile, []byte("secret\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	p := &Provider{ServerURL: f.URL, APITokenFile: tokenFile}
+	recs, err := p.GetRecords(context.Background(), "example.org.")
+	if err != nil {
+		t.Fatalf("token from file was not accepted: %s", err)
+	}
+	if len(recs) != 1 {
+		t.Errorf("expected 1 record, got %d", len(recs))
+	}
+
+	p = &Provider{ServerURL: f.URL, APIToken: "secret", APITokenFile: tokenFile}
+	if _, err := p.GetRecords(context.Background(), "example.org."); err == nil {
+		t.Errorf("expected an error when both api_token and api_token_file are set")
+	}
+}
+
+func TestGetRecordsDisabled(t *testing.T) {
+	ctx := context.Background()
+	f := newFakePDNS(t)
+	www := rrset("www.example.org.", "A", 60, "127.0.0.1", "127.0.0.2")
+	www.Records[1].Disabled = powerdns.Bool(true)
+	f.AddZone("example.org.", www)
+	p := f.provider()
+
+	recs, err := p.GetRecords(ctx, "example.org.")
+	if err != nil {
+		t.Fatalf("GetRecords: %s", err)
+	}
+	if len(recs) != 1 || recs[0].RR().Data != "127.0.0.1" {
+		t.Errorf("expected only the enabled record, got %v", recs)
+	}
+
+	metas, err := p.GetRecordsWithMeta(ctx, "example.org.")
+	if err != nil {
+		t.Fatalf("GetRecordsWithMeta: %s", err)
+	}
+	if len(metas) != 2 {
+		t.Fatalf("expected 2 records, got %d", len(metas))
+	}
+	if metas[0].Disabled || !metas[1].Disabled || metas[1].Record.RR().Data != "127.0.0.2" {
+		t.Errorf("disabled flag not reported correctly: %#v", metas)
+	}
+}
+
+func TestChangesAreBatched(t *testing.T) {
+	ctx := context.Background()
+	f := newFakePDNS(t)
+	f.AddZone("example.org.", rrset("www.example.org.", "A", 60, "127.0.0.1"))
+	p := f.provider()
+
+	_, err := p.AppendRecords(ctx, "example.org.", []libdns.Record{
+		libdns.Address{Name: "www", IP: netip.MustParseAddr("127.0.0.2")},
+		libdns.Address{Name: "a", IP: netip.MustParseAddr("127.0.0.3")},
+		libdns.Address{Name: "b", IP: netip.MustParseAddr("127.0.0.4")},
+		libdns.TXT{Name: "a", Text: "hello"},
+	})
+	if err != nil {
+		t.Fatalf("AppendRecords: %s", err)
+	}
+	if n := f.CallCount("PATCH", "/zones/example.org."); n != 1 {
+		t.Errorf("expected a single PATCH, got %d", n)
+	}
+	for _, name := range []string{"www", "a", "b"} {
+		if f.RRset("example.org.", name+".example.org.", "A") == nil {
+			t.Errorf("rrset %s A missing after append", name)
+		}
+	}
+	if f.RRset("example.org.", "a.example.org.", "TXT") == nil {
+		t.Errorf("rrset a TXT missing after append")
+	}
+}
+
+func TestNoopWritesAreSkipped(t *testing.T) {
+	ctx := context.Background()
+	f := newFakePDNS(t)
+	f.AddZone("example.org.", rrset("www.example.org.", "A", 60, "127.0.0.1", "127.0.0.2"))
+	p := f.provider()
+	www := func(ttl time.Duration, ips ...string) []libdns.Record {
+		var recs []libdns.Record
+		for _, ip := range ips {
+			recs = append(recs, libdns.Address{Name: "www", IP: netip.MustParseAddr(ip), TTL: ttl})
+		}
+		return recs
+	}
+	patches := func() int { return f.CallCount("PATCH", "/zones/example.org.") }
+
+	added, err := p.AppendRecords(ctx, "example.org.", www(time.Minute, "127.0.0.2"))
+	if err != nil || len(added) != 0 {
+		t.Fatalf("AppendRecords of a present value = %v, %v", added, err)
+	}
+	results, err := p.SetRecordsWithResults(ctx, "example.org.", www(time.Minute, "127.0.0.2", "127.0.0.1"))
+	if err != nil || results[0].Applied || results[1].Applied {
+		t.Errorf("SetRecordsWithResults of the current values = %+v, %v", results, err)
+	}
+	set, err := p.SetRecords(ctx, "example.org.", www(time.Minute, "127.0.0.1", "127.0.0.2"))
+	if err != nil || len(set) != 2 {
+		t.Errorf("SetRecords of the current values = %v, %v; expected them back", set, err)
+	}
+	if _, err := p.DeleteRecords(ctx, "example.org.", www(0, "127.0.0.9")); err != nil {
+		t.Fatalf("DeleteRecords: %s", err)
+	}
+	if n := patches(); n != 0 {
+		t.Fatalf("expected no PATCH for writes that change nothing, got %d", n)
+	}
+
+	// a new TTL alone is a change, and so is enabling a disabled value
+	if _, err := p.AppendRecords(ctx, "example.org.", www(time.Hour, "127.0.0.2")); err != nil {
+		t.Fatalf("AppendRecords: %s", err)
+	}
+	if n := patches(); n != 1 || *f.RRset("example.org.", "www.example.org.", "A").TTL != 3600 {
+		t.Errorf("expected the TTL to be written, %d PATCHes", n)
+	}
+	f.RRset("example.org.", "www.example.org.", "A").Records[0].Disabled = powerdns.Bool(true)
+	if _, err := p.SetRecords(ctx, "example.org.", www(time.Hour, "127.0.0.1", "127.0.0.2")); err != nil {
+		t.Fatalf("SetRecords: %s", err)
+	}
+	if n := patches(); n != 2 {
+		t.Errorf("expected the disabled value to be enabled, %d PATCHes", n)
+	}
+}
+
+func TestDeleteRecordsMulti(t *testing.T) {
+	ctx := context.Background()
+	f := newFakePDNS(t)
+	f.AddZone("example.org.", rrset("www.example.org.", "A", 60, "127.0.0.1", "127.0.0.2"))
+	f.AddZone("example.net.", rrset("www.example.net.", "TXT", 60, `"x"`))
+	p := f.provider()
+
+	www := libdns.Address{Name: "www", IP: netip.MustParseAddr("127.0.0.1")}
+	txt := libdns.TXT{Name: "www", Text: "x"}
+	deleted, err := p.DeleteRecordsMulti(ctx, map[string][]libdns.Record{
+		"example.org.": {www},
+		"missing.org.": {www},
+		"example.net.": {txt},
+	})
+	if !errors.Is(err, ErrZoneNotFound) || !strings.Contains(err.Error(), "missing.org.") {
+		t.Errorf("expected an error for missing.org. wrapping ErrZoneNotFound, got %v", err)
+	}
+	want := map[string][]libdns.Record{"example.org.": {www}, "example.net.": {txt}}
+	if !reflect.DeepEqual(deleted, want) {
+		t.Errorf("DeleteRecordsMulti = %v, want %v", deleted, want)
+	}
+	if got := rrsetContents(f.RRset("example.org.", "www.example.org.", "A")); !reflect.DeepEqual(got, []string{"127.0.0.2"}) {
+		t.Errorf("www.example.org. A = %q", got)
+	}
+	if f.RRset("example.net.", "www.example.net.", "TXT") != nil {
+		t.Errorf("www.example.net. TXT was not deleted")
+	}
+
+	if _, err := p.DeleteRecordsMulti(ctx, map[string][]libdns.Record{"example.org.": {www}}); err != nil {
+		t.Errorf("DeleteRecordsMulti without failures: %s", err)
+	}
+
+	// stopping at the first failing zone leaves the zones after it alone
+	p.MultiZoneStopOnError = true
+	f.AddZone("example.com.", rrset("www.example.com.", "TXT", 60, `"x"`))
+	deleted, err = p.DeleteRecordsMulti(ctx, map[string][]libdns.Record{
+		"example.com.": {txt},
+		"absent.org.":  {www},
+		"example.org.": {libdns.Address{Name: "www", IP: netip.MustParseAddr("127.0.0.2")}},
+	})
+	if !errors.Is(err, ErrZoneNotFound) || !strings.Contains(err.Error(), "absent.org.") {
+		t.Errorf("expected an error for absent.org. wrapping ErrZoneNotFound, got %v", err)
+	}
+	if len(deleted) != 0 {
+		t.Errorf("zones were written after the failing one: %v", deleted)
+	}
+	if f.RRset("example.com.", "www.example.com.", "TXT") == nil || f.RRset("example.org.", "www.example.org.", "A") == nil {
+		t.Error("records were deleted after the failing zone")
+	}
+}
+
+func TestZoneAddressedByName(t *testing.T) {
+	ctx := context.Background()
+	f := newFakePDNS(t)
+	f.AddZone("example.org.", rrset("www.example.org.", "A", 60, "127.0.0.1"))
+	p := f.provider()
+
+	www := []libdns.Record{libdns.Address{Name: "www", IP: netip.MustParseAddr("127.0.0.2")}}
+	if _, err := p.GetRecords(ctx, "example.org."); err != nil {
+		t.Fatalf("GetRecords: %s", err)
+	}
+	if _, err := p.AppendRecords(ctx, "example.org.", www); err != nil {
+		t.Fatalf("AppendRecords: %s", err)
+	}
+	if _, err := p.SetRecords(ctx, "example.org.", www); err != nil {
+		t.Fatalf("SetRecords: %s", err)
+	}
+	if _, err := p.DeleteRecords(ctx, "example.org.", www); err != nil {
+		t.Fatalf("DeleteRecords: %s", err)
+	}
+	if _, err := p.GetMetadata(ctx, "example.org.", "SOA-EDIT-API"); err != nil {
+		t.Fatalf("GetMetadata: %s", err)
+	}
+	// the name is the zone's ID, so the zones are never listed to find it
+	for _, c := range f.Calls {
+		if !strings.HasSuffix(c, "/zones/example.org.") && !strings.HasSuffix(c, "/zones/example.org./metadata/SOA-EDIT-API") {
+			t.Errorf("unexpected request %s", c)
+		}
+	}
+	if n := f.CallCount("GET", "/zones/example.org."); n != 6 {
+		t.Errorf("expected a GET for each call and another to read back appended and set records, got %d", n)
+	}
+}
+
+func TestSetRecordsReplacesRRset(t *testing.T) {
+	ctx := context.Background()
+	f := newFakePDNS(t)
+	f.AddZone("example.org.",
+		rrset("www.example.org.", "A", 60, "127.0.0.1", "127.0.0.2", "127.0.0.3"),
+		rrset("www.example.org.", "TXT", 60, `"keep me"`),
+		rrset("other.example.org.", "A", 60, "127.0.0.4"),
+	)
+	p := f.provider()
+
+	_, err := p.SetRecords(ctx, "example.org.", []libdns.Record{
+		libdns.Address{Name: "www", IP: netip.MustParseAddr("127.0.0.2"), TTL: 120 * time.Second},
+		libdns.Address{Name: "www", IP: netip.MustParseAddr("127.0.0.9"), TTL: 120 * time.Second},
+	})
+	if err != nil {
+		t.Fatalf("SetRecords: %s", err)
+	}
+
+	www := f.RRset("example.org.", "www.example.org.", "A")
+	if got := rrsetContents(www); !reflect.DeepEqual(got, []string{"127.0.0.2", "127.0.0.9"}) {
+		t.Errorf("expected exactly the input values, got %v", got)
+	}
+	if ttl := powerdns.Uint32Value(www.TTL); ttl != 120 {
+		t.Errorf("expected TTL 120, got %d", ttl)
+	}
+	if got := rrsetContents(f.RRset("example.org.", "www.example.org.", "TXT")); !reflect.DeepEqual(got, []string{`"keep me"`}) {
+		t.Errorf("rrset of another type at the same name was touched: %v", got)
+	}
+	if got := rrsetContents(f.RRset("example.org.", "other.example.org.", "A")); !reflect.DeepEqual(got, []string{"127.0.0.4"}) {
+		t.Errorf("rrset at another name was touched: %v", got)
+	}
+}
+
+func TestGetRecordsPreservesOrder(t *testing.T) {
+	ctx := context.Background()
+	f := newFakePDNS(t)
+	stored := []string{"127.0.0.9", "127.0.0.1", "127.0.0.5", "127.0.0.3", "127.0.0.7"}
+	f.AddZone("example.org.", rrset("www.example.org.", "A", 60, stored...))
+	p := f.provider()
+
+	for i := 0; i < 5; i++ {
+		recs, err := p.GetRecords(ctx, "example.org.")
+		if err != nil {
+			t.Fatalf("GetRecords: %s", err)
+		}
+		var have []string
+		for _, r := range recs {
+			have = append(have, r.RR().Data)
+		}
+		if !reflect.DeepEqual(have, stored) {
+			t.Fatalf("call %d: records not in stored order: have %v want %v", i, have, stored)
+		}
+	}
+}
+
+func TestAppendIsDeterministic(t *testing.T) {
+	ctx := context.Background()
+	var records []libdns.Record
+	for i := 20; i > 0; i-- {
+		records = append(records, libdns.Address{Name: fmt.Sprintf("host%d", i), IP: netip.AddrFrom4([4]byte{127, 0, 1, byte(i)})})
+	}
+	for _, ip := range []string{"127.0.0.4", "127.0.0.1", "127.0.0.2", "127.0.0.4"} {
+		records = append(records, libdns.Address{Name: "www", IP: netip.MustParseAddr(ip)})
+	}
+
+	var patches [][]powerdns.RRset
+	var results [][]libdns.Record
+	for i := 0; i < 2; i++ {
+		f := newFakePDNS(t)
+		f.AddZone("example.org.", rrset("www.example.org.", "A", 60, "127.0.0.9", "127.0.0.1"))
+		added, err := f.provider().AppendRecords(ctx, "example.org.", records)
+		if err != nil {
+			t.Fatalf("AppendRecords: %s", err)
+		}
+		patches = append(patches, f.Patches...)
+		results = append(results, added)
+	}
+	if !reflect.DeepEqual(patches[0], patches[1]) || !reflect.DeepEqual(results[0], results[1]) {
+		t.Fatalf("the same append gave different requests or results")
+	}
+	for i, rs := range patches[0][:20] {
+		if want := fmt.Sprintf("host%d.example.org.", 20-i); *rs.Name != want {
+			t.Errorf("rrset %d of the PATCH is %s, want %s in input order", i, *rs.Name, want)
+		}
+	}
+	var www []string
+	for _, r := range patches[0][20].Records {
+		www = append(www, *r.Content)
+	}
+	if want := []string{"127.0.0.9", "127.0.0.1", "127.0.0.4", "127.0.0.2"}; !reflect.DeepEqual(www, want) {
+		t.Errorf("merged www A = %q, want the existing values followed by the new ones: %q", www, want)
+	}
+}
+
+func TestServiceBindingRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	f := newFakePDNS(t)
+	f.AddZone("example.org.")
+	// a record written by older versions without the _https label
+	f.AddZone("legacy.org.", rrset("_8443.www.legacy.org.", "HTTPS", 60, "1 . alpn=h2"))
+	p := f.provider()
+
+	input := []libdns.Record{
+		libdns.ServiceBinding{
+			Name: "www", Scheme: "https", TTL: 60 * time.Second, Priority: 1, Target: "cdn.example.net.",
+			Params: libdns.SvcParams{"alpn": {"h2", "h3"}, "ech": {"AEX+DQBB"}},
+		},
+		libdns.ServiceBinding{
+			Name: "alt", Scheme: "https", URLSchemePort: 8443, TTL: 60 * time.Second, Priority: 1, Target: ".",
+			Params: libdns.SvcParams{"alpn": {"h2"}},
+		},
+		libdns.ServiceBinding{
+			Name: "@", Scheme: "dns", TTL: 60 * time.Second, Priority: 1, Target: "dns.example.org.",
+			Params: libdns.SvcParams{"port": {"853"}},
+		},
+	}
+	if _, err := p.AppendRecords(ctx, "example.org.", input); err != nil {
+		t.Fatalf("AppendRecords: %s", err)
+	}
+
+	recs, err := p.GetRecords(ctx, "example.org.")
+	if err != nil {
+		t.Fatalf("GetRecords: %s", err)
+	}
+	if len(recs) != len(input) {
+		t.Fatalf("expected %d records, got %d: %v", len(input), len(recs), recs)
+	}
+	for i, rec := range recs {
+		if !reflect.DeepEqual(rec, input[i]) {
+			t.Errorf("record %d did not round trip:\nhave %#v\nwant %#v", i, rec, input[i])
+		}
+	}
+
+	recs, err = p.GetRecords(ctx, "legacy.org.")
+	if err != nil {
+		t.Fatalf("GetRecords on legacy names: %s", err)
+	}
+	if sb, ok := recs[0].(libdns.ServiceBinding); !ok || sb.URLSchemePort != 8443 || sb.Name != "www" {
+		t.Errorf("legacy HTTPS name not decoded: %#v", recs[0])
+	}
+}
+
+func TestCommentsArePreserved(t *testing.T) {
+	ctx := context.Background()
+	f := newFakePDNS(t)
+	www := rrset("www.example.org.", "A", 60, "127.0.0.1")
+	www.Comments = []powerdns.Comment{{Content: powerdns.String("TICKET-123"), Account: powerdns.String("ops")}}
+	f.AddZone("example.org.", www)
+	p := f.provider()
+	checkComment := func(t *testing.T, op string) {
+		t.Helper()
+		rs := f.RRset("example.org.", "www.example.org.", "A")
+		if len(rs.Comments) != 1 || powerdns.StringValue(rs.Comments[0].Content) != "TICKET-123" {
+			t.Errorf("comment lost after %s: %#v", op, rs.Comments)
+		}
+	}
+
+	if _, err := p.AppendRecords(ctx, "example.org.", []libdns.Record{
+		libdns.Address{Name: "www", IP: netip.MustParseAddr("127.0.0.2")},
+	}); err != nil {
+		t.Fatalf("AppendRecords: %s", err)
+	}
+	checkComment(t, "append")
+
+	if _, err := p.SetRecords(ctx, "example.org.", []libdns.Record{
+		libdns.Address{Name: "www", IP: netip.MustParseAddr("127.0.0.3")},
+	}); err != nil {
+		t.Fatalf("SetRecords: %s", err)
+	}
+	checkComment(t, "set")
+
+	if _, err := p.AppendRecords(ctx, "example.org.", []libdns.Record{
+		libdns.Address{Name: "www", IP: netip.MustParseAddr("127.0.0.4")},
+	}); err != nil {
+		t.Fatalf("AppendRecords: %s", err)
+	}
+	if _, err := p.DeleteRecords(ctx, "example.org.", []libdns.Record{
+		libdns.Address{Name: "www", IP: netip.MustParseAddr("127.0.0.3")},
+	}); err != nil {
+		t.Fatalf("DeleteRecords: %s", err)
+	}
+	checkComment(t, "delete")
+}
+
+func TestEmptyTXT(t *testing.T) {
+	ctx := context.Background()
+	f := newFakePDNS(t)
+	f.AddZone("example.org.")
+	p := f.provider()
+
+	if _, err := p.AppendRecords(ctx, "example.org.", []libdns.Record{
+		libdns.TXT{Name: "empty", Text: "", TTL: time.Minute},
+	}); err != nil {
+		t.Fatalf("AppendRecords: %s", err)
+	}
+	if got := rrsetContents(f.RRset("example.org.", "empty.example.org.", "TXT")); !reflect.DeepEqual(got, []string{`""`}) {
+		t.Errorf("expected an empty quoted string to be stored, got %q", got)
+	}
+
+	recs, err := p.GetRecords(ctx, "example.org.")
+	if err != nil {
+		t.Fatalf("GetRecords: %s", err)
+	}
+	want := []libdns.Record{libdns.TXT{Name: "empty", Text: "", TTL: time.Minute}}
+	if !reflect.DeepEqual(recs, want) {
+		t.Errorf("have %#v want %#v", recs, want)
+	}
+}
+
+func TestAliasRecords(t *testing.T) {
+	ctx := context.Background()
+	f := newFakePDNS(t)
+	f.AddZone("example.org.", rrset("example.org.", "NS", 3600, "ns1.example.net."))
+	p := f.provider()
+
+	if _, err := p.SetRecords(ctx, "example.org.", []libdns.Record{
+		libdns.RR{Name: "@", Type: "ALIAS", Data: "lb.example.net", TTL: time.Minute},
+	}); err != nil {
+		t.Fatalf("SetRecords: %s", err)
+	}
+	if got := rrsetContents(f.RRset("example.org.", "example.org.", "ALIAS")); !reflect.DeepEqual(got, []string{"lb.example.net."}) {
+		t.Errorf("ALIAS target not made fully qualified: %v", got)
+	}
+
+	recs, err := p.GetRecords(ctx, "example.org.")
+	if err != nil {
+		t.Fatalf("GetRecords: %s", err)
+	}
+	want := libdns.RR{Name: "@", Type: "ALIAS", Data: "lb.example.net.", TTL: time.Minute}
+	if len(recs) != 2 || !reflect.DeepEqual(recs[1], want) {
+		t.Errorf("ALIAS not returned as RR: %#v", recs)
+	}
+}
+
+func TestDefaultTTL(t *testing.T) {
+	ctx := context.Background()
+	f := newFakePDNS(t)
+	f.AddZone("example.org.")
+	p := f.provider()
+	ttlOf := func(name, rrType string) uint32 {
+		return powerdns.Uint32Value(f.RRset("example.org.", name, rrType).TTL)
+	}
+
+	if _, err := p.AppendRecords(ctx, "example.org.", []libdns.Record{
+		libdns.Address{Name: "a", IP: netip.MustParseAddr("127.0.0.1")},
+		libdns.ServiceBinding{Name: "a", Scheme: "https", Priority: 1, Target: "."},
+	}); err != nil {
+		t.Fatalf("AppendRecords: %s", err)
+	}
+	if ttl := ttlOf("a.example.org.", "A"); ttl != 300 {
+		t.Errorf("expected fallback TTL 300, got %d", ttl)
+	}
+	if ttl := ttlOf("a.example.org.", "HTTPS"); ttl != 300 {
+		t.Errorf("expected fallback TTL 300 for HTTPS, got %d", ttl)
+	}
+
+	p.DefaultTTL = time.Hour
+	if _, err := p.SetRecords(ctx, "example.org.", []libdns.Record{
+		libdns.Address{Name: "b", IP: netip.MustParseAddr("127.0.0.2")},
+		libdns.Address{Name: "c", IP: netip.MustParseAddr("127.0.0.3"), TTL: time.Minute},
+	}); err != nil {
+		t.Fatalf("SetRecords: %s", err)
+	}
+	if ttl := ttlOf("b.example.org.", "A"); ttl != 3600 {
+		t.Errorf("expected DefaultTTL 3600, got %d", ttl)
+	}
+	if ttl := ttlOf("c.example.org.", "A"); ttl != 60 {
+		t.Errorf("explicit TTL was overridden: %d", ttl)
+	}
+
+	// appending without a TTL keeps the TTL of the existing rrset
+	if _, err := p.AppendRecords(ctx, "example.org.", []libdns.Record{
+		libdns.Address{Name: "c", IP: netip.MustParseAddr("127.0.0.5")},
+	}); err != nil {
+		t.Fatalf("AppendRecords: %s", err)
+	}
+	if ttl := ttlOf("c.example.org.", "A"); ttl != 60 {
+		t.Errorf("appending without a TTL changed the rrset's TTL to %d", ttl)
+	}
+
+	// a TTL under a second is not zero, so it is kept, rounded up
+	if _, err := p.SetRecords(ctx, "example.org.", []libdns.Record{
+		libdns.Address{Name: "d", IP: netip.MustParseAddr("127.0.0.4"), TTL: 500 * time.Millisecond},
+	}); err != nil {
+		t.Fatalf("SetRecords: %s", err)
+	}
+	if ttl := ttlOf("d.example.org.", "A"); ttl != 1 {
+		t.Errorf("expected a 500ms TTL to be stored as 1, got %d", ttl)
+	}
+}
+
+func TestReadURL(t *testing.T) {
+	ctx := context.Background()
+	primary := newFakePDNS(t)
+	primary.AddZone("example.org.", rrset("www.example.org.", "A", 60, "127.0.0.1"))
+	replica := newFakePDNS(t)
+	replica.AddZone("example.org.", rrset("www.example.org.", "A", 60, "127.0.0.1"))
+	p := primary.provider()
+	p.ReadURL = replica.URL
+
+	if _, err := p.GetRecords(ctx, "example.org."); err != nil {
+		t.Fatalf("GetRecords: %s", err)
+	}
+	if _, err := p.GetZoneInfo(ctx, "example.org."); err != nil {
+		t.Fatalf("GetZoneInfo: %s", err)
+	}
+	if n := replica.CallCount("GET", "/zones/example.org."); n != 2 {
+		t.Errorf("expected 2 reads on the replica, got %d", n)
+	}
+	if n := primary.CallCount("GET", "/zones/example.org."); n != 0 {
+		t.Errorf("expected no reads on the primary, got %d", n)
+	}
+
+	if _, err := p.AppendRecords(ctx, "example.org.", []libdns.Record{
+		libdns.Address{Name: "www", IP: netip.MustParseAddr("127.0.0.2")},
+	}); err != nil {
+		t.Fatalf("AppendRecords: %s", err)
+	}
+	if n := primary.CallCount("PATCH", "/zones/example.org."); n != 1 {
+		t.Errorf("expected the change on the primary, got %d PATCHes", n)
+	}
+	if n := replica.CallCount("PATCH", "/zones/example.org."); n != 0 {
+		t.Errorf("replica received %d PATCHes", n)
+	}
+}
+
+func TestLoggerRedactsToken(t *testing.T) {
+	f := newFakePDNS(t)
+	f.AddZone("example.org.")
+	var logs strings.Builder
+	p := f.provider()
+	p.Debug = "stdout" // must be ignored in favour of the logger
+	p.Logger = slog.New(slog.NewTextHandler(&logs, &slog.HandlerOptions{Level: slog.LevelDebug}))
+
+	if _, err := p.GetRecords(context.Background(), "example.org."); err != nil {
+		t.Fatalf("GetRecords: %s", err)
+	}
+	out := logs.String()
+	if !strings.Contains(out, "powerdns request") || !strings.Contains(out, "powerdns response") {
+		t.Fatalf("request and response were not logged:\n%s", out)
+	}
+	if strings.Contains(out, "secret") {
+		t.Errorf("API token leaked into the log:\n%s", out)
+	}
+	if !strings.Contains(out, "X-Api-Key: REDACTED") {
+		t.Errorf("API key header not masked:\n%s", out)
+	}
+}
+
+func TestGetRecordsByTypes(t *testing.T) {
+	f := newFakePDNS(t)
+	f.AddZone("example.org.",
+		rrset("example.org.", "NS", 3600, "ns1.example.net."),
+		rrset("www.example.org.", "A", 60, "127.0.0.1"),
+		rrset("www.example.org.", "AAAA", 60, "::1"),
+		rrset("www.example.org.", "TXT", 60, `"hello"`),
+		rrset("mail.example.org.", "A", 60, "127.0.0.2"),
+	)
+	p := f.provider()
+
+	recs, err := p.GetRecordsByTypes(context.Background(), "example.org.", []string{"A", "txt"})
+	if err != nil {
+		t.Fatalf("GetRecordsByTypes: %s", err)
+	}
+	var have []string
+	for _, r := range recs {
+		have = append(have, r.RR().Name+" "+r.RR().Type)
+	}
+	want := []string{"www A", "www TXT", "mail A"}
+	if !reflect.DeepEqual(have, want) {
+		t.Errorf("have %v want %v", have, want)
+	}
+}
+
+func TestNormalizeZoneCase(t *testing.T) {
+	ctx := context.Background()
+	f := newFakePDNS(t)
+	f.AddZone("example.org.", rrset("www.example.org.", "A", 60, "127.0.0.1"))
+	p := f.provider()
+
+	recs, err := p.GetRecords(ctx, "Example.ORG.")
+	if err != nil {
+		t.Fatalf("GetRecords with a mixed-case zone: %s", err)
+	}
+	if len(recs) != 1 || recs[0].RR().Name != "www" {
+		t.Errorf("names not relative to the zone: %v", recs)
+	}
+	if _, err := p.AppendRecords(ctx, "Example.ORG.", []libdns.Record{
+		libdns.Address{Name: "new", IP: netip.MustParseAddr("127.0.0.2")},
+	}); err != nil {
+		t.Fatalf("AppendRecords with a mixed-case zone: %s", err)
+	}
+	if f.RRset("example.org.", "new.example.org.", "A") == nil {
+		t.Errorf("record not added to example.org.")
+	}
+
+	off := false
+	p.NormalizeZoneCase = &off
+	if _, err := p.GetRecords(ctx, "Example.ORG."); err == nil {
+		t.Errorf("expected the mixed-case zone not to be found with NormalizeZoneCase off")
+	}
+}
+
+func TestTTLRoundTrip(t *testing.T) {
+	f := newFakePDNS(t)
+	f.AddZone("example.org.",
+		rrset("zero.example.org.", "A", 0, "127.0.0.1"),
+		rrset("week.example.org.", "A", 604800, "127.0.0.2"),
+		rrset("max.example.org.", "A", 2147483647, "127.0.0.3"),
+	)
+	p := f.provider()
+
+	recs, err := p.GetRecords(context.Background(), "example.org.")
+	if err != nil {
+		t.Fatalf("GetRecords: %s", err)
+	}
+	want := []time.Duration{0, 604800 * time.Second, 2147483647 * time.Second}
+	if len(recs) != len(want) {
+		t.Fatalf("expected %d records, got %d", len(want), len(recs))
+	}
+	for i, r := range recs {
+		if ttl := r.RR().TTL; ttl != want[i] {
+			t.Errorf("%s: TTL %s, want %s", r.RR().Name, ttl, want[i])
+		}
+	}
+}
+
+func TestTTLWriteRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	f := newFakePDNS(t)
+	f.AddZone("example.org.")
+	p := f.provider()
+
+	in := []libdns.Record{libdns.Address{Name: "week", IP: netip.MustParseAddr("127.0.0.1"), TTL: 604800 * time.Second}}
+	if _, err := p.SetRecords(ctx, "example.org.", in); err != nil {
+		t.Fatalf("SetRecords: %s", err)
+	}
+	recs, err := p.GetRecords(ctx, "example.org.")
+	if err != nil {
+		t.Fatalf("GetRecords: %s", err)
+	}
+	if !reflect.DeepEqual(recs, in) {
+		t.Errorf("have %#v want %#v", recs, in)
+	}
+}
+
+func TestApexNames(t *testing.T) {
+	ctx := context.Background()
+	for _, zone := range []string{"example.org.", "example.org"} {
+		f := newFakePDNS(t)
+		f.AddZone("example.org.")
+		p := f.provider()
+
+		if _, err := p.AppendRecords(ctx, zone, []libdns.Record{
+			libdns.TXT{Name: "@", Text: "at"},
+			libdns.TXT{Name: "", Text: "empty"},
+			libdns.ServiceBinding{Name: "", Scheme: "https", URLSchemePort: 8443, Priority: 1, Target: "."},
+		}); err != nil {
+			t.Fatalf("%s: AppendRecords: %s", zone, err)
+		}
+		if got := rrsetContents(f.RRset("example.org.", "example.org.", "TXT")); !reflect.DeepEqual(got, []string{`"at"`, `"empty"`}) {
+			t.Errorf("%s: apex TXT records not at the apex: %v", zone, got)
+		}
+		if f.RRset("example.org.", "_8443._https.example.org.", "HTTPS") == nil {
+			t.Errorf("%s: apex HTTPS record on a port not below the apex", zone)
+		}
+		for name := range f.Zones["example.org."].RRsets {
+			if n := powerdns.StringValue(f.Zones["example.org."].RRsets[name].Name); strings.Contains(n, "..") {
+				t.Errorf("%s: malformed name %q", zone, n)
+			}
+		}
+
+		recs, err := p.GetRecords(ctx, zone)
+		if err != nil {
+			t.Fatalf("%s: GetRecords: %s", zone, err)
+		}
+		var apex int
+		for _, r := range recs {
+			if r.RR().Type == "TXT" {
+				if r.RR().Name != "@" {
+					t.Errorf("%s: apex TXT read back with name %q", zone, r.RR().Name)
+				}
+				apex++
+			}
+		}
+		if apex != 2 {
+			t.Errorf("%s: expected 2 apex TXT records, got %d", zone, apex)
+		}
+	}
+}
+
+func TestMXRecords(t *testing.T) {
+	ctx := context.Background()
+	f := newFakePDNS(t)
+	f.AddZone("example.org.")
+	p := f.provider()
+
+	if _, err := p.AppendRecords(ctx, "example.org.", []libdns.Record{
+		libdns.MX{Name: "@", Preference: 10, Target: "mail.example.net."},
+		libdns.MX{Name: "@", Preference: 20, Target: "backup"},
+		libdns.MX{Name: "null", Preference: 0, Target: "."},
+	}); err != nil {
+		t.Fatalf("AppendRecords: %s", err)
+	}
+	if got := rrsetContents(f.RRset("example.org.", "example.org.", "MX")); !reflect.DeepEqual(got, []string{"10 mail.example.net.", "20 backup.example.org."}) {
+		t.Errorf("unexpected MX contents %v", got)
+	}
+	if got := rrsetContents(f.RRset("example.org.", "null.example.org.", "MX")); !reflect.DeepEqual(got, []string{"0 ."}) {
+		t.Errorf("unexpected null MX contents %v", got)
+	}
+
+	recs, err := p.GetRecords(ctx, "example.org.")
+	if err != nil {
+		t.Fatalf("GetRecords: %s", err)
+	}
+	var mxs []libdns.MX
+	for _, r := range recs {
+		if mx, ok := r.(libdns.MX); ok && mx.Name == "@" {
+			mxs = append(mxs, mx)
+		}
+	}
+	if len(mxs) != 2 || mxs[0].Preference != 10 || mxs[0].Target != "mail.example.net." ||
+		mxs[1].Preference != 20 || mxs[1].Target != "backup.example.org." {
+		t.Errorf("unexpected MX records read back: %#v", mxs)
+	}
+}
+
+func TestSRVRecords(t *testing.T) {
+	ctx := context.Background()
+	f := newFakePDNS(t)
+	f.AddZone("example.org.")
+	p := f.provider()
+
+	in := []libdns.Record{
+		libdns.SRV{Service: "sip", Transport: "tcp", Name: "@", Priority: 10, Weight: 60, Port: 5060, Target: "sip.example.net."},
+		libdns.SRV{Service: "sip", Transport: "tcp", Name: "", Priority: 20, Weight: 0, Port: 5060, Target: "backup"},
+		libdns.SRV{Service: "imap", Transport: "tcp", Name: "mail", Priority: 0, Weight: 0, Port: 0, Target: "."},
+	}
+	if _, err := p.AppendRecords(ctx, "example.org.", in); err != nil {
+		t.Fatalf("AppendRecords: %s", err)
+	}
+	if got := rrsetContents(f.RRset("example.org.", "_sip._tcp.example.org.", "SRV")); !reflect.DeepEqual(got, []string{"10 60 5060 sip.example.net.", "20 0 5060 backup.example.org."}) {
+		t.Errorf("unexpected SRV contents %v", got)
+	}
+	if got := rrsetContents(f.RRset("example.org.", "_imap._tcp.mail.example.org.", "SRV")); !reflect.DeepEqual(got, []string{"0 0 0 ."}) {
+		t.Errorf("unexpected SRV contents for the root target %v", got)
+	}
+
+	recs, err := p.GetRecords(ctx, "example.org.")
+	if err != nil {
+		t.Fatalf("GetRecords: %s", err)
+	}
+	var srvs []libdns.SRV
+	for _, r := range recs {
+		if srv, ok := r.(libdns.SRV); ok {
+			srvs = append(srvs, srv)
+		}
+	}
+	want := []libdns.SRV{
+		{Service: "sip", Transport: "tcp", Name: "@", TTL: defaultTTL, Priority: 10, Weight: 60, Port: 5060, Target: "sip.example.net."},
+		{Service: "sip", Transport: "tcp", Name: "@", TTL: defaultTTL, Priority: 20, Weight: 0, Port: 5060, Target: "backup.example.org."},
+		{Service: "imap", Transport: "tcp", Name: "mail", TTL: defaultTTL, Priority: 0, Weight: 0, Port: 0, Target: "."},
+	}
+	if !reflect.DeepEqual(srvs, want) {
+		t.Errorf("SRV round trip:\nhave %#v\nwant %#v", srvs, want)
+	}
+}
+
+func TestTXTRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	f := newFakePDNS(t)
+	f.AddZone("example.org.")
+	p := f.provider()
+
+	// the cases of the integration test, as written and as read back
+	for _, tst := range []struct {
+		text, stored, read string
+	}{
+		{`This is text`, `"This is text"`, `This is text`},
+		{`"This is also some text"`, `"This is also some text"`, `This is also some text`},
+		{`This is some weird text that isn't quoted`, `"This is some weird text that isn't quoted"`, `This is some weird text that isn't quoted`},
+		{`This is some weird text that "has embedded quoting"`, `"This is some weird text that \"has embedded quoting\""`, `This is some weird text that "has embedded quoting"`},
+		{`ç is equal to \195\167`, `"ç is equal to \195\167"`, `ç is equal to \195\167`},
+		{``, `""`, ``},
+	} {
+		if _, err := p.SetRecords(ctx, "example.org.", []libdns.Record{libdns.TXT{Name: "txt", Text: tst.text}}); err != nil {
+			t.Fatalf("SetRecords(%s): %s", tst.text, err)
+		}
+		if got := rrsetContents(f.RRset("example.org.", "txt.example.org.", "TXT")); !reflect.DeepEqual(got, []string{tst.stored}) {
+			t.Errorf("%s: stored as %q, want %q", tst.text, got, tst.stored)
+		}
+		recs, err := p.GetRecordsByTypes(ctx, "example.org.", []string{"TXT"})
+		if err != nil {
+			t.Fatalf("GetRecords: %s", err)
+		}
+		if len(recs) != 1 || recs[0].(libdns.TXT).Text != tst.read {
+			t.Errorf("%s: read back as %#v, want %q", tst.text, recs, tst.read)
+			continue
+		}
+		// writing back what was read changes nothing
+		if _, err := p.SetRecords(ctx, "example.org.", recs); err != nil {
+			t.Fatalf("SetRecords: %s", err)
+		}
+		if got := rrsetContents(f.RRset("example.org.", "txt.example.org.", "TXT")); !reflect.DeepEqual(got, []string{tst.stored}) {
+			t.Errorf("%s: writing back the read text stored %q", tst.text, got)
+		}
+	}
+}
+
+func TestDeleteWholeRRset(t *testing.T) {
+	ctx := context.Background()
+	f := newFakePDNS(t)
+	f.AddZone("example.org.",
+		rrset("www.example.org.", "A", 60, "192.0.2.1", "192.0.2.2", "192.0.2.3"),
+		rrset("txt.example.org.", "TXT", 60, `""`, `"keep"`),
+		rrset("all.example.org.", "TXT", 60, `""`, `"gone"`),
+	)
+	p := f.provider()
+
+	// a value deletes only that value
+	if _, err := p.DeleteRecords(ctx, "example.org.", []libdns.Record{
+		libdns.RR{Name: "www", Type: "A", Data: "192.0.2.2"},
+	}); err != nil {
+		t.Fatalf("DeleteRecords: %s", err)
+	}
+	if got := rrsetContents(f.RRset("example.org.", "www.example.org.", "A")); !reflect.DeepEqual(got, []string{"192.0.2.1", "192.0.2.3"}) {
+		t.Errorf("deleting a value left %q", got)
+	}
+
+	// an empty TXT is a value like any other
+	if _, err := p.DeleteRecords(ctx, "example.org.", []libdns.Record{
+		libdns.TXT{Name: "txt", Text: ""},
+	}); err != nil {
+		t.Fatalf("DeleteRecords: %s", err)
+	}
+	if got := rrsetContents(f.RRset("example.org.", "txt.example.org.", "TXT")); !reflect.DeepEqual(got, []string{`"keep"`}) {
+		t.Errorf("deleting an empty TXT left %q", got)
+	}
+
+	// no data at all deletes the rrset
+	results, err := p.DeleteRecordsWithResults(ctx, "example.org.", []libdns.Record{
+		libdns.RR{Name: "www", Type: "A"},
+		libdns.RR{Name: "all", Type: "TXT"},
+		libdns.RR{Name: "missing", Type: "A"},
+	})
+	if err != nil {
+		t.Fatalf("DeleteRecordsWithResults: %s", err)
+	}
+	for _, name := range []string{"www.example.org.", "all.example.org."} {
+		if rs := f.RRset("example.org.", name, "A"); rs != nil {
+			t.Errorf("%s A should be gone, have %q", name, rrsetContents(rs))
+		}
+		if rs := f.RRset("example.org.", name, "TXT"); rs != nil {
+			t.Errorf("%s TXT should be gone, have %q", name, rrsetContents(rs))
+		}
+	}
+	if !results[0].Applied || !results[1].Applied || results[2].Applied {
+		t.Errorf("unexpected results %#v", results)
+	}
+	if got := rrsetContents(f.RRset("example.org.", "txt.example.org.", "TXT")); !reflect.DeepEqual(got, []string{`"keep"`}) {
+		t.Errorf("an unrelated rrset changed: %q", got)
+	}
+}
+
+func TestAppendReturnsAdded(t *testing.T) {
+	ctx := context.Background()
+	f := newFakePDNS(t)
+	f.AddZone("example.org.", rrset("www.example.org.", "A", 60, "192.0.2.1"))
+	p := f.provider()
+
+	existing := libdns.Address{Name: "www", IP: netip.MustParseAddr("192.0.2.1"), TTL: time.Minute}
+	added, err := p.AppendRecords(ctx, "example.org.", []libdns.Record{existing})
+	if err != nil {
+		t.Fatalf("AppendRecords: %s", err)
+	}
+	if len(added) != 0 {
+		t.Errorf("appending an existing value returned %#v", added)
+	}
+
+	fresh := libdns.Address{Name: "www", IP: netip.MustParseAddr("192.0.2.2"), TTL: time.Minute}
+	added, err = p.AppendRecords(ctx, "example.org.", []libdns.Record{existing, fresh, fresh})
+	if err != nil {
+		t.Fatalf("AppendRecords: %s", err)
+	}
+	if want := []libdns.Record{fresh}; !reflect.DeepEqual(added, want) {
+		t.Errorf("have %#v want %#v", added, want)
+	}
+	if got := rrsetContents(f.RRset("example.org.", "www.example.org.", "A")); !reflect.DeepEqual(got, []string{"192.0.2.1", "192.0.2.2"}) {
+		t.Errorf("stored %q", got)
+	}
+}
+
+func TestWritesReturnStoredRecords(t *testing.T) {
+	ctx := context.Background()
+	f := newFakePDNS(t)
+	f.AddZone("example.org.", rrset("txt.example.org.", "TXT", 60, `"old"`))
+	p := f.provider()
+	p.DefaultTTL = 10 * time.Minute
+
+	added, err := p.AppendRecords(ctx, "example.org.", []libdns.Record{
+		libdns.TXT{Name: "TXT", Text: `"quoted"`},
+	})
+	if err != nil {
+		t.Fatalf("AppendRecords: %s", err)
+	}
+	// the rrset keeps its TTL rather than getting DefaultTTL
+	want := []libdns.Record{libdns.TXT{Name: "txt", Text: "quoted", TTL: time.Minute}}
+	if !reflect.DeepEqual(added, want) {
+		t.Errorf("AppendRecords: have %#v want %#v", added, want)
+	}
+
+	set, err := p.SetRecords(ctx, "example.org.", []libdns.Record{
+		libdns.TXT{Name: "txt", Text: `"quoted"`, TTL: time.Hour},
+		libdns.TXT{Name: "txt", Text: `with "inner" quotes`, TTL: time.Hour},
+	})
+	if err != nil {
+		t.Fatalf("SetRecords: %s", err)
+	}
+	want = []libdns.Record{
+		libdns.TXT{Name: "txt", Text: "quoted", TTL: time.Hour},
+		libdns.TXT{Name: "txt", Text: `with "inner" quotes`, TTL: time.Hour},
+	}
+	if !reflect.DeepEqual(set, want) {
+		t.Errorf("SetRecords: have %#v want %#v", set, want)
+	}
+}
+
+func TestGetRecordsFiltered(t *testing.T) {
+	ctx := context.Background()
+	for _, old := range []bool{false, true} {
+		f := newFakePDNS(t)
+		f.NoRRsetFilter = old
+		f.AddZone("example.org.",
+			rrset("example.org.", "A", 60, "192.0.2.1"),
+			rrset("www.example.org.", "A", 60, "192.0.2.2"),
+			rrset("www.example.org.", "AAAA", 60, "2001:db8::2"),
+			rrset("mail.example.org.", "A", 60, "192.0.2.3"),
+		)
+		p := f.provider()
+
+		for _, tc := range []struct {
+			opts  FilterOptions
+			query string
+			want  []string
+		}{
+			{FilterOptions{Name: "www"}, "rrset_name=www.example.org.", []string{"www A", "www AAAA"}},
+			{FilterOptions{Name: "@"}, "rrset_name=example.org.", []string{"@ A"}},
+			{FilterOptions{Type: "a"}, "", []string{"@ A", "www A", "mail A"}},
+			{FilterOptions{Name: "WWW.example.org.", Type: "A"}, "rrset_name=www.example.org.&rrset_type=A", []string{"www A"}},
+			{FilterOptions{Name: "missing", Type: "A"}, "rrset_name=missing.example.org.&rrset_type=A", []string{}},
+		} {
+			recs, err := p.GetRecordsFiltered(ctx, "example.org.", tc.opts)
+			if err != nil {
+				t.Fatalf("%+v: %s", tc.opts, err)
+			}
+			have := make([]string, 0, len(recs))
+			for _, r := range recs {
+				have = append(have, r.RR().Name+" "+r.RR().Type)
+			}
+			if !reflect.DeepEqual(have, tc.want) {
+				t.Errorf("old=%v %+v: have %q want %q", old, tc.opts, have, tc.want)
+			}
+			if q := f.Queries[len(f.Queries)-1]; q != tc.query {
+				t.Errorf("%+v: sent query %q, want %q", tc.opts, q, tc.query)
+			}
+		}
+	}
+}
+
+func TestReadBackFetchesChangedRRsets(t *testing.T) {
+	ctx := context.Background()
+	for _, old := range []bool{false, true} {
+		f := newFakePDNS(t)
+		f.NoRRsetFilter = old
+		f.AddZone("example.org.",
+			rrset("www.example.org.", "A", 60, "192.0.2.1"),
+			rrset("other.example.org.", "A", 60, "192.0.2.3"),
+		)
+		p := f.provider()
+
+		set, err := p.SetRecords(ctx, "example.org.", []libdns.Record{
+			libdns.Address{Name: "www", IP: netip.MustParseAddr("192.0.2.2"), TTL: time.Minute},
+			libdns.TXT{Name: "mail", Text: "hi", TTL: time.Minute},
+		})
+		if err != nil {
+			t.Fatalf("old=%v: SetRecords: %s", old, err)
+		}
+		want := []libdns.Record{
+			libdns.Address{Name: "www", IP: netip.MustParseAddr("192.0.2.2"), TTL: time.Minute},
+			libdns.TXT{Name: "mail", Text: "hi", TTL: time.Minute},
+		}
+		if !reflect.DeepEqual(set, want) {
+			t.Errorf("old=%v: have %#v want %#v", old, set, want)
+		}
+
+		// the reads after the PATCH ask for just the changed rrsets, or
+		// take the whole zone once from a server that can't filter
+		var reads []string
+		for i, c := range f.Calls {
+			if strings.HasPrefix(c, "PATCH ") {
+				reads = append(reads[:0], f.Queries[i+1:]...)
+			}
+		}
+		wantReads := []string{"rrset_name=www.example.org.&rrset_type=A", "rrset_name=mail.example.org.&rrset_type=TXT"}
+		if old {
+			wantReads = wantReads[:1]
+		}
+		if !reflect.DeepEqual(reads, wantReads) {
+			t.Errorf("old=%v: reads after the PATCH %q, want %q", old, reads, wantReads)
+		}
+	}
+}
+
+func TestAutoCreateZone(t *testing.T) {
+	ctx := context.Background()
+	f := newFakePDNS(t)
+	p := f.provider()
+	txt := []libdns.Record{libdns.TXT{Name: "www", Text: "hello"}}
+
+	if _, err := p.AppendRecords(ctx, "new.org.", txt); !errors.Is(err, ErrZoneNotFound) {
+		t.Errorf("expected ErrZoneNotFound without AutoCreateZone, got %v", err)
+	}
+	if n := f.CallCount(http.MethodPost, "/zones"); n != 0 {
+		t.Errorf("a zone was created without AutoCreateZone")
+	}
+
+	p.AutoCreateZone = true
+	p.DefaultZoneKind = "Master"
+	p.DefaultNameservers = []string{"ns1.example.net.", "ns2.example.net."}
+	p.DefaultAccount = "billing-42"
+	if _, err := p.AppendRecords(ctx, "new.org.", txt); err != nil {
+		t.Fatalf("AppendRecords: %s", err)
+	}
+	z := f.Zone("new.org.")
+	if z == nil {
+		t.Fatal("zone was not created")
+	}
+	if account := powerdns.StringValue(z.Account); account != "billing-42" {
+		t.Errorf("zone created with account %q", account)
+	}
+	if *z.Kind != powerdns.MasterZoneKind {
+		t.Errorf("zone created as %s", *z.Kind)
+	}
+	if got := rrsetContents(findRRset(z, "new.org.", "NS")); !reflect.DeepEqual(got, p.DefaultNameservers) {
+		t.Errorf("apex NS is %q", got)
+	}
+	if findRRset(z, "www.new.org.", "TXT") == nil {
+		t.Error("record was not written to the new zone")
+	}
+
+	// deleting from a missing zone creates nothing
+	if _, err := p.DeleteRecords(ctx, "gone.org.", txt); !errors.Is(err, ErrZoneNotFound) {
+		t.Errorf("expected ErrZoneNotFound from DeleteRecords, got %v", err)
+	}
+
+	// concurrent writes racing to create the same zone all succeed
+	var wg sync.WaitGroup
+	errs := make([]error, 5)
+	for i := range errs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, errs[i] = p.AppendRecords(ctx, "race.org.", []libdns.Record{
+				libdns.TXT{Name: "www" + strconv.Itoa(i), Text: "hello"},
+			})
+		}(i)
+	}
+	wg.Wait()
+	for i, err := range errs {
+		if err != nil {
+			t.Errorf("write %d: %s", i, err)
+		}
+	}
+	for i := range errs {
+		if f.RRset("race.org.", "www"+strconv.Itoa(i)+".race.org.", "TXT") == nil {
+			t.Errorf("record of write %d is missing", i)
+		}
+	}
+}
+
+func TestConflictRetries(t *testing.T) {
+	ctx := context.Background()
+	f := newFakePDNS(t)
+	f.AddZone("example.org.",
+		rrset("example.org.", "SOA", 3600, "ns1.example.org. hostmaster.example.org. 1 10800 3600 604800 3600"),
+		rrset("www.example.org.", "A", 60, "192.0.2.1"),
+	)
+	p := f.provider()
+	p.ConflictRetries = 2
+
+	// another client appends a value between our read and our write
+	gets := 0
+	f.OnZoneGet = func(z *powerdns.Zone) {
+		gets++
+		if gets != 2 {
+			return
+		}
+		for i, rs := range z.RRsets {
+			if *rs.Name == "www.example.org." {
+				z.RRsets[i].Records = append(rs.Records, powerdns.Record{Content: powerdns.String("192.0.2.5"), Disabled: powerdns.Bool(false)})
+			}
+		}
+		f.BumpSerial(z)
+	}
+	if _, err := p.AppendRecords(ctx, "example.org.", []libdns.Record{
+		libdns.Address{Name: "www", IP: netip.MustParseAddr("192.0.2.2")},
+	}); err != nil {
+		t.Fatalf("AppendRecords: %s", err)
+	}
+	if got := rrsetContents(f.RRset("example.org.", "www.example.org.", "A")); !reflect.DeepEqual(got, []string{"192.0.2.1", "192.0.2.5", "192.0.2.2"}) {
+		t.Errorf("the concurrent change was lost: %q", got)
+	}
+	if n := f.CallCount(http.MethodPatch, ""); n != 1 {
+		t.Errorf("expected 1 PATCH, got %d", n)
+	}
+
+	// a zone that keeps changing is given up on
+	f.OnZoneGet = func(z *powerdns.Zone) { f.BumpSerial(z) }
+	_, err := p.SetRecords(ctx, "example.org.", []libdns.Record{
+		libdns.Address{Name: "www", IP: netip.MustParseAddr("192.0.2.3")},
+	})
+	if !errors.Is(err, ErrConcurrentModification) {
+		t.Errorf("expected ErrConcurrentModification, got %v", err)
+	}
+	if n := f.CallCount(http.MethodPatch, ""); n != 1 {
+		t.Errorf("a write was sent for a conflicting plan")
+	}
+}
+
+func TestAAAARecords(t *testing.T) {
+	ctx := context.Background()
+	f := newFakePDNS(t)
+	f.AddZone("example.org.")
+	p := f.provider()
+
+	if _, err := p.AppendRecords(ctx, "example.org.", []libdns.Record{
+		libdns.Address{Name: "www", IP: netip.MustParseAddr("2001:0db8:0000:0000:0000:0000:0000:0001"), TTL: time.Minute},
+		libdns.RR{Name: "www", Type: "AAAA", Data: "2001:db8:0:0:0:0:0:1", TTL: time.Minute},
+		libdns.RR{Name: "www", Type: "AAAA", Data: "0:0:0:0:0:0:0:1", TTL: time.Minute},
+		libdns.Address{Name: "www", IP: netip.MustParseAddr("::1"), TTL: time.Minute},
+		libdns.Address{Name: "www", IP: netip.MustParseAddr("192.0.2.1"), TTL: time.Minute},
+	}); err != nil {
+		t.Fatalf("AppendRecords: %s", err)
+	}
+	if got := rrsetContents(f.RRset("example.org.", "www.example.org.", "AAAA")); !reflect.DeepEqual(got, []string{"2001:db8::1", "::1"}) {
+		t.Errorf("stored AAAA %q", got)
+	}
+
+	recs, err := p.GetRecordsByTypes(ctx, "example.org.", []string{"AAAA"})
+	if err != nil {
+		t.Fatalf("GetRecords: %s", err)
+	}
+	want := []libdns.Record{
+		libdns.Address{Name: "www", IP: netip.MustParseAddr("2001:db8::1"), TTL: time.Minute},
+		libdns.Address{Name: "www", IP: netip.MustParseAddr("::1"), TTL: time.Minute},
+	}
+	if !reflect.DeepEqual(recs, want) {
+		t.Errorf("have %#v want %#v", recs, want)
+	}
+	for _, r := range recs {
+		if rr := r.RR(); rr.Type != "AAAA" {
+			t.Errorf("%s read back as %s", rr.Data, rr.Type)
+		}
+	}
+}
+
+func TestNamesMergeRegardlessOfCase(t *testing.T) {
+	ctx := context.Background()
+	f := newFakePDNS(t)
+	f.AddZone("example.org.", rrset("www.example.org.", "A", 60, "192.0.2.1"))
+	p := f.provider()
+
+	if _, err := p.AppendRecords(ctx, "example.org.", []libdns.Record{
+		libdns.Address{Name: "Www", IP: netip.MustParseAddr("192.0.2.2"), TTL: time.Minute},
+		libdns.Address{Name: "WWW.Example.ORG.", IP: netip.MustParseAddr("192.0.2.3"), TTL: time.Minute},
+		libdns.Address{Name: "www", IP: netip.MustParseAddr("192.0.2.2"), TTL: time.Minute},
+	}); err != nil {
+		t.Fatalf("AppendRecords: %s", err)
+	}
+	patches := f.Patches[len(f.Patches)-1]
+	if len(patches) != 1 || *patches[0].Name != "www.example.org." {
+		t.Errorf("expected a single change of www.example.org., got %d", len(patches))
+	}
+	if got := rrsetContents(f.RRset("example.org.", "www.example.org.", "A")); !reflect.DeepEqual(got, []string{"192.0.2.1", "192.0.2.2", "192.0.2.3"}) {
+		t.Errorf("stored %q", got)
+	}
+
+	if _, err := p.SetRecords(ctx, "example.org.", []libdns.Record{
+		libdns.Address{Name: "MAIL", IP: netip.MustParseAddr("192.0.2.4"), TTL: time.Minute},
+		libdns.Address{Name: "mail", IP: netip.MustParseAddr("192.0.2.5"), TTL: time.Minute},
+	}); err != nil {
+		t.Fatalf("SetRecords: %s", err)
+	}
+	if got := rrsetContents(f.RRset("example.org.", "mail.example.org.", "A")); !reflect.DeepEqual(got, []string{"192.0.2.4", "192.0.2.5"}) {
+		t.Errorf("stored %q", got)
+	}
+	if rs := findRRset(f.Zone("example.org."), "MAIL.EXAMPLE.ORG.", "A"); rs == nil {
+		t.Error("findRRset should ignore the case of names")
+	}
+}
+
+func TestGetRecord(t *testing.T) {
+	ctx := context.Background()
+	f := newFakePDNS(t)
+	f.AddZone("example.org.",
+		rrset("www.example.org.", "A", 60, "192.0.2.1", "192.0.2.2"),
+		rrset("www.example.org.", "TXT", 60, `"hello"`),
+	)
+	p := f.provider()
+
+	recs, err := p.GetRecord(ctx, "example.org.", "www", "A")
+	if err != nil {
+		t.Fatalf("GetRecord: %s", err)
+	}
+	want := []libdns.Record{
+		libdns.Address{Name: "www", IP: netip.MustParseAddr("192.0.2.1"), TTL: time.Minute},
+		libdns.Address{Name: "www", IP: netip.MustParseAddr("192.0.2.2"), TTL: time.Minute},
+	}
+	if !reflect.DeepEqual(recs, want) {
+		t.Errorf("have %#v want %#v", recs, want)
+	}
+
+	recs, err = p.GetRecord(ctx, "example.org.", "www", "TXT")
+	if err != nil {
+		t.Fatalf("GetRecord: %s", err)
+	}
+	if want := []libdns.Record{libdns.TXT{Name: "www", Text: "hello", TTL: time.Minute}}; !reflect.DeepEqual(recs, want) {
+		t.Errorf("have %#v want %#v", recs, want)
+	}
+
+	recs, err = p.GetRecord(ctx, "example.org.", "www", "AAAA")
+	if err != nil {
+		t.Fatalf("GetRecord: %s", err)
+	}
+	if recs == nil || len(recs) != 0 {
+		t.Errorf("expected an empty slice for an absent rrset, got %#v", recs)
+	}
+	if q := f.Queries[len(f.Queries)-1]; q != "rrset_name=www.example.org.&rrset_type=AAAA" {
+		t.Errorf("the rrset was not filtered on the server: %q", q)
+	}
+
+	if _, err := p.GetRecord(ctx, "example.org.", "www", ""); err == nil {
+		t.Error("expected an error without a type")
+	}
+}
+
+func TestLongTXTRecords(t *testing.T) {
+	ctx := context.Background()
+	f := newFakePDNS(t)
+	f.AddZone("example.org.")
+	p := f.provider()
+
+	dkim := "v=DKIM1; k=rsa; p=" + strings.Repeat("MIIBIjANBgkqhkiG9w0BAQEFAAOCAQ8A", 19)[:582]
+	if len(dkim) != 600 {
+		t.Fatalf("test key is %d bytes", len(dkim))
+	}
+	rec := libdns.TXT{Name: "sel._domainkey", Text: dkim, TTL: time.Hour}
+	if _, err := p.AppendRecords(ctx, "example.org.", []libdns.Record{rec}); err != nil {
+		t.Fatalf("AppendRecords: %s", err)
+	}
+	stored := rrsetContents(f.RRset("example.org.", "sel._domainkey.example.org.", "TXT"))
+	want := `"` + dkim[:255] + `" "` + dkim[255:510] + `" "` + dkim[510:] + `"`
+	if len(stored) != 1 || stored[0] != want {
+		t.Errorf("stored %q, want %q", stored, want)
+	}
+
+	recs, err := p.GetRecords(ctx, "example.org.")
+	if err != nil {
+		t.Fatalf("GetRecords: %s", err)
+	}
+	if !reflect.DeepEqual(recs, []libdns.Record{rec}) {
+		t.Errorf("read back %#v", recs)
+	}
+	added, err := p.AppendRecords(ctx, "example.org.", recs)
+	if err != nil || len(added) != 0 {
+		t.Errorf("appending the record read back added %v, %v", added, err)
+	}
+}
+
+func TestApexRRsetsSurviveDeletes(t *testing.T) {
+	ctx := context.Background()
+	f := newFakePDNS(t)
+	f.AddZone("example.org.",
+		rrset("example.org.", "SOA", 3600, "ns1.example.org. hostmaster.example.org. 1 10800 3600 604800 3600"),
+		rrset("example.org.", "NS", 3600, "ns1.example.org.", "ns2.example.org."),
+		rrset("sub.example.org.", "NS", 3600, "ns.sub.example.org."),
+		rrset("www.example.org.", "A", 60, "192.0.2.1"),
+	)
+	p := f.provider()
+
+	all, err := p.GetRecords(ctx, "example.org.")
+	if err != nil {
+		t.Fatalf("GetRecords: %s", err)
+	}
+	results, err := p.DeleteRecordsWithResults(ctx, "example.org.", all)
+	if err != nil {
+		t.Fatalf("DeleteRecords: %s", err)
+	}
+	for _, r := range results {
+		rr := r.Record.RR()
+		apex := rr.Name == "@" && (rr.Type == "SOA" || rr.Type == "NS")
+		if r.Applied == apex {
+			t.Errorf("%s %s %s: applied = %v", rr.Name, rr.Type, rr.Data, r.Applied)
+		}
+	}
+	z := f.Zone("example.org.")
+	if len(z.RRsets) != 2 || findRRset(z, "example.org.", "SOA") == nil || len(rrsetContents(findRRset(z, "example.org.", "NS"))) != 2 {
+		t.Errorf("expected only the apex SOA and NS to be left, have %#v", z.RRsets)
+	}
+
+	// removing some values, or replacing the rrset, is fine
+	if _, err := p.DeleteRecords(ctx, "example.org.", []libdns.Record{libdns.NS{Name: "@", Target: "ns2.example.org."}}); err != nil {
+		t.Fatalf("DeleteRecords: %s", err)
+	}
+	if got := rrsetContents(f.RRset("example.org.", "example.org.", "NS")); !reflect.DeepEqual(got, []string{"ns1.example.org."}) {
+		t.Errorf("apex NS after removing a value = %q", got)
+	}
+	_, err = p.Apply(ctx, "example.org.",
+		[]libdns.Record{libdns.NS{Name: "@", Target: "ns3.example.org.", TTL: time.Hour}},
+		[]libdns.Record{libdns.NS{Name: "@", Target: "ns1.example.org."}})
+	if err != nil {
+		t.Fatalf("Apply: %s", err)
+	}
+	if got := rrsetContents(f.RRset("example.org.", "example.org.", "NS")); !reflect.DeepEqual(got, []string{"ns3.example.org."}) {
+		t.Errorf("apex NS after replacing it = %q", got)
+	}
+
+	// neither the protected NS nor a record that isn't there is reported
+	// as deleted, only the one that was
+	www := libdns.Address{Name: "www", IP: netip.MustParseAddr("192.0.2.1"), TTL: time.Minute}
+	if _, err := p.AppendRecords(ctx, "example.org.", []libdns.Record{www}); err != nil {
+		t.Fatalf("AppendRecords: %s", err)
+	}
+	deleted, err := p.DeleteRecords(ctx, "example.org.", []libdns.Record{
+		libdns.NS{Name: "@", Target: "ns3.example.org."},
+		libdns.Address{Name: "nothere", IP: netip.MustParseAddr("192.0.2.9")},
+		www,
+	})
+	if err != nil {
+		t.Fatalf("DeleteRecords: %s", err)
+	}
+	if !reflect.DeepEqual(deleted, []libdns.Record{www}) {
+		t.Errorf("DeleteRecords returned records it did not delete: %#v", deleted)
+	}
+	if f.RRset("example.org.", "example.org.", "NS") == nil {
+		t.Error("the apex NS was deleted")
+	}
+
+	p.AllowApexDeletion = true
+	if _, err := p.DeleteRecords(ctx, "example.org.", []libdns.Record{libdns.RR{Name: "@", Type: "NS"}}); err != nil {
+		t.Fatalf("DeleteRecords: %s", err)
+	}
+	if f.RRset("example.org.", "example.org.", "NS") != nil {
+		t.Error("AllowApexDeletion should let the apex NS be deleted")
+	}
+}
+
+func TestClientInitHonorsContext(t *testing.T) {
+	f := newFakePDNS(t)
+	p := f.provider()
+
+	// a build that is stuck, e.g. reading an APITokenFile on a hung mount
+	stuck := &clientInit{done: make(chan struct{})}
+	p.cInit = stuck
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err := p.GetRecords(ctx, "example.org.")
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected the deadline to end the wait, got %v", err)
+	}
+	if d := time.Since(start); d > time.Second {
+		t.Errorf("GetRecords took %s to give up", d)
+	}
+
+	// waiting callers get the client once the build is done
+	got := make(chan *client, 1)
+	go func() {
+		c, err := p.client(context.Background())
+		if err != nil {
+			t.Errorf("client: %s", err)
+		}
+		got <- c
+	}()
+	built, err := p.newClient("server_url", p.ServerURL)
+	if err != nil {
+		t.Fatalf("newClient: %s", err)
+	}
+	p.mu.Lock()
+	stuck.c, p.c, p.cInit = built, built, nil
+	p.mu.Unlock()
+	close(stuck.done)
+	if c := <-got; c != built {
+		t.Errorf("waiting caller got another client")
+	}
+}
@@ -0,0 +1,74 @@
+package powerdns
+
+import (
+	"context"
+	"fmt"
+	"net/netip"
+	"strconv"
+	"strings"
+
+	"github.com/libdns/libdns"
+)
+
+// AppendPTR adds a PTR record pointing ip at target.  The record goes into
+// the most specific reverse zone on the server that contains the reverse
+// name of ip, in-addr.arpa for IPv4 and ip6.arpa for IPv6 addresses.
+func (p *Provider) AppendPTR(ctx context.Context, ip netip.Addr, target string) error {
+	if !ip.IsValid() {
+		return fmt.Errorf("invalid IP address")
+	}
+	name := ReverseName(ip)
+	zones, err := p.ListZones(ctx)
+	if err != nil {
+		return err
+	}
+	zone := containingZone(name, zones)
+	if zone == "" {
+		return fmt.Errorf("%w: no reverse zone for %s (%s)", ErrZoneNotFound, ip, name)
+	}
+	_, err = p.AppendRecords(ctx, zone, []libdns.Record{
+		libdns.RR{Name: libdns.RelativeName(name, zone), Type: "PTR", Data: target},
+	})
+	return err
+}
+
+// ReverseName returns the fully qualified reverse lookup name of ip, e.g.
+// 1.2.0.192.in-addr.arpa. for 192.0.2.1.  IPv6 addresses use the ip6.arpa
+// nibble format.
+func ReverseName(ip netip.Addr) string {
+	ip = ip.Unmap()
+	var b strings.Builder
+	if ip.Is4() {
+		octets := ip.As4()
+		for i := len(octets) - 1; i >= 0; i-- {
+			b.WriteString(strconv.Itoa(int(octets[i])))
+			b.WriteByte('.')
+		}
+		b.WriteString("in-addr.arpa.")
+		return b.String()
+	}
+	const hex = "0123456789abcdef"
+	bytes := ip.As16()
+	for i := len(bytes) - 1; i >= 0; i-- {
+		b.WriteByte(hex[bytes[i]&0xf])
+		b.WriteByte('.')
+		b.WriteByte(hex[bytes[i]>>4])
+		b.WriteByte('.')
+	}
+	b.WriteString("ip6.arpa.")
+	return b.String()
+}
+
+// containingZone returns the longest of the zones that name is in, or the
+// empty string if there is none
+func containingZone(name string, zones []libdns.Zone) string {
+	name = CanonicalZone(name)
+	best := ""
+	for _, z := range zones {
+		zn := CanonicalZone(z.Name)
+		if (name == zn || strings.HasSuffix(name, "."+zn)) && len(zn) > len(best) {
+			best = zn
+		}
+	}
+	return best
+}
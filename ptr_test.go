@@ -0,0 +1,51 @@
+package powerdns
+
+import (
+	"context"
+	"errors"
+	"net/netip"
+	"reflect"
+	"testing"
+)
+
+func TestAppendPTR(t *testing.T) {
+	ctx := context.Background()
+	f := newFakePDNS(t)
+	f.AddZone("192.in-addr.arpa.")
+	f.AddZone("2.0.192.in-addr.arpa.")
+	f.AddZone("8.b.d.0.1.0.0.2.ip6.arpa.")
+	f.AddZone("example.org.")
+	p := f.provider()
+
+	if err := p.AppendPTR(ctx, netip.MustParseAddr("192.0.2.10"), "host.example.org"); err != nil {
+		t.Fatalf("AppendPTR IPv4: %s", err)
+	}
+	if got := rrsetContents(f.RRset("2.0.192.in-addr.arpa.", "10.2.0.192.in-addr.arpa.", "PTR")); !reflect.DeepEqual(got, []string{"host.example.org."}) {
+		t.Errorf("IPv4 PTR not in the most specific zone: %v", got)
+	}
+
+	if err := p.AppendPTR(ctx, netip.MustParseAddr("2001:db8::567:89ab"), "host.example.org."); err != nil {
+		t.Fatalf("AppendPTR IPv6: %s", err)
+	}
+	name := "b.a.9.8.7.6.5.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.8.b.d.0.1.0.0.2.ip6.arpa."
+	if got := rrsetContents(f.RRset("8.b.d.0.1.0.0.2.ip6.arpa.", name, "PTR")); !reflect.DeepEqual(got, []string{"host.example.org."}) {
+		t.Errorf("IPv6 PTR missing: %v", got)
+	}
+
+	err := p.AppendPTR(ctx, netip.MustParseAddr("198.51.100.1"), "host.example.org.")
+	if !errors.Is(err, ErrZoneNotFound) {
+		t.Errorf("expected ErrZoneNotFound without a reverse zone, got %v", err)
+	}
+}
+
+func TestReverseName(t *testing.T) {
+	for in, want := range map[string]string{
+		"192.0.2.1":        "1.2.0.192.in-addr.arpa.",
+		"::ffff:192.0.2.1": "1.2.0.192.in-addr.arpa.",
+		"2001:db8::1":      "1.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.8.b.d.0.1.0.0.2.ip6.arpa.",
+	} {
+		if got := ReverseName(netip.MustParseAddr(in)); got != want {
+			t.Errorf("ReverseName(%s) = %s, want %s", in, got, want)
+		}
+	}
+}
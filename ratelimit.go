@@ -0,0 +1,21 @@
+package powerdns
+
+import (
+	"net/http"
+
+	"golang.org/x/time/rate"
+)
+
+// rateLimitTransport wraps http.RoundTripper to hold every request back
+// until the limiter allows it, see Provider.RateLimit
+type rateLimitTransport struct {
+	transport http.RoundTripper
+	limiter   *rate.Limiter
+}
+
+func (r *rateLimitTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if err := r.limiter.Wait(req.Context()); err != nil {
+		return nil, err
+	}
+	return r.transport.RoundTrip(req)
+}
@@ -0,0 +1,50 @@
+package powerdns
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestRateLimit(t *testing.T) {
+	f := newFakePDNS(t)
+	f.AddZone("example.org.", rrset("www.example.org.", "A", 60, "192.0.2.1"))
+	p := f.provider()
+	p.RateLimit = 20
+	p.Burst = 1
+
+	ctx := context.Background()
+	var sent []time.Time
+	p.RequestHook = func(context.Context, string, string, error, time.Duration) {
+		sent = append(sent, time.Now())
+	}
+	for i := 0; i < 4; i++ {
+		if _, err := p.GetRecords(ctx, "example.org."); err != nil {
+			t.Fatalf("GetRecords: %s", err)
+		}
+	}
+	if len(sent) < 4 {
+		t.Fatalf("expected at least 4 requests, saw %d", len(sent))
+	}
+	for i := 1; i < len(sent); i++ {
+		// 50ms apart at 20 per second, with some slack for the clock
+		if gap := sent[i].Sub(sent[i-1]); gap < 40*time.Millisecond {
+			t.Errorf("requests %d and %d only %s apart", i-1, i, gap)
+		}
+	}
+
+	slow := f.provider()
+	slow.RateLimit = 0.5
+	if _, err := slow.GetRecords(ctx, "example.org."); err != nil {
+		t.Fatalf("GetRecords: %s", err)
+	}
+	short, cancel := context.WithTimeout(ctx, 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if _, err := slow.GetRecords(short, "example.org."); err == nil {
+		t.Error("expected the rate limit to outlast the context")
+	}
+	if d := time.Since(start); d > time.Second {
+		t.Errorf("waited %s for a slot the context could not get", d)
+	}
+}
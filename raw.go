@@ -0,0 +1,203 @@
+package powerdns
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+
+	"github.com/joeig/go-powerdns/v3"
+)
+
+// RawClient gives access to the go-powerdns client the provider talks to
+// the server with, for endpoints this package doesn't cover.  It is an
+// advanced and unstable surface: the types belong to that library and
+// change with it, and requests made through it bypass what the provider
+// does around its own calls, like zone name normalization, TXT quoting,
+// error mapping and auto-rectification.
+type RawClient interface {
+	// Client returns the whole client, with all its services.
+	Client() *powerdns.Client
+
+	Zones() *powerdns.ZonesService
+	Records() *powerdns.RecordsService
+}
+
+type rawClient struct {
+	c *powerdns.Client
+}
+
+func (r rawClient) Client() *powerdns.Client          { return r.c }
+func (r rawClient) Zones() *powerdns.ZonesService     { return r.c.Zones }
+func (r rawClient) Records() *powerdns.RecordsService { return r.c.Records }
+
+// Raw returns the underlying client used for changes, creating it if
+// needed.  See RawClient for the caveats.
+func (p *Provider) Raw() (RawClient, error) {
+	c, err := p.client(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	return rawClient{c: c.Client}, nil
+}
+
+// doRaw sends a request the powerdns.Client has no method for, or where
+// its methods would buffer more than we want.  pathFragment is relative to
+// the server, e.g. "zones/example.org.".  Error responses are returned as
+// *powerdns.Error, like the powerdns.Client does, so isNotFound and
+// friends work on them.  On success the caller must close the body.
+func (c *client) doRaw(ctx context.Context, method, pathFragment string, query url.Values, body any) (*http.Response, error) {
+	u, err := url.Parse(c.BaseURL)
+	if err != nil {
+		return nil, err
+	}
+	u.Path = path.Join(u.Path, "/api/v1/servers", c.VHost, pathFragment)
+	if query != nil {
+		u.RawQuery = query.Encode()
+	}
+
+	var reqBody io.Reader
+	if body != nil {
+		buf := new(bytes.Buffer)
+		if err := json.NewEncoder(buf).Encode(body); err != nil {
+			return nil, err
+		}
+		reqBody = buf
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), reqBody)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	req.Header.Set("X-API-Key", c.apiToken)
+	for k, v := range c.Headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		defer resp.Body.Close()
+		apiErr := &powerdns.Error{Status: resp.Status, StatusCode: resp.StatusCode}
+		if resp.StatusCode == http.StatusUnauthorized {
+			apiErr.Message = "Unauthorized"
+		} else if strings.HasPrefix(resp.Header.Get("Content-Type"), "application/json") {
+			_ = json.NewDecoder(resp.Body).Decode(apiErr)
+		} else {
+			msg, _ := io.ReadAll(resp.Body)
+			apiErr.Message = string(msg)
+		}
+		return nil, apiErr
+	}
+	return resp, nil
+}
+
+// streamRRsets fetches the zone and hands its rrsets to fn one at a time,
+// decoding them straight off the wire.  Unlike getZone it never holds the
+// whole zone in memory, which matters for zones with millions of records.
+// An error returned by fn stops the stream and is returned as is.
+func (c *client) streamRRsets(ctx context.Context, zoneName string, query url.Values, fn func(powerdns.RRset) error) error {
+	_, err := c.streamZone(ctx, zoneName, query, fn)
+	return err
+}
+
+// streamZone is streamRRsets that also returns the settings of the zone,
+// such as its serial, with no rrsets.
+func (c *client) streamZone(ctx context.Context, zoneName string, query url.Values, fn func(powerdns.RRset) error) (*powerdns.Zone, error) {
+	resp, err := c.doRaw(ctx, http.MethodGet, "zones/"+canonicalZone(zoneName), query, nil)
+	if err != nil {
+		return nil, wrapAPIError(err, zoneName)
+	}
+	defer resp.Body.Close()
+
+	zone := &powerdns.Zone{}
+	dec := json.NewDecoder(resp.Body)
+	if err := expectDelim(dec, '{'); err != nil {
+		return nil, err
+	}
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return nil, err
+		}
+		if key, _ := tok.(string); key != "rrsets" {
+			var value json.RawMessage
+			if err := dec.Decode(&value); err != nil {
+				return nil, err
+			}
+			field, _ := json.Marshal(map[string]json.RawMessage{key: value})
+			if err := json.Unmarshal(field, zone); err != nil {
+				return nil, c.checkSchema(ctx, err)
+			}
+			continue
+		}
+		if err := expectDelim(dec, '['); err != nil {
+			return nil, err
+		}
+		for dec.More() {
+			var rrset powerdns.RRset
+			if err := dec.Decode(&rrset); err != nil {
+				return nil, c.checkSchema(ctx, err)
+			}
+			if err := fn(rrset); err != nil {
+				return nil, err
+			}
+		}
+		if err := expectDelim(dec, ']'); err != nil {
+			return nil, err
+		}
+	}
+	return zone, expectDelim(dec, '}')
+}
+
+func expectDelim(dec *json.Decoder, want json.Delim) error {
+	tok, err := dec.Token()
+	if err != nil {
+		return err
+	}
+	if d, ok := tok.(json.Delim); !ok || d != want {
+		return fmt.Errorf("unexpected %v in zone response, expected %v", tok, want)
+	}
+	return nil
+}
+
+// canonicalZone returns the zone name with a trailing dot
+func canonicalZone(zone string) string {
+	return strings.TrimSuffix(zone, ".") + "."
+}
+
+// changedRRsets fetches the rrsets of the changes, each with a GET
+// filtered on its name and type, and returns them as a zone holding just
+// those.  A server too old to filter sends the whole zone instead, which
+// then holds all of them, so no further requests are made.
+func (c *client) changedRRsets(ctx context.Context, zoneName string, changes []rrsetChange) (*powerdns.Zone, error) {
+	out := &powerdns.Zone{Name: powerdns.String(canonicalZone(zoneName))}
+	unfiltered := false
+	for _, ch := range changes {
+		if unfiltered {
+			break
+		}
+		query := url.Values{"rrset_name": {ch.name}, "rrset_type": {ch.rrType}}
+		err := c.streamRRsets(ctx, zoneName, query, func(rrset powerdns.RRset) error {
+			if powerdns.StringValue(rrset.Name) != ch.name || rrset.Type == nil || string(*rrset.Type) != ch.rrType {
+				unfiltered = true
+			}
+			out.RRsets = append(out.RRsets, rrset)
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return out, nil
+}
@@ -0,0 +1,31 @@
+package powerdns
+
+import (
+	"context"
+	"testing"
+)
+
+func TestRaw(t *testing.T) {
+	f := newFakePDNS(t)
+	f.AddZone("example.org.", rrset("www.example.org.", "A", 60, "127.0.0.1"))
+	p := f.provider()
+
+	raw, err := p.Raw()
+	if err != nil {
+		t.Fatalf("Raw: %s", err)
+	}
+	if raw.Client() == nil || raw.Zones() == nil || raw.Records() == nil {
+		t.Fatalf("incomplete raw client")
+	}
+	z, err := raw.Zones().Get(context.Background(), "example.org.")
+	if err != nil {
+		t.Fatalf("getting the zone through the raw client: %s", err)
+	}
+	if len(z.RRsets) != 1 {
+		t.Errorf("unexpected zone %#v", z)
+	}
+	server, err := raw.Client().Servers.Get(context.Background(), "localhost")
+	if err != nil || *server.Version != "4.9.0" {
+		t.Errorf("getting the server through the raw client: %v", err)
+	}
+}
@@ -0,0 +1,130 @@
+package powerdns
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/joeig/go-powerdns/v3"
+	"github.com/libdns/libdns"
+)
+
+// ReplaceZoneRecords makes the records of the zone exactly match desired.
+// Rrsets whose values or TTL differ are replaced, rrsets that are not in
+// desired are deleted and missing ones are created.  The SOA is left alone
+// unless desired contains one, since PowerDNS refuses zones without it.
+// The same goes for the NS rrset of the apex, unless AllowApexDeletion is
+// set.
+//
+// The current zone is streamed from the server and only the changed rrsets
+// are kept, so this works for zones too large to load at once.  All changes
+// are submitted in a single atomic PATCH, like those of SetRecords, so
+// DryRun, AutoRectify and ConflictRetries apply as they do there.
+func (p *Provider) ReplaceZoneRecords(ctx context.Context, zone string, desired []libdns.Record) (err error) {
+	defer func(start time.Time) { p.observe("replace", start, err) }(time.Now())
+	_, _, err = p.replaceZone(ctx, zone, desired, false)
+	return err
+}
+
+// ReplaceZone is ReplaceZoneRecords for managing a zone declaratively,
+// e.g. from a file under version control.  Beside the SOA it keeps the NS
+// rrset of the apex unless desired contains one, as both are usually set
+// up with the zone rather than maintained with its records.  NS rrsets of
+// delegations are records like any other and are deleted if missing.
+//
+// It returns the records of the rrsets that were created or replaced, as
+// the server stored them; rrsets that already matched are not returned.
+// In a dry run they are returned as given in desired.
+func (p *Provider) ReplaceZone(ctx context.Context, zone string, desired []libdns.Record) (_ []libdns.Record, err error) {
+	defer func(start time.Time) { p.observe("replace", start, err) }(time.Now())
+	zone = p.normalizeZone(zone)
+	c, changes, err := p.replaceZone(ctx, zone, desired, true)
+	if err != nil {
+		return nil, err
+	}
+	if p.DryRun {
+		recs := make([]libdns.Record, 0)
+		for _, ch := range changes {
+			for _, idx := range ch.inputs {
+				recs = append(recs, desired[idx])
+			}
+		}
+		return recs, nil
+	}
+	return p.storedRecords(ctx, c, zone, nil, changes, false)
+}
+
+// replaceZone applies the changes of ReplaceZoneRecords and returns them.
+// keepApexNS makes it leave the NS rrset of the apex alone when desired has
+// none.
+func (p *Provider) replaceZone(ctx context.Context, zone string, desired []libdns.Record, keepApexNS bool) (*client, []rrsetChange, error) {
+	zone = p.normalizeZone(zone)
+	absRecords, err := convertNamesToAbsolute(zone, desired)
+	if err != nil {
+		return nil, nil, err
+	}
+	absRecords = p.withDefaultTTL(absRecords)
+	pl, err := p.checkedPlan(ctx, zone, func() (writePlan, error) {
+		c, err := p.client(ctx)
+		if err != nil {
+			return writePlan{}, err
+		}
+		return p.planReplace(ctx, c, zone, absRecords, keepApexNS)
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	changes := effectiveChanges(pl.before, pl.changes)
+	if _, err := p.apply(ctx, pl.c, zone, pl.before, desired, changes, true); err != nil {
+		return nil, nil, err
+	}
+	return pl.c, changes, nil
+}
+
+// planReplace streams the zone and plans the changes that make it match
+// the records.  The zone of the plan has only the rrsets that change, so
+// that memory use doesn't grow with the rrsets that stay as they are.
+func (p *Provider) planReplace(ctx context.Context, c *client, zone string, records []libdns.RR, keepApexNS bool) (writePlan, error) {
+	want := planSet(&powerdns.Zone{}, records)
+	wantIdx := make(map[string]int, len(want))
+	for i, ch := range want {
+		wantIdx[key(ch.name, ch.rrType)] = i
+	}
+	unchanged := make([]bool, len(want))
+	var deletes []rrsetChange
+	var before []powerdns.RRset
+
+	apex := canonicalZone(zone)
+	fullZone, err := c.streamZone(ctx, zone, nil, func(rrset powerdns.RRset) error {
+		if rrset.Type == nil {
+			return nil
+		}
+		name, rrType := powerdns.StringValue(rrset.Name), string(*rrset.Type)
+		i, ok := wantIdx[key(name, rrType)]
+		if !ok {
+			keep := rrType == "SOA" || (keepApexNS && rrType == "NS" && strings.EqualFold(name, apex))
+			if !keep {
+				deletes = append(deletes, rrsetChange{name: name, rrType: rrType, ttl: powerdns.Uint32Value(rrset.TTL)})
+				before = append(before, rrset)
+			}
+			return nil
+		}
+		want[i].comments = rrset.Comments
+		if unchanged[i] = !changesRRset(&rrset, want[i]); !unchanged[i] {
+			before = append(before, rrset)
+		}
+		return nil
+	})
+	if err != nil {
+		return writePlan{}, p.zoneError(zone, err)
+	}
+	fullZone.RRsets = before
+
+	changes := deletes
+	for i, ch := range want {
+		if !unchanged[i] {
+			changes = append(changes, ch)
+		}
+	}
+	return writePlan{c: c, before: fullZone, changes: p.keepApex(zone, changes)}, nil
+}
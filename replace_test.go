@@ -0,0 +1,164 @@
+package powerdns
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/netip"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/joeig/go-powerdns/v3"
+	"github.com/libdns/libdns"
+)
+
+func TestReplaceZoneRecords(t *testing.T) {
+	ctx := context.Background()
+	f := newFakePDNS(t)
+	f.AddZone("example.org.")
+	z := f.Zones["example.org."]
+	z.RRsets = append(z.RRsets, rrset("example.org.", "SOA", 3600, "ns1.example.org. hostmaster.example.org. 1 10800 3600 604800 3600"))
+	const hosts = 500
+	for i := 0; i < hosts; i++ {
+		z.RRsets = append(z.RRsets, rrset(fmt.Sprintf("h%d.example.org.", i), "A", 60, fmt.Sprintf("10.0.%d.%d", i/256, i%256)))
+	}
+	p := f.provider()
+
+	// keep h0-h399 as is, change h400-h449, drop h450-h499, add n0-n19
+	var desired []libdns.Record
+	for i := 0; i < 450; i++ {
+		ip := netip.MustParseAddr(fmt.Sprintf("10.0.%d.%d", i/256, i%256))
+		ttl := time.Minute
+		if i >= 400 {
+			ttl = time.Hour
+		}
+		desired = append(desired, libdns.Address{Name: fmt.Sprintf("h%d", i), IP: ip, TTL: ttl})
+	}
+	for i := 0; i < 20; i++ {
+		desired = append(desired, libdns.Address{Name: fmt.Sprintf("n%d", i), IP: netip.MustParseAddr(fmt.Sprintf("10.1.0.%d", i)), TTL: time.Minute})
+	}
+
+	if err := p.ReplaceZoneRecords(ctx, "example.org.", desired); err != nil {
+		t.Fatalf("ReplaceZoneRecords: %s", err)
+	}
+	if len(f.Patches) != 1 {
+		t.Fatalf("expected a single PATCH, got %d", len(f.Patches))
+	}
+	if n := len(f.Patches[0]); n != 50+50+20 {
+		t.Errorf("expected only the 120 changed rrsets in the PATCH, got %d", n)
+	}
+
+	var have []libdns.Record
+	err := p.GetRecordsFunc(ctx, "example.org.", func(m RecordMeta) error {
+		if m.Record.RR().Type != "SOA" {
+			have = append(have, m.Record)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("GetRecordsFunc: %s", err)
+	}
+	if !reflect.DeepEqual(have, desired) {
+		t.Errorf("zone does not match desired records: have %d records, want %d", len(have), len(desired))
+	}
+	if f.RRset("example.org.", "example.org.", "SOA") == nil {
+		t.Errorf("SOA was deleted")
+	}
+
+	if err := p.ReplaceZoneRecords(ctx, "example.org.", desired); err != nil {
+		t.Fatalf("second ReplaceZoneRecords: %s", err)
+	}
+	if len(f.Patches) != 1 {
+		t.Errorf("replacing with identical records should not send a PATCH")
+	}
+}
+
+func TestReplaceZone(t *testing.T) {
+	ctx := context.Background()
+	f := newFakePDNS(t)
+	f.AddZone("example.org.",
+		rrset("example.org.", "SOA", 3600, "ns1.example.org. hostmaster.example.org. 1 10800 3600 604800 3600"),
+		rrset("example.org.", "NS", 3600, "ns1.example.org.", "ns2.example.org."),
+		rrset("sub.example.org.", "NS", 3600, "ns.sub.example.org."),
+		rrset("www.example.org.", "A", 60, "192.0.2.1"),
+		rrset("mail.example.org.", "A", 60, "192.0.2.2"),
+		rrset("old.example.org.", "TXT", 60, `"gone"`),
+	)
+	p := f.provider()
+
+	desired := []libdns.Record{
+		libdns.Address{Name: "www", IP: netip.MustParseAddr("192.0.2.1"), TTL: time.Minute},
+		libdns.Address{Name: "mail", IP: netip.MustParseAddr("192.0.2.20"), TTL: time.Minute},
+		libdns.TXT{Name: "new", Text: "hello", TTL: time.Minute},
+	}
+	changed, err := p.ReplaceZone(ctx, "example.org.", desired)
+	if err != nil {
+		t.Fatalf("ReplaceZone: %s", err)
+	}
+	want := []libdns.Record{desired[1], desired[2]}
+	if !reflect.DeepEqual(changed, want) {
+		t.Errorf("ReplaceZone returned %#v, want %#v", changed, want)
+	}
+	if len(f.Patches) != 1 || len(f.Patches[0]) != 4 {
+		t.Errorf("expected one PATCH of 4 rrsets, got %v", f.Patches)
+	}
+	for _, gone := range []struct{ name, rrType string }{{"old.example.org.", "TXT"}, {"sub.example.org.", "NS"}} {
+		if f.RRset("example.org.", gone.name, gone.rrType) != nil {
+			t.Errorf("%s %s was not deleted", gone.name, gone.rrType)
+		}
+	}
+	if f.RRset("example.org.", "example.org.", "SOA") == nil {
+		t.Error("SOA was deleted")
+	}
+	if got := rrsetContents(f.RRset("example.org.", "example.org.", "NS")); len(got) != 2 {
+		t.Errorf("apex NS should be kept, have %q", got)
+	}
+
+	// an apex NS in desired is applied like any other rrset
+	desired = append(desired, libdns.NS{Name: "@", Target: "ns3.example.org.", TTL: time.Hour})
+	if _, err := p.ReplaceZone(ctx, "example.org.", desired); err != nil {
+		t.Fatalf("ReplaceZone: %s", err)
+	}
+	if got := rrsetContents(f.RRset("example.org.", "example.org.", "NS")); !reflect.DeepEqual(got, []string{"ns3.example.org."}) {
+		t.Errorf("apex NS = %q", got)
+	}
+	changed, err = p.ReplaceZone(ctx, "example.org.", desired)
+	if err != nil || len(changed) != 0 || len(f.Patches) != 2 {
+		t.Errorf("replacing with a matching zone changed %v, %v", changed, err)
+	}
+}
+
+func TestReplaceZoneWritesLikeSetRecords(t *testing.T) {
+	ctx := context.Background()
+	f := newFakePDNS(t)
+	f.AddZone("example.org.",
+		rrset("example.org.", "SOA", 3600, "ns1.example.org. hostmaster.example.org. 1 10800 3600 604800 3600"),
+		// stored without the trailing dot, which is the same target
+		rrset("www.example.org.", "CNAME", 60, "cdn.example.net"),
+	)
+	m := &fakeMetrics{}
+	p := f.provider()
+	p.Metrics = m
+	desired := []libdns.Record{libdns.CNAME{Name: "www", TTL: time.Minute, Target: "cdn.example.net."}}
+
+	if err := p.ReplaceZoneRecords(ctx, "example.org.", desired); err != nil {
+		t.Fatalf("ReplaceZoneRecords: %s", err)
+	}
+	if len(f.Patches) != 0 {
+		t.Errorf("an rrset that already matches was written: %v", f.Patches)
+	}
+
+	p.ConflictRetries = 1
+	f.OnZoneGet = func(z *powerdns.Zone) { f.BumpSerial(z) }
+	desired = append(desired, libdns.TXT{Name: "www2", TTL: time.Minute, Text: "new"})
+	if _, err := p.ReplaceZone(ctx, "example.org.", desired); !errors.Is(err, ErrConcurrentModification) {
+		t.Errorf("expected ErrConcurrentModification for a zone that keeps changing, got %v", err)
+	}
+	if len(f.Patches) != 0 {
+		t.Errorf("a conflicting replace was written")
+	}
+	if want := []string{"replace ok", "replace error"}; !reflect.DeepEqual(m.ops, want) {
+		t.Errorf("metrics = %q, want %q", m.ops, want)
+	}
+}
@@ -0,0 +1,102 @@
+package powerdns
+
+import (
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// retryBackoff is the wait before the first retry of a request; it doubles
+// with every further attempt
+var retryBackoff = 500 * time.Millisecond
+
+// maxRetryBackoff caps the wait between two attempts
+const maxRetryBackoff = 10 * time.Second
+
+// defaultMaxRetryAfter caps the wait a Retry-After header asks for, if
+// Provider.MaxRetryAfter doesn't
+const defaultMaxRetryAfter = time.Minute
+
+// defaultRateLimitRetries is how often a 429 answer with a Retry-After
+// header is retried even if Provider.MaxRetries is lower, since the server
+// said when to come back
+const defaultRateLimitRetries = 2
+
+// retryTransport wraps http.RoundTripper to retry requests the server
+// answered with 503 Service Unavailable, as PowerDNS does while it reloads,
+// or with 429 Too Many Requests, as rate limiting proxies do.  A
+// Retry-After header in the answer is waited for, up to maxRetryAfter,
+// instead of the backoff.  retries may be zero, which still retries
+// such 429 answers.
+type retryTransport struct {
+	transport     http.RoundTripper
+	retries       int
+	maxRetryAfter time.Duration
+}
+
+func (r *retryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	backoff := retryBackoff
+	for attempt := 0; ; attempt++ {
+		resp, err := r.transport.RoundTrip(req)
+		if err != nil || !retryable(resp.StatusCode) {
+			return resp, err
+		}
+		after, hasAfter := retryAfter(resp.Header.Get("Retry-After"), time.Now())
+		retries := r.retries
+		if resp.StatusCode == http.StatusTooManyRequests && hasAfter {
+			retries = max(retries, defaultRateLimitRetries)
+		}
+		// a body that can't be sent again means we can't retry
+		if attempt >= retries || (req.Body != nil && req.GetBody == nil) {
+			return resp, nil
+		}
+		wait := backoff
+		if hasAfter {
+			wait = min(after, r.maxRetryAfter)
+		}
+		_, _ = io.Copy(io.Discard, resp.Body)
+		_ = resp.Body.Close()
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-req.Context().Done():
+			timer.Stop()
+			return nil, req.Context().Err()
+		case <-timer.C:
+		}
+		backoff = min(2*backoff, maxRetryBackoff)
+
+		if req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			req = req.Clone(req.Context())
+			req.Body = body
+		}
+	}
+}
+
+func retryable(status int) bool {
+	return status == http.StatusServiceUnavailable || status == http.StatusTooManyRequests
+}
+
+// retryAfter returns how long a Retry-After header value asks to wait,
+// given either as delta-seconds or as an HTTP date.  ok is false for a
+// missing or malformed value.
+func retryAfter(value string, now time.Time) (wait time.Duration, ok bool) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0, false
+	}
+	if secs, err := strconv.ParseUint(value, 10, 32); err == nil {
+		return time.Duration(secs) * time.Second, true
+	}
+	at, err := http.ParseTime(value)
+	if err != nil {
+		return 0, false
+	}
+	return max(at.Sub(now), 0), true
+}
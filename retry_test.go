@@ -0,0 +1,170 @@
+package powerdns
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/libdns/libdns"
+)
+
+func TestRetryOnUnavailable(t *testing.T) {
+	defer func(old time.Duration) { retryBackoff = old }(retryBackoff)
+	retryBackoff = time.Millisecond
+
+	f := newFakePDNS(t)
+	f.AddZone("example.org.")
+	// fail the first requests of a method with 503, like a reloading server
+	failures := map[string]int{}
+	var patches []string
+	f.Intercept = func(w http.ResponseWriter, r *http.Request) bool {
+		if r.Method == http.MethodPatch {
+			body, _ := io.ReadAll(r.Body)
+			patches = append(patches, string(body))
+			r.Body = io.NopCloser(bytes.NewReader(body))
+		}
+		if failures[r.Method] > 0 {
+			failures[r.Method]--
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return true
+		}
+		return false
+	}
+	p := &Provider{ServerURL: f.URL, APIToken: "secret", MaxRetries: 2}
+	ctx := context.Background()
+
+	failures[http.MethodGet] = 2
+	if _, err := p.GetRecords(ctx, "example.org."); err != nil {
+		t.Fatalf("GetRecords was not retried: %s", err)
+	}
+
+	failures[http.MethodPatch] = 2
+	if _, err := p.AppendRecords(ctx, "example.org.", []libdns.Record{
+		libdns.TXT{Name: "www", Text: "hello"},
+	}); err != nil {
+		t.Fatalf("AppendRecords was not retried: %s", err)
+	}
+	if len(patches) != 3 || patches[1] != patches[0] || patches[2] != patches[0] {
+		t.Errorf("expected the same PATCH three times, got %q", patches)
+	}
+	if f.RRset("example.org.", "www.example.org.", "TXT") == nil {
+		t.Errorf("record not added after the retries")
+	}
+
+	// three failures exhaust the retries
+	failures[http.MethodGet] = 3
+	if _, err := p.GetRecords(ctx, "example.org."); !errors.Is(err, ErrServerUnavailable) {
+		t.Errorf("expected ErrServerUnavailable, got %v", err)
+	}
+
+	// without retries the first 503 is returned
+	failures[http.MethodGet] = 1
+	noRetry := &Provider{ServerURL: f.URL, APIToken: "secret"}
+	if _, err := noRetry.GetRecords(ctx, "example.org."); !errors.Is(err, ErrServerUnavailable) {
+		t.Errorf("expected ErrServerUnavailable, got %v", err)
+	}
+	failures[http.MethodGet] = 0
+
+	// waiting for a retry ends with the context
+	failures[http.MethodGet] = 1
+	retryBackoff = time.Hour
+	cancelCtx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	if _, err := p.GetRecords(cancelCtx, "example.org."); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected the deadline to end the wait, got %v", err)
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	for value, want := range map[string]time.Duration{
+		"120":                           2 * time.Minute,
+		" 0 ":                           0,
+		"Wed, 01 May 2024 12:00:30 GMT": 30 * time.Second,
+		"Wed, 01 May 2024 11:00:00 GMT": 0,
+	} {
+		if got, ok := retryAfter(value, now); !ok || got != want {
+			t.Errorf("retryAfter(%q) = %s, %v, want %s", value, got, ok, want)
+		}
+	}
+	for _, value := range []string{"", "soon", "-5", "1.5"} {
+		if _, ok := retryAfter(value, now); ok {
+			t.Errorf("retryAfter(%q) should not be usable", value)
+		}
+	}
+}
+
+func TestRetryOnTooManyRequests(t *testing.T) {
+	defer func(old time.Duration) { retryBackoff = old }(retryBackoff)
+	retryBackoff = time.Hour
+
+	f := newFakePDNS(t)
+	f.AddZone("example.org.")
+	var limited int
+	var header string
+	f.Intercept = func(w http.ResponseWriter, r *http.Request) bool {
+		if limited > 0 {
+			limited--
+			if header != "" {
+				w.Header().Set("Retry-After", header)
+			}
+			w.WriteHeader(http.StatusTooManyRequests)
+			return true
+		}
+		return false
+	}
+	p := &Provider{ServerURL: f.URL, APIToken: "secret", MaxRetries: 2, MaxRetryAfter: 20 * time.Millisecond}
+	ctx := context.Background()
+
+	// both forms are waited for instead of the hour of backoff, the
+	// seconds cut short to MaxRetryAfter
+	for _, h := range []string{"3600", time.Now().UTC().Add(-time.Second).Format(http.TimeFormat)} {
+		limited, header = 1, h
+		start := time.Now()
+		if _, err := p.GetRecords(ctx, "example.org."); err != nil {
+			t.Fatalf("Retry-After %q: GetRecords was not retried: %s", h, err)
+		}
+		if d := time.Since(start); d > time.Second {
+			t.Errorf("Retry-After %q: waited %s", h, d)
+		}
+	}
+
+	// without the header the backoff applies, which the context ends
+	limited, header = 1, ""
+	short, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+	defer cancel()
+	if _, err := p.GetRecords(short, "example.org."); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected the backoff to outlast the context, got %v", err)
+	}
+	retryBackoff = time.Millisecond
+	limited = 1
+	if _, err := p.GetRecords(ctx, "example.org."); err != nil {
+		t.Errorf("GetRecords was not retried after the backoff: %s", err)
+	}
+
+	limited, header = 3, "0"
+	if _, err := p.GetRecords(ctx, "example.org."); !errors.Is(err, ErrRateLimited) {
+		t.Errorf("expected ErrRateLimited once the retries are used up, got %v", err)
+	}
+
+	// without MaxRetries a 429 with Retry-After is still retried, twice,
+	// but one without it is returned
+	noRetry := &Provider{ServerURL: f.URL, APIToken: "secret", MaxRetryAfter: 20 * time.Millisecond}
+	limited, header = 2, "1"
+	if _, err := noRetry.GetRecords(ctx, "example.org."); err != nil {
+		t.Errorf("GetRecords was not retried without MaxRetries: %s", err)
+	}
+	limited = 3
+	if _, err := noRetry.GetRecords(ctx, "example.org."); !errors.Is(err, ErrRateLimited) {
+		t.Errorf("expected ErrRateLimited after two retries, got %v", err)
+	}
+	limited, header = 1, ""
+	if _, err := noRetry.GetRecords(ctx, "example.org."); !errors.Is(err, ErrRateLimited) {
+		t.Errorf("expected ErrRateLimited without Retry-After, got %v", err)
+	}
+	limited = 0
+}
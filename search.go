@@ -0,0 +1,122 @@
+package powerdns
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/joeig/go-powerdns/v3"
+)
+
+// SearchResult is a match of a search on the server.
+type SearchResult struct {
+	// ObjectType is what matched: record, zone or comment.
+	ObjectType string
+
+	// Zone is the zone the match is in.
+	Zone string
+
+	// Name is the fully qualified name of the record or zone.
+	Name string
+
+	// Type, Content, TTL and Disabled describe a matching record.
+	Type     string
+	Content  string
+	TTL      time.Duration
+	Disabled bool
+}
+
+// SearchOptions narrows what SearchFiltered returns.  Empty fields match
+// everything.
+type SearchOptions struct {
+	// ObjectType is "record", "zone" or "comment" to search only objects
+	// of that type.
+	ObjectType string
+
+	// Zone, if set, keeps only matches in that zone.
+	Zone string
+}
+
+// maxSearchFetch caps how many results a search scoped to a zone asks
+// the server for while looking for enough matches in the zone
+const maxSearchFetch = 10000
+
+// Search searches the server for zones, records and comments matching
+// query, where * matches any number of characters and ? a single one.
+// Records match on their name or content.  At most max results are
+// returned.
+func (p *Provider) Search(ctx context.Context, query string, max int) ([]SearchResult, error) {
+	return p.SearchFiltered(ctx, query, max, SearchOptions{})
+}
+
+// SearchRecords searches the records on the server whose name or content
+// matches query, like SearchFiltered with ObjectType "record".
+func (p *Provider) SearchRecords(ctx context.Context, query, zone string, max int) ([]SearchResult, error) {
+	return p.SearchFiltered(ctx, query, max, SearchOptions{ObjectType: string(powerdns.SearchObjectTypeRecord), Zone: zone})
+}
+
+// SearchFiltered searches the server like Search, for the objects opts
+// selects.  PowerDNS can't scope a search to a zone, and cuts the results
+// down to max over all zones, so with a Zone more results are asked for
+// until max of them are in the zone or the server has no more.  At most
+// 10000 results are asked for, so a zone-scoped search can return fewer
+// than max matches if more than that match in other zones.
+func (p *Provider) SearchFiltered(ctx context.Context, query string, max int, opts SearchOptions) ([]SearchResult, error) {
+	objectType := powerdns.SearchObjectTypeAll
+	switch opts.ObjectType {
+	case "":
+	case string(powerdns.SearchObjectTypeRecord), string(powerdns.SearchObjectTypeZone), string(powerdns.SearchObjectTypeComment):
+		objectType = powerdns.SearchObjectType(opts.ObjectType)
+	default:
+		return nil, fmt.Errorf("invalid search object type %q, expected record, zone or comment", opts.ObjectType)
+	}
+	if opts.Zone == "" {
+		return p.search(ctx, query, max, objectType)
+	}
+	zone := CanonicalZone(opts.Zone)
+	for fetch := max; ; fetch = min(4*fetch, maxSearchFetch) {
+		results, err := p.search(ctx, query, fetch, objectType)
+		if err != nil {
+			return nil, err
+		}
+		scoped := make([]SearchResult, 0, max)
+		for _, r := range results {
+			if CanonicalZone(r.Zone) == zone && len(scoped) < max {
+				scoped = append(scoped, r)
+			}
+		}
+		if len(scoped) >= max || len(results) < fetch || fetch >= maxSearchFetch {
+			return scoped, nil
+		}
+	}
+}
+
+// search runs a search-data query for objects of the given type
+func (p *Provider) search(ctx context.Context, query string, max int, objectType powerdns.SearchObjectType) ([]SearchResult, error) {
+	c, err := p.readClient(ctx)
+	if err != nil {
+		return nil, err
+	}
+	found, err := c.Search.Data(ctx, query, max, objectType)
+	if err != nil {
+		return nil, c.checkSchema(ctx, wrapAPIError(err, ""))
+	}
+	results := make([]SearchResult, 0, len(found))
+	for _, f := range found {
+		r := SearchResult{
+			ObjectType: powerdns.StringValue(f.ObjectType),
+			Zone:       powerdns.StringValue(f.Zone),
+			Name:       powerdns.StringValue(f.Name),
+			Type:       powerdns.StringValue(f.Type),
+			Content:    powerdns.StringValue(f.Content),
+			TTL:        time.Duration(powerdns.Uint32Value(f.TTL)) * time.Second,
+			Disabled:   powerdns.BoolValue(f.Disabled),
+		}
+		if r.Zone == "" && strings.EqualFold(r.ObjectType, string(powerdns.SearchObjectTypeZone)) {
+			r.Zone = r.Name
+		}
+		results = append(results, r)
+	}
+	return results, nil
+}
@@ -0,0 +1,131 @@
+package powerdns
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/joeig/go-powerdns/v3"
+)
+
+func TestSearchRecords(t *testing.T) {
+	f := newFakePDNS(t)
+	f.AddZone("example.org.",
+		rrset("www.example.org.", "A", 60, "192.0.2.1"),
+		rrset("mail.example.org.", "A", 60, "192.0.2.2"),
+	)
+	f.AddZone("example.net.",
+		rrset("www.example.net.", "A", 300, "192.0.2.1"),
+	)
+	p := f.provider()
+
+	all, err := p.SearchRecords(context.Background(), "192.0.2.1", "", 100)
+	if err != nil {
+		t.Fatalf("SearchRecords: %s", err)
+	}
+	if len(all) != 2 {
+		t.Errorf("expected a match in each zone, got %#v", all)
+	}
+
+	scoped, err := p.SearchRecords(context.Background(), "www.*", "Example.org", 100)
+	if err != nil {
+		t.Fatalf("SearchRecords: %s", err)
+	}
+	want := SearchResult{ObjectType: "record", Zone: "example.org.", Name: "www.example.org.", Type: "A", Content: "192.0.2.1", TTL: time.Minute}
+	if len(scoped) != 1 || scoped[0] != want {
+		t.Errorf("unexpected scoped results %#v", scoped)
+	}
+	if n := f.CallCount("GET", "/search-data"); n != 2 {
+		t.Errorf("expected two searches, got %d", n)
+	}
+}
+
+func TestSearchFiltered(t *testing.T) {
+	ctx := context.Background()
+	f := newFakePDNS(t)
+	www := rrset("www.example.org.", "A", 60, "192.0.2.1")
+	www.Comments = []powerdns.Comment{{Content: powerdns.String("web server")}}
+	f.AddZone("example.org.", www)
+	web := rrset("web.example.net.", "A", 60, "192.0.2.2", "192.0.2.3", "192.0.2.4")
+	web.Comments = []powerdns.Comment{{Content: powerdns.String("web cluster")}}
+	f.AddZone("example.net.", web)
+	p := f.provider()
+
+	kinds := func(results []SearchResult) []string {
+		out := make([]string, 0, len(results))
+		for _, r := range results {
+			out = append(out, r.ObjectType+" "+r.Zone+" "+r.Content)
+		}
+		return out
+	}
+	for _, tc := range []struct {
+		query string
+		opts  SearchOptions
+		want  []string
+	}{
+		{"example.*", SearchOptions{ObjectType: "zone"}, []string{"zone example.net. ", "zone example.org. "}},
+		{"example.*", SearchOptions{ObjectType: "zone", Zone: "example.org"}, []string{"zone example.org. "}},
+		{"web *", SearchOptions{ObjectType: "comment"}, []string{"comment example.net. web cluster", "comment example.org. web server"}},
+		{"web *", SearchOptions{ObjectType: "comment", Zone: "example.org."}, []string{"comment example.org. web server"}},
+		{"web *", SearchOptions{}, []string{"comment example.net. web cluster", "comment example.org. web server"}},
+	} {
+		results, err := p.SearchFiltered(ctx, tc.query, 10, tc.opts)
+		if err != nil {
+			t.Fatalf("%q %+v: %s", tc.query, tc.opts, err)
+		}
+		if have := kinds(results); !reflect.DeepEqual(have, tc.want) {
+			t.Errorf("%q %+v: have %q want %q", tc.query, tc.opts, have, tc.want)
+		}
+	}
+	if _, err := p.SearchFiltered(ctx, "*", 10, SearchOptions{ObjectType: "rrset"}); err == nil {
+		t.Error("expected an error for an unknown object type")
+	}
+
+	// the matches in example.net. come first and use up max, so more are
+	// asked for to find the one in example.org.
+	results, err := p.SearchRecords(ctx, "192.0.2.*", "example.org.", 2)
+	if err != nil {
+		t.Fatalf("SearchRecords: %s", err)
+	}
+	if have := kinds(results); !reflect.DeepEqual(have, []string{"record example.org. 192.0.2.1"}) {
+		t.Errorf("SearchRecords scoped to example.org. = %q", have)
+	}
+}
+
+func TestSearch(t *testing.T) {
+	var query string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v1/servers/localhost/search-data" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		query = r.URL.RawQuery
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`[
+			{"object_type": "zone", "name": "example.org.", "zone_id": "example.org."},
+			{"object_type": "record", "name": "www.example.org.", "type": "A", "content": "192.0.2.1", "ttl": 60, "disabled": false, "zone": "example.org.", "zone_id": "example.org."},
+			{"object_type": "comment", "name": "www.example.org.", "type": "A", "content": "managed by ops", "zone": "example.org.", "zone_id": "example.org."}
+		]`))
+	}))
+	defer srv.Close()
+	p := &Provider{ServerURL: srv.URL, APIToken: "secret"}
+
+	results, err := p.Search(context.Background(), "*example?org*", 10)
+	if err != nil {
+		t.Fatalf("Search: %s", err)
+	}
+	if query != "max=10&object_type=all&q=%2Aexample%3Forg%2A" {
+		t.Errorf("unexpected query %s", query)
+	}
+	want := []SearchResult{
+		{ObjectType: "zone", Zone: "example.org.", Name: "example.org."},
+		{ObjectType: "record", Zone: "example.org.", Name: "www.example.org.", Type: "A", Content: "192.0.2.1", TTL: time.Minute},
+		{ObjectType: "comment", Zone: "example.org.", Name: "www.example.org.", Type: "A", Content: "managed by ops"},
+	}
+	if !reflect.DeepEqual(results, want) {
+		t.Errorf("unexpected results:\nhave %#v\nwant %#v", results, want)
+	}
+}
@@ -0,0 +1,97 @@
+package powerdns
+
+import (
+	"context"
+	"regexp"
+	"strconv"
+
+	"github.com/joeig/go-powerdns/v3"
+)
+
+// Ping checks that the server can be reached and accepts the API token,
+// e.g. before starting to work with it.  It fetches the server's own
+// entry, which is much cheaper than listing the zones.  A rejected token
+// gives an error wrapping ErrUnauthorized, an unknown ServerID one
+// wrapping ErrNotFound; a server that can't be reached at all gives the
+// connection error.
+func (p *Provider) Ping(ctx context.Context) error {
+	c, err := p.client(ctx)
+	if err != nil {
+		return err
+	}
+	_, err = c.Servers.Get(ctx, c.VHost)
+	return wrapAPIError(err, "")
+}
+
+// ServerInfo describes the PowerDNS server, for callers that adapt to the
+// features of its version.
+type ServerInfo struct {
+	ID string
+
+	// DaemonType is "authoritative" for the servers this package works
+	// with, or "recursor".
+	DaemonType string
+
+	// Version is the version the server reports, e.g. "4.9.0" or
+	// "4.8.0-alpha1".  Major, Minor and Patch are its numeric parts, zero
+	// if the version doesn't start with them, as for development builds.
+	Version string
+	Major   int
+	Minor   int
+	Patch   int
+
+	// parsed is whether Major, Minor and Patch come from Version
+	parsed bool
+}
+
+// Known reports whether Major, Minor and Patch were parsed from Version.
+// They are not for development builds, nor for a zero ServerInfo.
+func (s ServerInfo) Known() bool {
+	return s.parsed
+}
+
+// AtLeast reports whether the server runs PowerDNS major.minor or later.
+// It is false if the version is not Known, so check that first to treat
+// development builds as recent.
+func (s ServerInfo) AtLeast(major, minor int) bool {
+	if !s.parsed {
+		return false
+	}
+	return s.Major > major || (s.Major == major && s.Minor >= minor)
+}
+
+// ServerInfo returns the id, daemon type and version of the server.  It is
+// fetched once per provider and then remembered, as the provider does for
+// the version checks of its own methods.
+func (p *Provider) ServerInfo(ctx context.Context) (ServerInfo, error) {
+	c, err := p.readClient(ctx)
+	if err != nil {
+		return ServerInfo{}, err
+	}
+	server, err := c.serverEntry(ctx)
+	if err != nil {
+		return ServerInfo{}, err
+	}
+	info := parseVersion(powerdns.StringValue(server.Version))
+	info.ID = powerdns.StringValue(server.ID)
+	info.DaemonType = powerdns.StringValue(server.DaemonType)
+	return info, nil
+}
+
+// versionPattern matches the numeric start of a version, with an optional
+// patch level
+var versionPattern = regexp.MustCompile(`^(\d+)\.(\d+)(?:\.(\d+))?`)
+
+// parseVersion returns a ServerInfo with just the version fields set
+func parseVersion(version string) ServerInfo {
+	info := ServerInfo{Version: version}
+	m := versionPattern.FindStringSubmatch(version)
+	if m == nil {
+		return info
+	}
+	info.Major, _ = strconv.Atoi(m[1])
+	info.Minor, _ = strconv.Atoi(m[2])
+	info.Patch, _ = strconv.Atoi(m[3])
+	info.parsed = true
+	return info
+}
@@ -0,0 +1,84 @@
+package powerdns
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestPing(t *testing.T) {
+	ctx := context.Background()
+	f := newFakePDNS(t)
+	p := f.provider()
+
+	if err := p.Ping(ctx); err != nil {
+		t.Errorf("Ping: %s", err)
+	}
+	if n := f.CallCount("GET", "/servers/localhost"); n != 1 {
+		t.Errorf("expected one request for the server, got %d", n)
+	}
+
+	bad := &Provider{ServerURL: f.URL, APIToken: "wrong"}
+	if err := bad.Ping(ctx); !errors.Is(err, ErrUnauthorized) {
+		t.Errorf("expected ErrUnauthorized, got %v", err)
+	}
+
+	closed := httptest.NewServer(nil)
+	closed.Close()
+	down := &Provider{ServerURL: closed.URL, APIToken: "secret"}
+	err := down.Ping(ctx)
+	var opErr *net.OpError
+	if !errors.As(err, &opErr) || errors.Is(err, ErrUnauthorized) {
+		t.Errorf("expected a connection error, got %v", err)
+	}
+}
+
+func TestServerInfo(t *testing.T) {
+	ctx := context.Background()
+	f := newFakePDNS(t)
+	f.Version = "4.8.0-alpha1"
+	p := f.provider()
+
+	info, err := p.ServerInfo(ctx)
+	if err != nil {
+		t.Fatalf("ServerInfo: %s", err)
+	}
+	want := ServerInfo{ID: "localhost", DaemonType: "authoritative", Version: "4.8.0-alpha1", Major: 4, Minor: 8, parsed: true}
+	if !reflect.DeepEqual(info, want) {
+		t.Errorf("ServerInfo = %+v, want %+v", info, want)
+	}
+	if !info.AtLeast(4, 7) || !info.AtLeast(4, 8) || info.AtLeast(4, 9) || info.AtLeast(5, 0) {
+		t.Errorf("wrong AtLeast for %s", info.Version)
+	}
+	if _, err := p.ServerInfo(ctx); err != nil {
+		t.Fatalf("ServerInfo: %s", err)
+	}
+	if n := f.CallCount("GET", "/servers/localhost"); n != 1 {
+		t.Errorf("expected the server to be fetched once, got %d", n)
+	}
+
+	for version, want := range map[string][3]int{
+		"4.9.1":   {4, 9, 1},
+		"4.10":    {4, 10, 0},
+		"5.0.0rc": {5, 0, 0},
+	} {
+		info := parseVersion(version)
+		if got := [3]int{info.Major, info.Minor, info.Patch}; got != want || !info.Known() {
+			t.Errorf("parseVersion(%q) = %v, want %v", version, got, want)
+		}
+	}
+	if info := parseVersion("master"); info.Known() || info.AtLeast(4, 0) {
+		t.Errorf("an unparsable version should not claim any version: %+v", info)
+	}
+	if (ServerInfo{}).Known() || (ServerInfo{}).AtLeast(0, 0) {
+		t.Error("a zero ServerInfo should not claim any version")
+	}
+
+	bad := &Provider{ServerURL: f.URL, APIToken: "wrong"}
+	if _, err := bad.ServerInfo(ctx); !errors.Is(err, ErrUnauthorized) {
+		t.Errorf("expected ErrUnauthorized, got %v", err)
+	}
+}
@@ -0,0 +1,241 @@
+package powerdns
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/netip"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/libdns/libdns"
+)
+
+// SvcParamOption sets a single parameter of the SvcParams built by
+// NewSvcParams.
+type SvcParamOption func(libdns.SvcParams) error
+
+// NewSvcParams builds the SvcParams of an HTTPS or SVCB record from typed
+// options, for example
+//
+//	params, err := NewSvcParams(WithALPN("h2", "h3"), WithPort(8443))
+//
+// It checks that every key listed by WithMandatory is present.
+func NewSvcParams(opts ...SvcParamOption) (libdns.SvcParams, error) {
+	params := make(libdns.SvcParams)
+	for _, opt := range opts {
+		if err := opt(params); err != nil {
+			return nil, err
+		}
+	}
+	for _, key := range params["mandatory"] {
+		if _, ok := params[key]; !ok {
+			return nil, fmt.Errorf("mandatory key %q is not set", key)
+		}
+	}
+	return params, nil
+}
+
+// WithALPN sets the alpn parameter to the protocol ids, e.g. "h2" or "h3".
+func WithALPN(protocols ...string) SvcParamOption {
+	return func(params libdns.SvcParams) error {
+		if len(protocols) == 0 {
+			return fmt.Errorf("alpn needs at least one protocol")
+		}
+		for _, p := range protocols {
+			if p == "" || len(p) > 255 {
+				return fmt.Errorf("invalid alpn protocol id %q", p)
+			}
+		}
+		params["alpn"] = slices.Clone(protocols)
+		return nil
+	}
+}
+
+// WithPort sets the port parameter.
+func WithPort(port uint16) SvcParamOption {
+	return func(params libdns.SvcParams) error {
+		if port == 0 {
+			return fmt.Errorf("port must not be 0")
+		}
+		params["port"] = []string{strconv.Itoa(int(port))}
+		return nil
+	}
+}
+
+// WithECH sets the ech parameter to the given ECHConfigList, which is
+// base64 encoded as the presentation format requires.
+func WithECH(configList []byte) SvcParamOption {
+	return func(params libdns.SvcParams) error {
+		if len(configList) == 0 {
+			return fmt.Errorf("ech needs a config list")
+		}
+		params["ech"] = []string{base64.StdEncoding.EncodeToString(configList)}
+		return nil
+	}
+}
+
+// WithIPv4Hint sets the ipv4hint parameter.  All addresses must be IPv4.
+func WithIPv4Hint(addrs ...netip.Addr) SvcParamOption {
+	return func(params libdns.SvcParams) error {
+		hints, err := addrHints(addrs, netip.Addr.Is4)
+		if err != nil {
+			return fmt.Errorf("ipv4hint: %w", err)
+		}
+		params["ipv4hint"] = hints
+		return nil
+	}
+}
+
+// WithIPv6Hint sets the ipv6hint parameter.  All addresses must be IPv6.
+func WithIPv6Hint(addrs ...netip.Addr) SvcParamOption {
+	return func(params libdns.SvcParams) error {
+		hints, err := addrHints(addrs, func(a netip.Addr) bool { return a.Is6() && !a.Is4In6() })
+		if err != nil {
+			return fmt.Errorf("ipv6hint: %w", err)
+		}
+		params["ipv6hint"] = hints
+		return nil
+	}
+}
+
+// WithMandatory sets the mandatory parameter to the keys a client must
+// understand to use the record.
+func WithMandatory(keys ...string) SvcParamOption {
+	return func(params libdns.SvcParams) error {
+		if len(keys) == 0 {
+			return fmt.Errorf("mandatory needs at least one key")
+		}
+		for _, k := range keys {
+			if k == "mandatory" {
+				return fmt.Errorf("mandatory must not list itself")
+			}
+			if _, ok := svcParamKeyNumber(k); !ok {
+				return fmt.Errorf("invalid mandatory key %q", k)
+			}
+		}
+		params["mandatory"] = slices.Clone(keys)
+		return nil
+	}
+}
+
+func addrHints(addrs []netip.Addr, valid func(netip.Addr) bool) ([]string, error) {
+	if len(addrs) == 0 {
+		return nil, fmt.Errorf("at least one address is needed")
+	}
+	hints := make([]string, 0, len(addrs))
+	for _, a := range addrs {
+		if !a.IsValid() || !valid(a) {
+			return nil, fmt.Errorf("invalid address %v", a)
+		}
+		hints = append(hints, a.String())
+	}
+	return hints, nil
+}
+
+// SVCBParams is the typed form of the SvcParams of an HTTPS or SVCB
+// record.  Zero values mean the parameter is absent.
+type SVCBParams struct {
+	Mandatory     []string
+	ALPN          []string
+	NoDefaultALPN bool
+	Port          uint16
+	IPv4Hint      []netip.Addr
+	ECH           []byte
+	IPv6Hint      []netip.Addr
+
+	// Other holds the parameters without a field above.
+	Other libdns.SvcParams
+}
+
+// ParseSVCBParams turns SvcParams, as found in a libdns.ServiceBinding
+// returned by GetRecords, into their typed form.
+func ParseSVCBParams(params libdns.SvcParams) (SVCBParams, error) {
+	var out SVCBParams
+	for key, vals := range params {
+		switch key {
+		case "mandatory":
+			out.Mandatory = slices.Clone(vals)
+		case "alpn":
+			out.ALPN = slices.Clone(vals)
+		case "no-default-alpn":
+			out.NoDefaultALPN = true
+		case "port":
+			if len(vals) != 1 {
+				return SVCBParams{}, fmt.Errorf("port needs exactly one value, got %d", len(vals))
+			}
+			port, err := strconv.ParseUint(vals[0], 10, 16)
+			if err != nil {
+				return SVCBParams{}, fmt.Errorf("invalid port %q: %w", vals[0], err)
+			}
+			out.Port = uint16(port)
+		case "ipv4hint", "ipv6hint":
+			addrs := make([]netip.Addr, 0, len(vals))
+			for _, v := range vals {
+				a, err := netip.ParseAddr(v)
+				if err != nil {
+					return SVCBParams{}, fmt.Errorf("invalid %s: %w", key, err)
+				}
+				addrs = append(addrs, a)
+			}
+			if key == "ipv4hint" {
+				out.IPv4Hint = addrs
+			} else {
+				out.IPv6Hint = addrs
+			}
+		case "ech":
+			if len(vals) != 1 {
+				return SVCBParams{}, fmt.Errorf("ech needs exactly one value, got %d", len(vals))
+			}
+			ech, err := base64.StdEncoding.DecodeString(vals[0])
+			if err != nil {
+				return SVCBParams{}, fmt.Errorf("invalid ech: %w", err)
+			}
+			out.ECH = ech
+		default:
+			if out.Other == nil {
+				out.Other = make(libdns.SvcParams)
+			}
+			out.Other[key] = slices.Clone(vals)
+		}
+	}
+	return out, nil
+}
+
+// svcParamKeys are the SvcParamKeys with a name, indexed by their number
+var svcParamKeys = []string{"mandatory", "alpn", "no-default-alpn", "port", "ipv4hint", "ech", "ipv6hint"}
+
+// svcParamKeyNumber returns the number of a named or keyNNNNN key
+func svcParamKeyNumber(key string) (int, bool) {
+	if i := slices.Index(svcParamKeys, key); i >= 0 {
+		return i, true
+	}
+	if n, err := strconv.ParseUint(strings.TrimPrefix(key, "key"), 10, 16); err == nil && strings.HasPrefix(key, "key") {
+		return int(n), true
+	}
+	return 0, false
+}
+
+// sortedSvcParamKeys returns the keys of params in the ascending key
+// number order RFC 9460 requires on the wire.  Keys that aren't valid
+// SvcParamKeys go last, sorted by name.
+func sortedSvcParamKeys(params libdns.SvcParams) []string {
+	keys := make([]string, 0, len(params))
+	for k := range params {
+		keys = append(keys, k)
+	}
+	slices.SortFunc(keys, func(a, b string) int {
+		na, oka := svcParamKeyNumber(a)
+		nb, okb := svcParamKeyNumber(b)
+		switch {
+		case oka && okb:
+			return na - nb
+		case oka:
+			return -1
+		case okb:
+			return 1
+		}
+		return strings.Compare(a, b)
+	})
+	return keys
+}
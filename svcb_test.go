@@ -0,0 +1,70 @@
+package powerdns
+
+import (
+	"net/netip"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/libdns/libdns"
+)
+
+func TestSvcParamsHelpers(t *testing.T) {
+	ech := []byte("not really an ECHConfigList")
+	params, err := NewSvcParams(
+		WithMandatory("alpn", "port"),
+		WithALPN("h2", "h3"),
+		WithPort(8443),
+		WithIPv4Hint(netip.MustParseAddr("192.0.2.1"), netip.MustParseAddr("192.0.2.2")),
+		WithIPv6Hint(netip.MustParseAddr("2001:db8::1")),
+		WithECH(ech),
+	)
+	if err != nil {
+		t.Fatalf("NewSvcParams: %s", err)
+	}
+
+	rr := svcbToRr(libdns.ServiceBinding{
+		Name: "www.example.org.", Scheme: "https", TTL: time.Hour, Priority: 1, Target: ".", Params: params,
+	})
+	want := libdns.RR{
+		Name: "www.example.org.",
+		Type: "HTTPS",
+		TTL:  time.Hour,
+		Data: `1 . mandatory=alpn,port alpn=h2,h3 port=8443 ipv4hint=192.0.2.1,192.0.2.2 ech="bm90IHJlYWxseSBhbiBFQ0hDb25maWdMaXN0" ipv6hint=2001:db8::1`,
+	}
+	if rr != want {
+		t.Errorf("serialized record:\nhave %#v\nwant %#v", rr, want)
+	}
+
+	typed, err := ParseSVCBParams(params)
+	if err != nil {
+		t.Fatalf("ParseSVCBParams: %s", err)
+	}
+	wantTyped := SVCBParams{
+		Mandatory: []string{"alpn", "port"},
+		ALPN:      []string{"h2", "h3"},
+		Port:      8443,
+		IPv4Hint:  []netip.Addr{netip.MustParseAddr("192.0.2.1"), netip.MustParseAddr("192.0.2.2")},
+		ECH:       ech,
+		IPv6Hint:  []netip.Addr{netip.MustParseAddr("2001:db8::1")},
+	}
+	if !reflect.DeepEqual(typed, wantTyped) {
+		t.Errorf("ParseSVCBParams:\nhave %#v\nwant %#v", typed, wantTyped)
+	}
+}
+
+func TestSvcParamsValidation(t *testing.T) {
+	for name, opts := range map[string][]SvcParamOption{
+		"missing mandatory key":  {WithMandatory("port"), WithALPN("h2")},
+		"mandatory lists itself": {WithMandatory("mandatory")},
+		"unknown mandatory key":  {WithMandatory("bogus")},
+		"IPv6 in ipv4hint":       {WithIPv4Hint(netip.MustParseAddr("2001:db8::1"))},
+		"IPv4 in ipv6hint":       {WithIPv6Hint(netip.MustParseAddr("192.0.2.1"))},
+		"empty alpn":             {WithALPN()},
+		"zero port":              {WithPort(0)},
+	} {
+		if _, err := NewSvcParams(opts...); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
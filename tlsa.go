@@ -0,0 +1,226 @@
+package powerdns
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/libdns/libdns"
+)
+
+// TLSA is a DANE TLSA record (RFC 6698), which libdns has no struct for.
+// GetRecords returns TLSA records as this type, and it can be written like
+// any other record.
+type TLSA struct {
+	Name string
+	TTL  time.Duration
+
+	// Usage, Selector and MatchingType say which certificate or key
+	// CertData matches and how, e.g. 3 1 1 for the SHA-256 hash of the
+	// server's public key.
+	Usage        uint8
+	Selector     uint8
+	MatchingType uint8
+
+	// CertData is the certificate association data in hex.  It is
+	// written and read back in lowercase.
+	CertData string
+}
+
+// RR returns the record in the form PowerDNS stores it.
+func (t TLSA) RR() libdns.RR {
+	return libdns.RR{
+		Name: t.Name,
+		TTL:  t.TTL,
+		Type: "TLSA",
+		Data: fmt.Sprintf("%d %d %d %s", t.Usage, t.Selector, t.MatchingType, strings.ToLower(t.CertData)),
+	}
+}
+
+// SSHFP is an SSH host key fingerprint record (RFC 4255), which libdns has
+// no struct for.  GetRecords returns SSHFP records as this type, and it can
+// be written like any other record.
+type SSHFP struct {
+	Name string
+	TTL  time.Duration
+
+	// Algorithm is the host key algorithm, e.g. 4 for Ed25519.
+	Algorithm uint8
+
+	// FingerprintType is the hash of the fingerprint, 1 for SHA-1 or 2
+	// for SHA-256.
+	FingerprintType uint8
+
+	// Fingerprint is the hash of the host key in hex.  It is written and
+	// read back in lowercase.
+	Fingerprint string
+}
+
+// RR returns the record in the form PowerDNS stores it.
+func (s SSHFP) RR() libdns.RR {
+	return libdns.RR{
+		Name: s.Name,
+		TTL:  s.TTL,
+		Type: "SSHFP",
+		Data: fmt.Sprintf("%d %d %s", s.Algorithm, s.FingerprintType, strings.ToLower(s.Fingerprint)),
+	}
+}
+
+// parseTLSA turns TLSA data in zone file form into a TLSA.  The hex data
+// may be split by spaces, as zone files allow.
+func parseTLSA(rr libdns.RR) (libdns.Record, error) {
+	fields := strings.Fields(rr.Data)
+	if len(fields) < 4 {
+		return nil, fmt.Errorf(`malformed TLSA value %q; expected "usage selector matching-type data"`, rr.Data)
+	}
+	var nums [3]uint8
+	for i, name := range []string{"usage", "selector", "matching type"} {
+		n, err := strconv.ParseUint(fields[i], 10, 8)
+		if err != nil {
+			return nil, fmt.Errorf("invalid TLSA %s %s: %v", name, fields[i], err)
+		}
+		nums[i] = uint8(n)
+	}
+	return TLSA{
+		Name:         rr.Name,
+		TTL:          rr.TTL,
+		Usage:        nums[0],
+		Selector:     nums[1],
+		MatchingType: nums[2],
+		CertData:     strings.ToLower(strings.Join(fields[3:], "")),
+	}, nil
+}
+
+// parseSSHFP turns SSHFP data in zone file form into an SSHFP
+func parseSSHFP(rr libdns.RR) (libdns.Record, error) {
+	fields := strings.Fields(rr.Data)
+	if len(fields) < 3 {
+		return nil, fmt.Errorf(`malformed SSHFP value %q; expected "algorithm type fingerprint"`, rr.Data)
+	}
+	var nums [2]uint8
+	for i, name := range []string{"algorithm", "fingerprint type"} {
+		n, err := strconv.ParseUint(fields[i], 10, 8)
+		if err != nil {
+			return nil, fmt.Errorf("invalid SSHFP %s %s: %v", name, fields[i], err)
+		}
+		nums[i] = uint8(n)
+	}
+	return SSHFP{
+		Name:            rr.Name,
+		TTL:             rr.TTL,
+		Algorithm:       nums[0],
+		FingerprintType: nums[1],
+		Fingerprint:     strings.ToLower(strings.Join(fields[2:], "")),
+	}, nil
+}
+
+// tlsaHashSizes are the data lengths in bytes of the TLSA matching types
+// that are hashes
+var tlsaHashSizes = map[uint8]int{1: 32, 2: 64}
+
+func validateTLSA(t TLSA) []error {
+	var errs []error
+	if t.Usage > 3 {
+		errs = append(errs, fmt.Errorf("invalid TLSA usage %d, expected 0 to 3", t.Usage))
+	}
+	if t.Selector > 1 {
+		errs = append(errs, fmt.Errorf("invalid TLSA selector %d, expected 0 or 1", t.Selector))
+	}
+	if t.MatchingType > 2 {
+		errs = append(errs, fmt.Errorf("invalid TLSA matching type %d, expected 0 to 2", t.MatchingType))
+	}
+	if err := validateHex("certificate data", t.CertData, tlsaHashSizes[t.MatchingType]); err != nil {
+		errs = append(errs, err)
+	}
+	return errs
+}
+
+// sshfpHashSizes are the fingerprint lengths in bytes of the SSHFP
+// fingerprint types
+var sshfpHashSizes = map[uint8]int{1: 20, 2: 32}
+
+func validateSSHFP(s SSHFP) []error {
+	var errs []error
+	if s.Algorithm == 0 {
+		errs = append(errs, errors.New("missing SSHFP algorithm"))
+	}
+	size, ok := sshfpHashSizes[s.FingerprintType]
+	if !ok {
+		errs = append(errs, fmt.Errorf("invalid SSHFP fingerprint type %d, expected 1 or 2", s.FingerprintType))
+	}
+	if err := validateHex("fingerprint", s.Fingerprint, size); err != nil {
+		errs = append(errs, err)
+	}
+	return errs
+}
+
+// validateHex checks that data is a non-empty hex string, of size bytes
+// unless size is 0
+func validateHex(what, data string, size int) error {
+	if data == "" {
+		return fmt.Errorf("missing %s", what)
+	}
+	b, err := hex.DecodeString(data)
+	if err != nil {
+		return fmt.Errorf("invalid %s: not hex", what)
+	}
+	if size > 0 && len(b) != size {
+		return fmt.Errorf("invalid %s: %d bytes, expected %d", what, len(b), size)
+	}
+	return nil
+}
+
+// validateLOC checks LOC data in the form of RFC 1876:
+//
+//	d1 [m1 [s1]] {N|S} d2 [m2 [s2]] {E|W} alt[m] [siz[m] [hp[m] [vp[m]]]]
+func validateLOC(data string) error {
+	fields := strings.Fields(data)
+	rest, err := locCoordinate(fields, "NS", 90)
+	if err != nil {
+		return fmt.Errorf("invalid LOC latitude: %w", err)
+	}
+	rest, err = locCoordinate(rest, "EW", 180)
+	if err != nil {
+		return fmt.Errorf("invalid LOC longitude: %w", err)
+	}
+	if len(rest) == 0 {
+		return errors.New("invalid LOC value: missing altitude")
+	}
+	if len(rest) > 4 {
+		return fmt.Errorf("invalid LOC value: unexpected %q", strings.Join(rest[4:], " "))
+	}
+	for i, name := range []string{"altitude", "size", "horizontal precision", "vertical precision"}[:len(rest)] {
+		v, err := strconv.ParseFloat(strings.TrimSuffix(rest[i], "m"), 64)
+		if err != nil || (i > 0 && v < 0) {
+			return fmt.Errorf("invalid LOC %s %q", name, rest[i])
+		}
+	}
+	return nil
+}
+
+// locCoordinate checks the degrees, optional minutes and seconds and the
+// direction of a LOC coordinate at the start of fields, and returns the
+// fields after it
+func locCoordinate(fields []string, directions string, maxDegrees int) ([]string, error) {
+	limits := []float64{float64(maxDegrees), 59, 59.999}
+	for i := 0; i < len(fields); i++ {
+		f := fields[i]
+		if len(f) == 1 && strings.Contains(directions, f) {
+			if i == 0 {
+				return nil, errors.New("missing degrees")
+			}
+			return fields[i+1:], nil
+		}
+		if i == len(limits) {
+			break
+		}
+		v, err := strconv.ParseFloat(f, 64)
+		if err != nil || v < 0 || v > limits[i] || (i < 2 && strings.Contains(f, ".")) {
+			return nil, fmt.Errorf("%q out of range", f)
+		}
+	}
+	return nil, fmt.Errorf("missing direction, expected one of %s", strings.Join(strings.Split(directions, ""), " or "))
+}
@@ -0,0 +1,90 @@
+package powerdns
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/libdns/libdns"
+)
+
+func TestTLSAAndSSHFPRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	f := newFakePDNS(t)
+	f.AddZone("example.org.")
+	p := f.provider()
+
+	hash := "0C72AC70B745AC19998811B131D662C9AC69DBDBE7CB23E5B514B56664C5D3D6"
+	in := []libdns.Record{
+		TLSA{Name: "_443._tcp.www", TTL: time.Hour, Usage: 3, Selector: 1, MatchingType: 1, CertData: hash},
+		SSHFP{Name: "host", TTL: time.Hour, Algorithm: 4, FingerprintType: 2, Fingerprint: hash},
+	}
+	if _, err := p.AppendRecords(ctx, "example.org.", in); err != nil {
+		t.Fatalf("AppendRecords: %s", err)
+	}
+	lower := strings.ToLower(hash)
+	if got := rrsetContents(f.RRset("example.org.", "_443._tcp.www.example.org.", "TLSA")); !reflect.DeepEqual(got, []string{"3 1 1 " + lower}) {
+		t.Errorf("unexpected TLSA contents %q", got)
+	}
+	if got := rrsetContents(f.RRset("example.org.", "host.example.org.", "SSHFP")); !reflect.DeepEqual(got, []string{"4 2 " + lower}) {
+		t.Errorf("unexpected SSHFP contents %q", got)
+	}
+
+	out, err := p.GetRecords(ctx, "example.org.")
+	if err != nil {
+		t.Fatalf("GetRecords: %s", err)
+	}
+	want := []libdns.Record{
+		TLSA{Name: "_443._tcp.www", TTL: time.Hour, Usage: 3, Selector: 1, MatchingType: 1, CertData: lower},
+		SSHFP{Name: "host", TTL: time.Hour, Algorithm: 4, FingerprintType: 2, Fingerprint: lower},
+	}
+	if !reflect.DeepEqual(out, want) {
+		t.Errorf("round trip:\nhave %#v\nwant %#v", out, want)
+	}
+
+	// the same values as plain RRs in uppercase are already there
+	added, err := p.AppendRecords(ctx, "example.org.", []libdns.Record{
+		libdns.RR{Name: "_443._tcp.www", TTL: time.Hour, Type: "TLSA", Data: "3 1 1 " + hash},
+		libdns.RR{Name: "host", TTL: time.Hour, Type: "SSHFP", Data: "4 2 " + hash[:32] + " " + hash[32:]},
+	})
+	if err != nil || len(added) != 0 {
+		t.Errorf("appending the uppercase values added %v, %v", added, err)
+	}
+}
+
+func TestValidateTLSASSHFPAndLOC(t *testing.T) {
+	hash := strings.Repeat("ab", 32)
+	valid := []libdns.Record{
+		TLSA{Name: "_443._tcp", Usage: 3, Selector: 1, MatchingType: 1, CertData: hash},
+		TLSA{Name: "_25._tcp.mail", Usage: 2, Selector: 0, MatchingType: 0, CertData: "3082"},
+		SSHFP{Name: "host", Algorithm: 4, FingerprintType: 2, Fingerprint: hash},
+		libdns.RR{Name: "host", Type: "SSHFP", Data: "1 1 " + strings.Repeat("0f", 20)},
+		libdns.RR{Name: "@", Type: "LOC", Data: "52 22 23.000 N 4 53 32.000 E -2.00m 0.00m 10000m 10m"},
+		libdns.RR{Name: "@", Type: "LOC", Data: "42 21 S 71 W 24m"},
+	}
+	if errs := ValidateRecords(valid); errs != nil {
+		t.Errorf("valid records reported as invalid: %v", errs)
+	}
+
+	for _, tc := range []struct {
+		rec  libdns.Record
+		want string
+	}{
+		{TLSA{Name: "_443._tcp", Usage: 4, Selector: 1, MatchingType: 1, CertData: hash}, "invalid TLSA usage 4"},
+		{TLSA{Name: "_443._tcp", Usage: 3, Selector: 1, MatchingType: 1, CertData: "abcd"}, "2 bytes, expected 32"},
+		{TLSA{Name: "_443._tcp", Usage: 3, Selector: 1, MatchingType: 0, CertData: "xyz"}, "not hex"},
+		{libdns.RR{Name: "_443._tcp", Type: "TLSA", Data: "3 1"}, "malformed TLSA value"},
+		{SSHFP{Name: "host", Algorithm: 4, FingerprintType: 3, Fingerprint: hash}, "invalid SSHFP fingerprint type 3"},
+		{SSHFP{Name: "host", Algorithm: 4, FingerprintType: 1, Fingerprint: hash}, "32 bytes, expected 20"},
+		{libdns.RR{Name: "@", Type: "LOC", Data: "91 N 4 E 0m"}, "invalid LOC latitude"},
+		{libdns.RR{Name: "@", Type: "LOC", Data: "52 22 N 4 53 0m"}, "invalid LOC longitude"},
+		{libdns.RR{Name: "@", Type: "LOC", Data: "52 N 4 E"}, "missing altitude"},
+	} {
+		errs := ValidateRecords([]libdns.Record{tc.rec})
+		if len(errs) == 0 || !strings.Contains(errs[0].Error(), tc.want) {
+			t.Errorf("%#v: expected an error about %q, got %v", tc.rec, tc.want, errs)
+		}
+	}
+}
@@ -0,0 +1,74 @@
+package powerdns
+
+import (
+	"context"
+
+	"github.com/joeig/go-powerdns/v3"
+)
+
+// TSIGKey is a key for authenticating zone transfers and NOTIFYs between
+// servers with TSIG (RFC 8945).
+type TSIGKey struct {
+	// ID identifies the key in the API, e.g. for DeleteTSIGKey.
+	ID   string
+	Name string
+
+	// Algorithm is the HMAC algorithm, such as "hmac-sha256".
+	Algorithm string
+
+	// Key is the base64 encoded secret.  It is set for a newly created
+	// key, but not in the results of ListTSIGKeys, as the server leaves it
+	// out there.
+	Key string
+}
+
+func tsigKeyOf(k *powerdns.TSIGKey) TSIGKey {
+	return TSIGKey{
+		ID:        powerdns.StringValue(k.ID),
+		Name:      powerdns.StringValue(k.Name),
+		Algorithm: powerdns.StringValue(k.Algorithm),
+		Key:       powerdns.StringValue(k.Key),
+	}
+}
+
+// CreateTSIGKey has the server generate a new TSIG key with the given name
+// and algorithm, and returns it along with its secret.  An algorithm the
+// server doesn't support is an error wrapping ErrValidation.
+func (p *Provider) CreateTSIGKey(ctx context.Context, name, algorithm string) (TSIGKey, error) {
+	c, err := p.client(ctx)
+	if err != nil {
+		return TSIGKey{}, err
+	}
+	k, err := c.TSIGKeys.Create(ctx, name, algorithm, "")
+	if err != nil {
+		return TSIGKey{}, wrapAPIError(err, "")
+	}
+	return tsigKeyOf(k), nil
+}
+
+// ListTSIGKeys returns the TSIG keys of the server, without their secrets.
+func (p *Provider) ListTSIGKeys(ctx context.Context) ([]TSIGKey, error) {
+	c, err := p.readClient(ctx)
+	if err != nil {
+		return nil, err
+	}
+	keys, err := c.TSIGKeys.List(ctx)
+	if err != nil {
+		return nil, wrapAPIError(err, "")
+	}
+	out := make([]TSIGKey, 0, len(keys))
+	for i := range keys {
+		out = append(out, tsigKeyOf(&keys[i]))
+	}
+	return out, nil
+}
+
+// DeleteTSIGKey removes the TSIG key with the given ID.  Zones that still
+// use it for transfers will fail to authenticate.
+func (p *Provider) DeleteTSIGKey(ctx context.Context, id string) error {
+	c, err := p.client(ctx)
+	if err != nil {
+		return err
+	}
+	return wrapAPIError(c.TSIGKeys.Delete(ctx, id), "")
+}
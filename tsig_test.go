@@ -0,0 +1,77 @@
+package powerdns
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/joeig/go-powerdns/v3"
+)
+
+func TestTSIGKeys(t *testing.T) {
+	ctx := context.Background()
+	var deleted string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch {
+		case r.Method == http.MethodPost && r.URL.Path == "/api/v1/servers/localhost/tsigkeys":
+			var req powerdns.TSIGKey
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			if *req.Algorithm != "hmac-sha256" {
+				w.WriteHeader(http.StatusUnprocessableEntity)
+				_, _ = w.Write([]byte(`{"error": "Unknown TSIG algorithm: ` + *req.Algorithm + `"}`))
+				return
+			}
+			if powerdns.StringValue(req.Key) != "" {
+				t.Errorf("the secret should be left to the server, got %q", *req.Key)
+			}
+			w.WriteHeader(http.StatusCreated)
+			_, _ = w.Write([]byte(`{"id": "xfr.", "name": "xfr", "algorithm": "hmac-sha256", "key": "c2VjcmV0", "type": "TSIGKey"}`))
+		case r.Method == http.MethodGet && r.URL.Path == "/api/v1/servers/localhost/tsigkeys":
+			_, _ = w.Write([]byte(`[{"id": "xfr.", "name": "xfr", "algorithm": "hmac-sha256", "key": "", "type": "TSIGKey"}]`))
+		case r.Method == http.MethodDelete && strings.HasPrefix(r.URL.Path, "/api/v1/servers/localhost/tsigkeys/"):
+			deleted = strings.TrimPrefix(r.URL.Path, "/api/v1/servers/localhost/tsigkeys/")
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+	p := &Provider{ServerURL: srv.URL, APIToken: "secret"}
+
+	key, err := p.CreateTSIGKey(ctx, "xfr", "hmac-sha256")
+	if err != nil {
+		t.Fatalf("CreateTSIGKey: %s", err)
+	}
+	if want := (TSIGKey{ID: "xfr.", Name: "xfr", Algorithm: "hmac-sha256", Key: "c2VjcmV0"}); key != want {
+		t.Errorf("have %#v want %#v", key, want)
+	}
+
+	_, err = p.CreateTSIGKey(ctx, "xfr", "hmac-foo")
+	if !errors.Is(err, ErrValidation) || !strings.Contains(err.Error(), "Unknown TSIG algorithm") {
+		t.Errorf("expected ErrValidation for an unknown algorithm, got %v", err)
+	}
+
+	keys, err := p.ListTSIGKeys(ctx)
+	if err != nil {
+		t.Fatalf("ListTSIGKeys: %s", err)
+	}
+	if want := []TSIGKey{{ID: "xfr.", Name: "xfr", Algorithm: "hmac-sha256"}}; !reflect.DeepEqual(keys, want) {
+		t.Errorf("have %#v want %#v", keys, want)
+	}
+
+	if err := p.DeleteTSIGKey(ctx, "xfr."); err != nil {
+		t.Fatalf("DeleteTSIGKey: %s", err)
+	}
+	if deleted != "xfr." {
+		t.Errorf("deleted %q", deleted)
+	}
+}
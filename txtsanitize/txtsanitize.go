@@ -63,3 +63,117 @@ func TXTSanitize(in string) string {
 	out.WriteByte('"')
 	return out.String()
 }
+
+// TXTUnsanitize is the read side of TXTSanitize: it turns TXT record data
+// as PowerDNS returns it back into the text that was written.  The data is
+// one or more quoted character strings.  Their surrounding quotes are
+// removed, escaped double quotes are unescaped, and the strings of a
+// record split into several are joined.  All other escape sequences, like
+// \\ or \195, are kept as they are, since TXTSanitize passes them through
+// unchanged as well.  Data that isn't made of quoted strings is returned
+// as is.
+//
+// Text read with TXTUnsanitize can be fed to TXTSanitize again to get the
+// same record data back.  The one ambiguity is text that is a single
+// quoted string including its quotes, which TXTSanitize takes to be quoted
+// already; it is read back without the quotes.
+func TXTUnsanitize(in string) string {
+	var out strings.Builder
+	rest := strings.TrimSpace(in)
+	if rest == "" {
+		return in
+	}
+	for rest != "" {
+		if rest[0] != '"' {
+			return in
+		}
+		end := -1
+		for i := 1; i < len(rest); i++ {
+			if rest[i] == '\\' && i+1 < len(rest) {
+				if rest[i+1] != '"' {
+					out.WriteByte('\\')
+				}
+				out.WriteByte(rest[i+1])
+				i++
+				continue
+			}
+			if rest[i] == '"' {
+				end = i
+				break
+			}
+			out.WriteByte(rest[i])
+		}
+		if end == -1 {
+			return in
+		}
+		rest = strings.TrimLeft(rest[end+1:], " \t")
+	}
+	return out.String()
+}
+
+// maxStringLength is the most a single DNS character string can hold
+const maxStringLength = 255
+
+// TXTSplit splits TXT record data as TXTSanitize returns it, a single
+// quoted string, into quoted strings of at most 255 bytes each, separated
+// by spaces, the way RFC 1035 requires for longer text.  Escape sequences
+// count as the one byte they stand for and are never split, and neither
+// are UTF-8 encoded characters.  Data of at most 255 bytes, or that isn't
+// a single quoted string, is returned as is.  TXTUnsanitize joins the
+// strings again.
+func TXTSplit(in string) string {
+	if len(in) < 2 || in[0] != '"' || in[len(in)-1] != '"' {
+		return in
+	}
+	contents := in[1 : len(in)-1]
+	var out strings.Builder
+	start, count := 0, 0
+	for i := 0; i < len(contents); {
+		// the next byte as written in the data: a plain byte, a \DDD
+		// decimal escape or a backslash escaped character
+		next := 1
+		if contents[i] == '\\' && i+1 < len(contents) {
+			next = 2
+			if isDecimalEscape(contents[i+1:]) {
+				next = 4
+			}
+		} else if contents[i] >= 0x80 {
+			// the whole UTF-8 sequence, which may not be split
+			for i+next < len(contents) && contents[i+next]&0xC0 == 0x80 {
+				next++
+			}
+		}
+		width := 1
+		if next > 1 && contents[i] != '\\' {
+			width = next
+		}
+		if count+width > maxStringLength {
+			if out.Len() > 0 {
+				out.WriteByte(' ')
+			}
+			out.WriteString(`"` + contents[start:i] + `"`)
+			start, count = i, 0
+		}
+		count += width
+		i += next
+	}
+	if start == 0 {
+		return in
+	}
+	out.WriteString(` "` + contents[start:] + `"`)
+	return out.String()
+}
+
+// isDecimalEscape reports whether s starts with the three digits of a
+// \DDD escape
+func isDecimalEscape(s string) bool {
+	if len(s) < 3 {
+		return false
+	}
+	for _, c := range []byte(s[:3]) {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
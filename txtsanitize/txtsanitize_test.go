@@ -1,6 +1,9 @@
 package txtsanitize
 
-import "testing"
+import (
+	"strings"
+	"testing"
+)
 
 func TestTXTSanitize(t *testing.T) {
 	for _, tst := range []struct {
@@ -64,7 +67,121 @@ func TestTXTSanitize(t *testing.T) {
 			if out != recycled {
 				t.Errorf("identity test failed: expected %s got %s", out, recycled)
 			}
+			// and that reading it back gives text that sanitizes the same
+			if read := TXTSanitize(TXTUnsanitize(out)); read != out {
+				t.Errorf("round trip failed: expected %s got %s", out, read)
+			}
+		})
+
+	}
+}
+
+func TestTXTUnsanitize(t *testing.T) {
+	for _, tst := range []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{
+			name:     "plain",
+			input:    `"This is text"`,
+			expected: `This is text`,
+		},
+		{
+			name:     "embedded quotes",
+			input:    `"that \"has embedded quoting\""`,
+			expected: `that "has embedded quoting"`,
+		},
+		{
+			name:     "escapes kept",
+			input:    `"ç is equal to \195\167, \\ is a backslash"`,
+			expected: `ç is equal to \195\167, \\ is a backslash`,
+		},
+		{
+			name:     "escaped backslash before a quote",
+			input:    `"a \\\" b"`,
+			expected: `a \\" b`,
+		},
+		{
+			name:     "split into several strings",
+			input:    `"v=DKIM1; k=rsa; p=MIIB" "IjANBgkq"`,
+			expected: `v=DKIM1; k=rsa; p=MIIBIjANBgkq`,
+		},
+		{
+			name:     "empty",
+			input:    `""`,
+			expected: ``,
+		},
+		{
+			name:     "not quoted",
+			input:    `bare text`,
+			expected: `bare text`,
+		},
+		{
+			name:     "unterminated",
+			input:    `"open`,
+			expected: `"open`,
+		},
+		{
+			name:     "junk after the string",
+			input:    `"a" b`,
+			expected: `"a" b`,
+		},
+	} {
+		t.Run(tst.name, func(t *testing.T) {
+			if out := TXTUnsanitize(tst.input); out != tst.expected {
+				t.Errorf("failed: expected %s got %s", tst.expected, out)
+			}
 		})
+	}
+}
 
+func TestTXTSplit(t *testing.T) {
+	a255 := strings.Repeat("a", 255)
+	for _, tst := range []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{
+			name:     "short",
+			input:    `"v=spf1 -all"`,
+			expected: `"v=spf1 -all"`,
+		},
+		{
+			name:     "exactly 255 bytes",
+			input:    `"` + a255 + `"`,
+			expected: `"` + a255 + `"`,
+		},
+		{
+			name:     "one byte over",
+			input:    `"` + a255 + `b"`,
+			expected: `"` + a255 + `" "b"`,
+		},
+		{
+			name:     "escapes count as one byte",
+			input:    `"` + strings.Repeat(`\"`, 255) + `\195"`,
+			expected: `"` + strings.Repeat(`\"`, 255) + `" "\195"`,
+		},
+		{
+			name:     "utf-8 characters stay whole",
+			input:    `"` + a255[1:] + `ç"`,
+			expected: `"` + a255[1:] + `" "ç"`,
+		},
+		{
+			name:     "not quoted",
+			input:    a255 + "b",
+			expected: a255 + "b",
+		},
+	} {
+		t.Run(tst.name, func(t *testing.T) {
+			out := TXTSplit(tst.input)
+			if out != tst.expected {
+				t.Errorf("failed: expected %s got %s", tst.expected, out)
+			}
+			if joined := TXTSanitize(TXTUnsanitize(out)); joined != tst.input && tst.input[0] == '"' {
+				t.Errorf("rejoining failed: expected %s got %s", tst.input, joined)
+			}
+		})
 	}
 }
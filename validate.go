@@ -0,0 +1,183 @@
+package powerdns
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/libdns/libdns"
+)
+
+// ValidateRecords checks the records for problems PowerDNS would reject
+// them for, or that would make them useless: malformed names and
+// addresses, invalid CAA flags and tags, inconsistent SVCB/HTTPS records,
+// TXT strings that are too long, TLSA and SSHFP data that isn't hex of
+// the right length, NAPTR records with both a regexp and a replacement,
+// malformed LOC coordinates and the like.  Unlike the write methods it
+// doesn't stop at the first problem; every problem found is returned, each
+// naming the offending record.  A nil result means no problems were found.
+//
+// Generic libdns.RR records are parsed first, so they get the same checks
+// as their typed counterparts.
+func ValidateRecords(records []libdns.Record) []error {
+	var errs []error
+	for i, rec := range records {
+		if rr, ok := rec.(libdns.RR); ok {
+			parsed, err := rr.Parse()
+			switch rr.Type {
+			case "TLSA", "SSHFP", "NAPTR":
+				parsed, err = parseRecord(rr)
+			}
+			if err != nil {
+				errs = append(errs, recordError(i, rr, err))
+				continue
+			}
+			rec = parsed
+		}
+		rr := rec.RR()
+		for _, err := range validateRecord(rec) {
+			errs = append(errs, recordError(i, rr, err))
+		}
+	}
+	return errs
+}
+
+func recordError(i int, rr libdns.RR, err error) error {
+	return fmt.Errorf("record %d (%s %s): %w", i, rr.Name, rr.Type, err)
+}
+
+// validateRecord returns the problems with a single record
+func validateRecord(rec libdns.Record) []error {
+	var errs []error
+	check := func(err error) {
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	check(validateName(rec.RR().Name, true))
+
+	switch r := rec.(type) {
+	case libdns.Address:
+		if !r.IP.IsValid() {
+			check(errors.New("missing IP address"))
+		}
+	case libdns.CNAME:
+		check(validateTarget("target", r.Target))
+	case libdns.NS:
+		check(validateTarget("target", r.Target))
+	case libdns.MX:
+		if r.Target == "." {
+			if r.Preference != 0 {
+				check(errors.New("a null MX must have preference 0"))
+			}
+		} else {
+			check(validateTarget("target", r.Target))
+		}
+	case libdns.SRV:
+		if r.Service == "" || r.Transport == "" {
+			check(errors.New("service and transport are required"))
+		}
+		if r.Target != "." {
+			check(validateTarget("target", r.Target))
+		}
+	case libdns.CAA:
+		if r.Flags != 0 && r.Flags != 128 {
+			check(fmt.Errorf("invalid CAA flags %d, expected 0 or 128", r.Flags))
+		}
+		check(validateCAATag(r.Tag))
+	case libdns.TXT:
+		// longer text is split into 255 byte strings, which together,
+		// with a length byte each, must fit the 65535 bytes of a record
+		if n := len(r.Text); n+(n+254)/255 > 65535 {
+			check(fmt.Errorf("TXT value is %d bytes, too long for a record", n))
+		}
+	case TLSA:
+		errs = append(errs, validateTLSA(r)...)
+	case SSHFP:
+		errs = append(errs, validateSSHFP(r)...)
+	case NAPTR:
+		errs = append(errs, validateNAPTR(r)...)
+	case libdns.RR:
+		if r.Type == "LOC" {
+			check(validateLOC(r.Data))
+		}
+	case libdns.ServiceBinding:
+		if r.Scheme == "" {
+			check(errors.New("missing scheme"))
+		}
+		if r.Target != "." {
+			check(validateTarget("target", r.Target))
+		}
+		if r.Priority == 0 && len(r.Params) > 0 {
+			check(errors.New("an AliasMode (priority 0) record must not have params"))
+		}
+		if _, err := ParseSVCBParams(r.Params); err != nil {
+			check(err)
+		}
+		for _, key := range r.Params["mandatory"] {
+			if _, ok := r.Params[key]; !ok {
+				check(fmt.Errorf("mandatory key %q is not set", key))
+			}
+		}
+	}
+	return errs
+}
+
+// validateTarget checks a domain name a record points to
+func validateTarget(what, name string) error {
+	if name == "" {
+		return fmt.Errorf("missing %s", what)
+	}
+	if err := validateName(name, false); err != nil {
+		return fmt.Errorf("invalid %s: %w", what, err)
+	}
+	return nil
+}
+
+// validateName checks the syntax of a domain name.  Owner names may be
+// relative, "@" for the apex, and start with a "*" wildcard label.
+func validateName(name string, owner bool) error {
+	if owner && (name == "" || name == "@") {
+		return nil
+	}
+	trimmed := strings.TrimSuffix(name, ".")
+	if trimmed == "" {
+		return fmt.Errorf("invalid name %q", name)
+	}
+	if len(trimmed) > 253 {
+		return fmt.Errorf("name %q is longer than 253 characters", name)
+	}
+	for i, label := range strings.Split(trimmed, ".") {
+		if owner && i == 0 && label == "*" {
+			continue
+		}
+		if label == "" || len(label) > 63 {
+			return fmt.Errorf("invalid label %q in name %q", label, name)
+		}
+		for _, ch := range label {
+			if !isNameChar(ch) {
+				return fmt.Errorf("invalid character %q in name %q", ch, name)
+			}
+		}
+	}
+	return nil
+}
+
+func isNameChar(ch rune) bool {
+	return ch == '-' || ch == '_' ||
+		(ch >= 'a' && ch <= 'z') || (ch >= 'A' && ch <= 'Z') || (ch >= '0' && ch <= '9')
+}
+
+// validateCAATag checks a CAA property tag, which RFC 8659 limits to 15
+// ASCII letters and digits
+func validateCAATag(tag string) error {
+	if tag == "" || len(tag) > 15 {
+		return fmt.Errorf("invalid CAA tag %q", tag)
+	}
+	for _, ch := range tag {
+		if !(ch >= 'a' && ch <= 'z') && !(ch >= 'A' && ch <= 'Z') && !(ch >= '0' && ch <= '9') {
+			return fmt.Errorf("invalid CAA tag %q", tag)
+		}
+	}
+	return nil
+}
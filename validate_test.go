@@ -0,0 +1,64 @@
+package powerdns
+
+import (
+	"net/netip"
+	"strings"
+	"testing"
+
+	"github.com/libdns/libdns"
+)
+
+func TestValidateRecords(t *testing.T) {
+	valid := []libdns.Record{
+		libdns.Address{Name: "www", IP: netip.MustParseAddr("192.0.2.1")},
+		libdns.Address{Name: "*.wild", IP: netip.MustParseAddr("2001:db8::1")},
+		libdns.CNAME{Name: "alias", Target: "www.example.org."},
+		libdns.MX{Name: "@", Preference: 10, Target: "mail.example.org."},
+		libdns.MX{Name: "nomail", Target: "."},
+		libdns.SRV{Service: "sip", Transport: "tcp", Name: "@", Port: 5060, Target: "sip.example.org."},
+		libdns.CAA{Name: "@", Flags: 128, Tag: "issue", Value: "letsencrypt.org"},
+		libdns.TXT{Name: "_acme-challenge", Text: "token"},
+		libdns.ServiceBinding{Name: "@", Scheme: "https", Priority: 1, Target: ".", Params: libdns.SvcParams{"alpn": {"h2"}}},
+		libdns.RR{Name: "mx", Type: "MX", Data: "20 backup.example.org."},
+	}
+	if errs := ValidateRecords(valid); errs != nil {
+		t.Errorf("valid records reported as invalid: %v", errs)
+	}
+
+	invalid := []libdns.Record{
+		libdns.Address{Name: "www"},
+		libdns.CNAME{Name: "bad..name", Target: "www.example.org."},
+		libdns.MX{Name: "@", Preference: 10, Target: "mail server"},
+		libdns.MX{Name: "nomail", Preference: 5, Target: "."},
+		libdns.CAA{Name: "@", Flags: 1, Tag: "is-sue", Value: "x"},
+		libdns.TXT{Name: "long", Text: strings.Repeat("a", 65300)},
+		libdns.ServiceBinding{Name: "@", Scheme: "https", Priority: 0, Target: "cdn.example.net.", Params: libdns.SvcParams{"port": {"x"}}},
+		libdns.RR{Name: "broken", Type: "MX", Data: "not a number"},
+	}
+	errs := ValidateRecords(invalid)
+	for _, want := range []string{
+		"record 0 (www A): missing IP address",
+		"record 1 (bad..name CNAME): invalid label",
+		"record 2 (@ MX): invalid target",
+		"record 3 (nomail MX): a null MX must have preference 0",
+		"record 4 (@ CAA): invalid CAA flags 1",
+		`record 4 (@ CAA): invalid CAA tag "is-sue"`,
+		"record 5 (long TXT): TXT value is 65300 bytes",
+		"record 6 (@ HTTPS): an AliasMode (priority 0) record must not have params",
+		`record 6 (@ HTTPS): invalid port "x"`,
+		"record 7 (broken MX)",
+	} {
+		found := false
+		for _, err := range errs {
+			if strings.HasPrefix(err.Error(), want) {
+				found = true
+			}
+		}
+		if !found {
+			t.Errorf("missing error %q in %v", want, errs)
+		}
+	}
+	if len(errs) != 10 {
+		t.Errorf("expected 10 errors, got %d: %v", len(errs), errs)
+	}
+}
@@ -0,0 +1,107 @@
+package powerdns
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/joeig/go-powerdns/v3"
+)
+
+// zoneSettings are the parts of a zone that rarely change and that the
+// provider needs to decide how to treat the zone.  Unlike the records they
+// may be cached, see Provider.ZoneCacheTTL.
+type zoneSettings struct {
+	kind      string
+	presigned bool
+
+	// apiRectify is nil until it is known whether the server rectifies
+	// the zone by itself, which may take an extra metadata request
+	apiRectify *bool
+}
+
+type cachedZone struct {
+	settings zoneSettings
+	expires  time.Time
+}
+
+func settingsOf(z *powerdns.Zone) zoneSettings {
+	s := zoneSettings{
+		kind:      zoneInfo(z).Kind,
+		presigned: powerdns.BoolValue(z.Presigned),
+	}
+	if powerdns.BoolValue(z.APIRectify) {
+		s.apiRectify = powerdns.Bool(true)
+	}
+	return s
+}
+
+// zoneSettings returns the settings of the zone, from the cache if they
+// are in it and fetching the zone otherwise.
+func (p *Provider) zoneSettings(ctx context.Context, c *client, zone string) (zoneSettings, error) {
+	if s, ok := p.cachedZone(zone); ok {
+		return s, nil
+	}
+	fullZone, err := c.getZone(ctx, zone)
+	if err != nil {
+		return zoneSettings{}, p.zoneError(zone, err)
+	}
+	s := settingsOf(fullZone)
+	p.rememberZone(zone, s)
+	return s, nil
+}
+
+func (p *Provider) cachedZone(zone string) (zoneSettings, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	entry, ok := p.zoneCache[CanonicalZone(zone)]
+	if !ok || time.Now().After(entry.expires) {
+		return zoneSettings{}, false
+	}
+	return entry.settings, true
+}
+
+// rememberZone puts the settings of the zone in the cache, if caching is
+// enabled.  A known API-RECTIFY state of the cached entry is kept unless s
+// carries one.
+func (p *Provider) rememberZone(zone string, s zoneSettings) {
+	if p.ZoneCacheTTL <= 0 {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.zoneCache == nil {
+		p.zoneCache = make(map[string]cachedZone)
+	}
+	key := CanonicalZone(zone)
+	if old, ok := p.zoneCache[key]; ok && s.apiRectify == nil && time.Now().Before(old.expires) {
+		s.apiRectify = old.settings.apiRectify
+	}
+	p.zoneCache[key] = cachedZone{settings: s, expires: time.Now().Add(p.ZoneCacheTTL)}
+}
+
+// zoneError drops the zone from the cache if err says it is gone, and
+// returns err.
+func (p *Provider) zoneError(zone string, err error) error {
+	if errors.Is(err, ErrZoneNotFound) {
+		p.InvalidateZoneCache(zone)
+	}
+	return err
+}
+
+// InvalidateZoneCache drops the cached settings of the zone, so the next
+// operation on it fetches them from the server again.  Use it after
+// changing the zone outside of the provider.
+func (p *Provider) InvalidateZoneCache(zone string) {
+	key := CanonicalZone(zone)
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	delete(p.zoneCache, key)
+}
+
+// InvalidateAllZoneCaches empties the zone cache.
+func (p *Provider) InvalidateAllZoneCaches() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.zoneCache = nil
+}
@@ -0,0 +1,87 @@
+package powerdns
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/joeig/go-powerdns/v3"
+	"github.com/libdns/libdns"
+)
+
+func TestZoneCache(t *testing.T) {
+	ctx := context.Background()
+	f := newFakePDNS(t)
+	f.AddZone("example.org.")
+	f.Zones["example.org."].Kind = powerdns.ZoneKindPtr(powerdns.MasterZoneKind)
+	p := f.provider()
+	p.ZoneCacheTTL = time.Minute
+
+	for range 3 {
+		if err := p.Notify(ctx, "example.org."); err != nil {
+			t.Fatalf("Notify: %s", err)
+		}
+	}
+	if n := f.CallCount("GET", "/zones/example.org."); n != 1 {
+		t.Errorf("expected the zone to be fetched once, got %d", n)
+	}
+
+	p.InvalidateZoneCache("Example.org")
+	if err := p.Notify(ctx, "example.org."); err != nil {
+		t.Fatalf("Notify: %s", err)
+	}
+	if n := f.CallCount("GET", "/zones/example.org."); n != 2 {
+		t.Errorf("expected a fetch after InvalidateZoneCache, got %d fetches", n)
+	}
+
+	// a changed kind is only noticed after invalidation
+	f.Zones["example.org."].Kind = powerdns.ZoneKindPtr(powerdns.SlaveZoneKind)
+	if err := p.Notify(ctx, "example.org."); err != nil {
+		t.Errorf("cached kind was not used: %s", err)
+	}
+	p.InvalidateAllZoneCaches()
+	if err := p.Notify(ctx, "example.org."); err == nil {
+		t.Errorf("expected the new kind to refuse NOTIFY after InvalidateAllZoneCaches")
+	}
+	if n := f.CallCount("GET", "/zones/example.org."); n != 3 {
+		t.Errorf("expected a fetch after InvalidateAllZoneCaches, got %d fetches", n)
+	}
+
+	// zones that disappear are dropped from the cache
+	f.Zones["example.org."].Kind = powerdns.ZoneKindPtr(powerdns.MasterZoneKind)
+	p.InvalidateAllZoneCaches()
+	if err := p.Notify(ctx, "example.org."); err != nil {
+		t.Fatalf("Notify: %s", err)
+	}
+	delete(f.Zones, "example.org.")
+	if err := p.Notify(ctx, "example.org."); err == nil {
+		t.Fatalf("expected an error for a deleted zone")
+	}
+	if _, ok := p.cachedZone("example.org."); ok {
+		t.Errorf("deleted zone is still cached")
+	}
+}
+
+func TestZoneCacheAPIRectify(t *testing.T) {
+	ctx := context.Background()
+	f := newFakePDNS(t)
+	f.AddZone("example.org.")
+	p := f.provider()
+	p.AutoRectify = true
+	p.ZoneCacheTTL = time.Minute
+
+	for i := range 3 {
+		if _, err := p.AppendRecords(ctx, "example.org.", []libdns.Record{
+			libdns.TXT{Name: "www", Text: fmt.Sprintf("hello %d", i)},
+		}); err != nil {
+			t.Fatalf("AppendRecords: %s", err)
+		}
+	}
+	if n := f.CallCount("GET", "/metadata/API-RECTIFY"); n != 1 {
+		t.Errorf("expected API-RECTIFY to be read once, got %d", n)
+	}
+	if n := f.CallCount("PUT", "/rectify"); n != 3 {
+		t.Errorf("expected a rectify per change, got %d", n)
+	}
+}
@@ -0,0 +1,858 @@
+package powerdns
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/netip"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/joeig/go-powerdns/v3"
+	"github.com/libdns/libdns"
+)
+
+// DeleteZone removes the zone and all of its records from the server.  If
+// the zone does not exist the returned error wraps ErrZoneNotFound, so
+// callers that only care about the zone being gone can treat that as
+// success.
+//
+// libdns has no interface for deleting zones, so this is specific to this
+// provider.
+func (p *Provider) DeleteZone(ctx context.Context, zone string) error {
+	zone = p.normalizeZone(zone)
+	c, err := p.client(ctx)
+	if err != nil {
+		return err
+	}
+	defer p.InvalidateZoneCache(zone)
+	return c.deleteZone(ctx, zone)
+}
+
+// CanonicalZone returns the form of a zone name that PowerDNS stores:
+// lowercase and fully qualified with a trailing dot.  "Example.ORG" and
+// "example.org." both become "example.org.".  Use it to key zones the way
+// this package does.
+func CanonicalZone(zone string) string {
+	return canonicalZone(strings.ToLower(strings.TrimSpace(zone)))
+}
+
+// ListZones returns all zones on the server.
+func (p *Provider) ListZones(ctx context.Context) ([]libdns.Zone, error) {
+	c, err := p.readClient(ctx)
+	if err != nil {
+		return nil, err
+	}
+	zones, err := c.Zones.List(ctx)
+	if err != nil {
+		return nil, c.checkSchema(ctx, wrapAPIError(err, ""))
+	}
+	out := make([]libdns.Zone, 0, len(zones))
+	for _, z := range zones {
+		out = append(out, libdns.Zone{Name: powerdns.StringValue(z.Name)})
+	}
+	return out, nil
+}
+
+// ListZonesWithDetails returns the settings of all zones on the server.
+// They come from the zone list in a single request, so unlike GetZoneInfo
+// no zone is fetched in full.  The list has no records, so neither has
+// ZoneInfo a record count.
+func (p *Provider) ListZonesWithDetails(ctx context.Context) ([]ZoneInfo, error) {
+	c, err := p.readClient(ctx)
+	if err != nil {
+		return nil, err
+	}
+	zones, err := c.Zones.List(ctx)
+	if err != nil {
+		return nil, c.checkSchema(ctx, wrapAPIError(err, ""))
+	}
+	out := make([]ZoneInfo, 0, len(zones))
+	for i := range zones {
+		out = append(out, zoneInfo(&zones[i]))
+	}
+	return out, nil
+}
+
+// ListZonesByAccount is ListZonesWithDetails for the zones of one account.
+// The server's zone list can't be filtered, so this is done here.
+func (p *Provider) ListZonesByAccount(ctx context.Context, account string) ([]ZoneInfo, error) {
+	zones, err := p.ListZonesWithDetails(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return slices.DeleteFunc(zones, func(z ZoneInfo) bool { return z.Account != account }), nil
+}
+
+// SetZoneAccount sets the account the zone belongs to; the empty string
+// clears it.
+func (p *Provider) SetZoneAccount(ctx context.Context, zone, account string) error {
+	zone = p.normalizeZone(zone)
+	c, err := p.client(ctx)
+	if err != nil {
+		return err
+	}
+	err = c.Zones.Change(ctx, zone, &powerdns.Zone{Account: powerdns.String(account)})
+	return p.zoneError(zone, wrapAPIError(err, zone))
+}
+
+// ZoneInfo describes a zone without its records.
+type ZoneInfo struct {
+	Name    string
+	Kind    string
+	Serial  uint32
+	Masters []string
+	DNSSEC  bool
+	Account string
+
+	// Catalog is the catalog zone this zone is a member of, if any.  It is
+	// only reported by PowerDNS 4.7 and later.
+	Catalog string
+}
+
+// GetZoneInfo returns the settings of the zone.  If the zone does not exist
+// the returned error wraps ErrZoneNotFound.
+func (p *Provider) GetZoneInfo(ctx context.Context, zone string) (ZoneInfo, error) {
+	zone = p.normalizeZone(zone)
+	c, err := p.readClient(ctx)
+	if err != nil {
+		return ZoneInfo{}, err
+	}
+	fullZone, err := c.getZone(ctx, zone)
+	if err != nil {
+		return ZoneInfo{}, err
+	}
+	return zoneInfo(fullZone), nil
+}
+
+// GetRawZone returns the zone as the underlying go-powerdns library
+// decodes it, including its rrsets, for callers that need fields this
+// package doesn't expose.  The type belongs to that library and may change
+// when this package updates it; prefer GetZoneInfo where it suffices.
+func (p *Provider) GetRawZone(ctx context.Context, zone string) (*powerdns.Zone, error) {
+	zone = p.normalizeZone(zone)
+	c, err := p.readClient(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return c.getZone(ctx, zone)
+}
+
+// GetZoneCatalog returns the catalog zone the zone is a member of, or the
+// empty string if it isn't in a catalog.  Catalog zones were added in
+// PowerDNS 4.7; on older servers the error wraps errors.ErrUnsupported.
+func (p *Provider) GetZoneCatalog(ctx context.Context, zone string) (string, error) {
+	zone = p.normalizeZone(zone)
+	c, err := p.readClient(ctx)
+	if err != nil {
+		return "", err
+	}
+	if err := c.requireVersion(ctx, "catalog zones", 4, 7); err != nil {
+		return "", err
+	}
+	info, err := p.GetZoneInfo(ctx, zone)
+	if err != nil {
+		return "", err
+	}
+	return info.Catalog, nil
+}
+
+// CreateCatalogMember makes zone a member of the catalog zone catalog, so
+// that PowerDNS lists it in the catalog for consumers to pick up.  The
+// catalog must be a Producer zone; members of a Consumer catalog are
+// managed by the server from the catalog it transfers.  Like
+// GetZoneCatalog this needs PowerDNS 4.7 or later.
+func (p *Provider) CreateCatalogMember(ctx context.Context, catalog, zone string) error {
+	catalog = p.normalizeZone(catalog)
+	zone = p.normalizeZone(zone)
+	c, err := p.client(ctx)
+	if err != nil {
+		return err
+	}
+	if err := c.requireVersion(ctx, "catalog zones", 4, 7); err != nil {
+		return err
+	}
+	settings, err := p.zoneSettings(ctx, c, catalog)
+	if err != nil {
+		return err
+	}
+	if !strings.EqualFold(settings.kind, string(powerdns.ProducerZoneKind)) {
+		return fmt.Errorf("zone %s is a %s zone, members can only be added to a Producer catalog", catalog, settings.kind)
+	}
+	defer p.InvalidateZoneCache(zone)
+	err = c.Zones.Change(ctx, zone, &powerdns.Zone{Catalog: powerdns.String(canonicalZone(catalog))})
+	return p.zoneError(zone, wrapAPIError(err, zone))
+}
+
+func zoneInfo(z *powerdns.Zone) ZoneInfo {
+	info := ZoneInfo{
+		Name:    powerdns.StringValue(z.Name),
+		Serial:  powerdns.Uint32Value(z.Serial),
+		Masters: z.Masters,
+		DNSSEC:  powerdns.BoolValue(z.DNSsec),
+		Account: powerdns.StringValue(z.Account),
+		Catalog: powerdns.StringValue(z.Catalog),
+	}
+	if z.Kind != nil {
+		info.Kind = string(*z.Kind)
+	}
+	return info
+}
+
+// CreateZoneOptions are the settings of a zone created by CreateZone.
+type CreateZoneOptions struct {
+	// Kind is one of Native, Master, Slave, Producer or Consumer.  If it
+	// is empty, Provider.DefaultZoneKind is used, or else Native.
+	Kind string
+
+	// Nameservers are put in the apex NS rrset.
+	Nameservers []string
+
+	// Masters are the primaries a Slave zone is transferred from.
+	Masters []string
+
+	// DNSSEC makes PowerDNS sign the zone with keys it manages.
+	DNSSEC bool
+
+	// Presigned marks a zone whose signatures are made outside of
+	// PowerDNS, e.g. when migrating a signed zone.  PowerDNS serves the
+	// RRSIGs it is given, so DNSSEC must be false and the zone is never
+	// rectified.
+	Presigned bool
+
+	// SOAEditAPI controls how the serial changes on API edits.
+	SOAEditAPI string
+
+	// Account is the account the zone belongs to, a free form tag
+	// PowerDNS keeps for the operator, e.g. for billing or access control.
+	// If it is empty, Provider.DefaultAccount is used.
+	Account string
+
+	// IfNotExists makes CreateZone succeed without changes when the zone
+	// is already on the server.  The existing zone is left as it is, even
+	// if its settings differ from these options.
+	IfNotExists bool
+}
+
+// CreateZone creates a new zone on the server.  If the zone already exists
+// the returned error wraps ErrZoneExists, unless opts.IfNotExists is set.
+func (p *Provider) CreateZone(ctx context.Context, zone string, opts CreateZoneOptions) error {
+	zone = p.normalizeZone(zone)
+	if opts.Presigned && opts.DNSSEC {
+		return fmt.Errorf("zone %s: a presigned zone is signed externally, DNSSEC must not be enabled as well", zone)
+	}
+	c, err := p.client(ctx)
+	if err != nil {
+		return err
+	}
+	kind := opts.Kind
+	if kind == "" {
+		kind = p.DefaultZoneKind
+	}
+	zoneKind, err := parseZoneKind(kind)
+	if err != nil {
+		return fmt.Errorf("zone %s: %w", zone, err)
+	}
+	newZone := &powerdns.Zone{
+		Name:        powerdns.String(canonicalZone(zone)),
+		Kind:        powerdns.ZoneKindPtr(zoneKind),
+		Nameservers: opts.Nameservers,
+		Masters:     opts.Masters,
+		DNSsec:      powerdns.Bool(opts.DNSSEC),
+		Presigned:   powerdns.Bool(opts.Presigned),
+	}
+	if opts.SOAEditAPI != "" {
+		newZone.SOAEditAPI = powerdns.String(opts.SOAEditAPI)
+	}
+	account := opts.Account
+	if account == "" {
+		account = p.DefaultAccount
+	}
+	if account != "" {
+		newZone.Account = powerdns.String(account)
+	}
+	_, err = c.Zones.Add(ctx, newZone)
+	err = wrapAPIError(err, "")
+	if opts.IfNotExists && errors.Is(err, ErrZoneExists) {
+		return nil
+	}
+	return err
+}
+
+// zoneKinds are the kinds of zone PowerDNS knows
+var zoneKinds = []powerdns.ZoneKind{
+	powerdns.NativeZoneKind,
+	powerdns.MasterZoneKind,
+	powerdns.SlaveZoneKind,
+	powerdns.ProducerZoneKind,
+	powerdns.ConsumerZoneKind,
+}
+
+// parseZoneKind returns the zone kind named by kind, in any case, with
+// Native for the empty string.
+func parseZoneKind(kind string) (powerdns.ZoneKind, error) {
+	if kind == "" {
+		return powerdns.NativeZoneKind, nil
+	}
+	for _, k := range zoneKinds {
+		if strings.EqualFold(kind, string(k)) {
+			return k, nil
+		}
+	}
+	return "", fmt.Errorf("invalid zone kind %q, expected one of Native, Master, Slave, Producer or Consumer", kind)
+}
+
+// RectifyZone makes PowerDNS recompute the DNSSEC ordering and auth data
+// of the zone, which is needed after changing a signed zone unless the
+// zone has API-RECTIFY set.  Rectifying a presigned zone would break its
+// external signatures, so that is refused.
+func (p *Provider) RectifyZone(ctx context.Context, zone string) error {
+	zone = p.normalizeZone(zone)
+	c, err := p.client(ctx)
+	if err != nil {
+		return err
+	}
+	settings, err := p.zoneSettings(ctx, c, zone)
+	if err != nil {
+		return err
+	}
+	if settings.presigned {
+		return fmt.Errorf("zone %s is presigned, refusing to rectify it", zone)
+	}
+	return p.zoneError(zone, c.rectify(ctx, zone))
+}
+
+// rectify sends the rectify request, which the powerdns.Client lacks
+func (c *client) rectify(ctx context.Context, zone string) error {
+	resp, err := c.doRaw(ctx, http.MethodPut, "zones/"+canonicalZone(zone)+"/rectify", nil, nil)
+	if err != nil {
+		return wrapAPIError(err, zone)
+	}
+	return resp.Body.Close()
+}
+
+// autoRectify rectifies the zone after a change if AutoRectify is set.
+// Presigned zones are skipped since rectifying them would break their
+// signatures, and so are zones with API-RECTIFY, which the server already
+// rectified as part of the change.
+func (p *Provider) autoRectify(ctx context.Context, c *client, zone *powerdns.Zone) error {
+	if !p.AutoRectify || powerdns.BoolValue(zone.Presigned) {
+		return nil
+	}
+	name := powerdns.StringValue(zone.Name)
+	settings := settingsOf(zone)
+	if settings.apiRectify == nil {
+		if cached, ok := p.cachedZone(name); ok {
+			settings.apiRectify = cached.apiRectify
+		}
+	}
+	if settings.apiRectify == nil {
+		settings.apiRectify = powerdns.Bool(c.apiRectifyMetadata(ctx, name))
+	}
+	p.rememberZone(name, settings)
+	if *settings.apiRectify {
+		return nil
+	}
+	if err := c.rectify(ctx, name); err != nil {
+		return fmt.Errorf("records of %s were changed, but rectifying failed: %w", name, err)
+	}
+	return nil
+}
+
+// apiRectifyMetadata reports whether the API-RECTIFY metadata of the zone
+// is set.  Not every version reports it in the api_rectify field of the
+// zone, so it is read when that field is false.  If it can't be read we
+// assume it is off and rectify as configured.
+func (c *client) apiRectifyMetadata(ctx context.Context, zone string) bool {
+	md, err := c.Metadata.Get(ctx, zone, powerdns.MetadataAPIRectify)
+	if err != nil || md == nil {
+		return false
+	}
+	return slices.Contains(md.Metadata, "1")
+}
+
+// Notify makes the server send a NOTIFY for the zone to its secondaries,
+// for instance after a batch of changes.  Only primary zones, those of
+// kind Master, Native or Producer, can be notified about.
+func (p *Provider) Notify(ctx context.Context, zone string) error {
+	zone = p.normalizeZone(zone)
+	c, err := p.client(ctx)
+	if err != nil {
+		return err
+	}
+	settings, err := p.zoneSettings(ctx, c, zone)
+	if err != nil {
+		return err
+	}
+	switch kind := settings.kind; powerdns.ZoneKind(kind) {
+	case powerdns.MasterZoneKind, powerdns.NativeZoneKind, powerdns.ProducerZoneKind:
+	default:
+		return fmt.Errorf("zone %s is of kind %s, only primary zones can send NOTIFY", zone, kind)
+	}
+	_, err = c.Zones.Notify(ctx, zone)
+	return p.zoneError(zone, wrapAPIError(err, zone))
+}
+
+// RetrieveZone makes the server transfer a secondary (Slave) zone from its
+// primaries right away instead of waiting for the next refresh.
+func (p *Provider) RetrieveZone(ctx context.Context, zone string) error {
+	zone = p.normalizeZone(zone)
+	c, err := p.client(ctx)
+	if err != nil {
+		return err
+	}
+	settings, err := p.zoneSettings(ctx, c, zone)
+	if err != nil {
+		return err
+	}
+	if kind := settings.kind; powerdns.ZoneKind(kind) != powerdns.SlaveZoneKind {
+		return fmt.Errorf("zone %s is of kind %s, only secondary (Slave) zones can be retrieved from a primary", zone, kind)
+	}
+	_, err = c.Zones.AxfrRetrieve(ctx, zone)
+	return p.zoneError(zone, wrapAPIError(err, zone))
+}
+
+// GetZonePrimaries returns the primaries a secondary (Slave or Consumer)
+// zone is transferred from.  Other zones have none, so for them the list
+// is empty.
+func (p *Provider) GetZonePrimaries(ctx context.Context, zone string) ([]string, error) {
+	info, err := p.GetZoneInfo(ctx, zone)
+	if err != nil {
+		return nil, err
+	}
+	if !isSecondary(info.Kind) {
+		return []string{}, nil
+	}
+	return info.Masters, nil
+}
+
+// SetZonePrimaries replaces the primaries a secondary (Slave or Consumer)
+// zone is transferred from, e.g. to fail over to another one.  Each is an
+// IP address, optionally with a port as in 192.0.2.1:5300 or
+// [2001:db8::1]:5300.  For other kinds of zone nothing is changed and an
+// error is returned.
+func (p *Provider) SetZonePrimaries(ctx context.Context, zone string, primaries []string) error {
+	zone = p.normalizeZone(zone)
+	if len(primaries) == 0 {
+		return fmt.Errorf("zone %s: a secondary zone needs at least one primary", zone)
+	}
+	for _, primary := range primaries {
+		if _, err := netip.ParseAddr(primary); err == nil {
+			continue
+		}
+		if _, err := netip.ParseAddrPort(primary); err != nil {
+			return fmt.Errorf("zone %s: invalid primary %q, expected an IP address with an optional port", zone, primary)
+		}
+	}
+	c, err := p.client(ctx)
+	if err != nil {
+		return err
+	}
+	settings, err := p.zoneSettings(ctx, c, zone)
+	if err != nil {
+		return err
+	}
+	if !isSecondary(settings.kind) {
+		return fmt.Errorf("zone %s is of kind %s, only secondary (Slave or Consumer) zones have primaries", zone, settings.kind)
+	}
+	err = c.Zones.Change(ctx, zone, &powerdns.Zone{Masters: primaries})
+	return p.zoneError(zone, wrapAPIError(err, zone))
+}
+
+// isSecondary reports whether zones of the kind are transferred from
+// primaries
+func isSecondary(kind string) bool {
+	return strings.EqualFold(kind, string(powerdns.SlaveZoneKind)) ||
+		strings.EqualFold(kind, string(powerdns.ConsumerZoneKind))
+}
+
+// ExportZone returns the zone in BIND zonefile format, as the server's
+// export endpoint produces it.
+func (p *Provider) ExportZone(ctx context.Context, zone string) ([]byte, error) {
+	zone = p.normalizeZone(zone)
+	c, err := p.readClient(ctx)
+	if err != nil {
+		return nil, err
+	}
+	export, err := c.Zones.Export(ctx, zone)
+	if err != nil {
+		return nil, wrapAPIError(err, zone)
+	}
+	return []byte(export), nil
+}
+
+// ZoneExport is a portable, JSON serializable definition of a zone, as
+// produced by ExportZoneDefinition and consumed by ImportZoneDefinition.
+type ZoneExport struct {
+	Name       string              `json:"name"`
+	Kind       string              `json:"kind"`
+	Masters    []string            `json:"masters,omitempty"`
+	Account    string              `json:"account,omitempty"`
+	SOAEdit    string              `json:"soa_edit,omitempty"`
+	SOAEditAPI string              `json:"soa_edit_api,omitempty"`
+	APIRectify bool                `json:"api_rectify,omitempty"`
+	DNSSEC     ZoneDNSSEC          `json:"dnssec"`
+	Metadata   map[string][]string `json:"metadata,omitempty"`
+	RRsets     []ExportRRset       `json:"rrsets"`
+}
+
+// ZoneDNSSEC is the DNSSEC configuration of an exported zone.  Private key
+// material is deliberately not part of it: importing a signed zone makes
+// PowerDNS generate fresh keys, so the DS records at the parent have to be
+// updated afterwards.
+type ZoneDNSSEC struct {
+	Enabled     bool   `json:"enabled"`
+	NSEC3Param  string `json:"nsec3param,omitempty"`
+	NSEC3Narrow bool   `json:"nsec3narrow,omitempty"`
+	Presigned   bool   `json:"presigned,omitempty"`
+}
+
+// ExportRRset is a single rrset of an exported zone.
+type ExportRRset struct {
+	Name     string          `json:"name"`
+	Type     string          `json:"type"`
+	TTL      uint32          `json:"ttl"`
+	Records  []ExportRecord  `json:"records"`
+	Comments []ExportComment `json:"comments,omitempty"`
+}
+
+// ExportRecord is a single record of an exported rrset.
+type ExportRecord struct {
+	Content  string `json:"content"`
+	Disabled bool   `json:"disabled,omitempty"`
+}
+
+// ExportComment is a comment attached to an exported rrset.
+type ExportComment struct {
+	Content    string `json:"content"`
+	Account    string `json:"account,omitempty"`
+	ModifiedAt uint64 `json:"modified_at,omitempty"`
+}
+
+// zoneFieldMetadata are the metadata kinds PowerDNS derives from zone
+// fields (or refuses to set through the metadata endpoint).  They travel
+// in the ZoneExport fields instead of its Metadata map.
+var zoneFieldMetadata = map[powerdns.MetadataKind]bool{
+	powerdns.MetadataAPIRectify:     true,
+	powerdns.MetadataAXFRMasterTSIG: true,
+	powerdns.MetadataLuaAXFRScript:  true,
+	powerdns.MetadataNSEC3Param:     true,
+	"NSEC3NARROW":                   true,
+	powerdns.MetadataPresigned:      true,
+	powerdns.MetadataSOAEdit:        true,
+	powerdns.MetadataSOAEditAPI:     true,
+	powerdns.MetadataTSIGAllowAXFR:  true,
+}
+
+// ExportZoneDefinition returns the complete definition of a zone: its kind,
+// settings, metadata, DNSSEC configuration and all rrsets.  Together with
+// ImportZoneDefinition this allows backing up and restoring zones as JSON.
+func (p *Provider) ExportZoneDefinition(ctx context.Context, zone string) (ZoneExport, error) {
+	zone = p.normalizeZone(zone)
+	c, err := p.readClient(ctx)
+	if err != nil {
+		return ZoneExport{}, err
+	}
+	fullZone, err := c.getZone(ctx, zone)
+	if err != nil {
+		return ZoneExport{}, err
+	}
+	metadata, err := c.Metadata.List(ctx, zone)
+	if err != nil {
+		return ZoneExport{}, c.checkSchema(ctx, wrapAPIError(err, zone))
+	}
+
+	def := ZoneExport{
+		Name:       powerdns.StringValue(fullZone.Name),
+		Masters:    fullZone.Masters,
+		Account:    powerdns.StringValue(fullZone.Account),
+		SOAEdit:    powerdns.StringValue(fullZone.SOAEdit),
+		SOAEditAPI: powerdns.StringValue(fullZone.SOAEditAPI),
+		APIRectify: powerdns.BoolValue(fullZone.APIRectify),
+		DNSSEC: ZoneDNSSEC{
+			Enabled:     powerdns.BoolValue(fullZone.DNSsec),
+			NSEC3Param:  powerdns.StringValue(fullZone.Nsec3Param),
+			NSEC3Narrow: powerdns.BoolValue(fullZone.Nsec3Narrow),
+			Presigned:   powerdns.BoolValue(fullZone.Presigned),
+		},
+		RRsets: make([]ExportRRset, 0, len(fullZone.RRsets)),
+	}
+	if fullZone.Kind != nil {
+		def.Kind = string(*fullZone.Kind)
+	}
+	for _, m := range metadata {
+		if m.Kind == nil || zoneFieldMetadata[*m.Kind] {
+			continue
+		}
+		if def.Metadata == nil {
+			def.Metadata = make(map[string][]string)
+		}
+		def.Metadata[string(*m.Kind)] = m.Metadata
+	}
+	for _, rrset := range fullZone.RRsets {
+		if rrset.Type == nil {
+			continue
+		}
+		ers := ExportRRset{
+			Name:    powerdns.StringValue(rrset.Name),
+			Type:    string(*rrset.Type),
+			TTL:     powerdns.Uint32Value(rrset.TTL),
+			Records: make([]ExportRecord, 0, len(rrset.Records)),
+		}
+		for _, r := range rrset.Records {
+			ers.Records = append(ers.Records, ExportRecord{
+				Content:  powerdns.StringValue(r.Content),
+				Disabled: powerdns.BoolValue(r.Disabled),
+			})
+		}
+		for _, cm := range rrset.Comments {
+			ers.Comments = append(ers.Comments, ExportComment{
+				Content:    powerdns.StringValue(cm.Content),
+				Account:    powerdns.StringValue(cm.Account),
+				ModifiedAt: powerdns.Uint64Value(cm.ModifiedAt),
+			})
+		}
+		def.RRsets = append(def.RRsets, ers)
+	}
+	return def, nil
+}
+
+// ImportZoneDefinition creates a zone from a definition produced by
+// ExportZoneDefinition.  The zone must not exist yet.
+func (p *Provider) ImportZoneDefinition(ctx context.Context, def ZoneExport) error {
+	def.Name = p.normalizeZone(def.Name)
+	c, err := p.client(ctx)
+	if err != nil {
+		return err
+	}
+
+	newZone := &powerdns.Zone{
+		Name:    powerdns.String(def.Name),
+		Masters: def.Masters,
+		// PowerDNS must not generate keys for a zone that is signed
+		// elsewhere, so presigned zones are created without DNSSEC
+		DNSsec:      powerdns.Bool(def.DNSSEC.Enabled && !def.DNSSEC.Presigned),
+		Nsec3Narrow: powerdns.Bool(def.DNSSEC.NSEC3Narrow),
+		Presigned:   powerdns.Bool(def.DNSSEC.Presigned),
+		APIRectify:  powerdns.Bool(def.APIRectify),
+		RRsets:      make([]powerdns.RRset, 0, len(def.RRsets)),
+	}
+	if def.Kind != "" {
+		newZone.Kind = powerdns.ZoneKindPtr(powerdns.ZoneKind(def.Kind))
+	}
+	if def.Account != "" {
+		newZone.Account = powerdns.String(def.Account)
+	}
+	if def.SOAEdit != "" {
+		newZone.SOAEdit = powerdns.String(def.SOAEdit)
+	}
+	if def.SOAEditAPI != "" {
+		newZone.SOAEditAPI = powerdns.String(def.SOAEditAPI)
+	}
+	if def.DNSSEC.NSEC3Param != "" {
+		newZone.Nsec3Param = powerdns.String(def.DNSSEC.NSEC3Param)
+	}
+	for _, ers := range def.RRsets {
+		rrset := powerdns.RRset{
+			Name:    powerdns.String(ers.Name),
+			Type:    powerdns.RRTypePtr(powerdns.RRType(ers.Type)),
+			TTL:     powerdns.Uint32(ers.TTL),
+			Records: make([]powerdns.Record, 0, len(ers.Records)),
+		}
+		for _, r := range ers.Records {
+			rrset.Records = append(rrset.Records, powerdns.Record{
+				Content:  powerdns.String(r.Content),
+				Disabled: powerdns.Bool(r.Disabled),
+			})
+		}
+		for _, cm := range ers.Comments {
+			comment := powerdns.Comment{Content: powerdns.String(cm.Content)}
+			if cm.Account != "" {
+				comment.Account = powerdns.String(cm.Account)
+			}
+			if cm.ModifiedAt != 0 {
+				comment.ModifiedAt = powerdns.Uint64(cm.ModifiedAt)
+			}
+			rrset.Comments = append(rrset.Comments, comment)
+		}
+		newZone.RRsets = append(newZone.RRsets, rrset)
+	}
+
+	if _, err := c.Zones.Add(ctx, newZone); err != nil {
+		return wrapAPIError(err, "")
+	}
+	for kind, values := range def.Metadata {
+		if _, err := c.Metadata.Set(ctx, def.Name, powerdns.MetadataKind(kind), values); err != nil {
+			return fmt.Errorf("restoring %s metadata of %s: %w", kind, def.Name, wrapAPIError(err, def.Name))
+		}
+	}
+	return nil
+}
+
+// GetZoneSerial returns the SOA serial the zone is served with.  For zones
+// with a SOA-EDIT setting that is the edited serial rather than the one
+// stored in the SOA record; if the server doesn't report a serial at all
+// it is read from the SOA record.
+func (p *Provider) GetZoneSerial(ctx context.Context, zone string) (uint32, error) {
+	zone = p.normalizeZone(zone)
+	c, err := p.readClient(ctx)
+	if err != nil {
+		return 0, err
+	}
+	fullZone, err := c.getZone(ctx, zone)
+	if err != nil {
+		return 0, err
+	}
+	if serial := powerdns.Uint32Value(fullZone.EditedSerial); serial != 0 {
+		return serial, nil
+	}
+	if serial := powerdns.Uint32Value(fullZone.Serial); serial != 0 {
+		return serial, nil
+	}
+	_, serial, err := soaSerialFields(fullZone, zone)
+	return serial, err
+}
+
+// BumpSerial increases the SOA serial of the zone without touching any
+// other record, for instance to make secondaries pick up the zone again.
+// The new serial follows the zone's SOA-EDIT-API setting: EPOCH uses the
+// current time, DEFAULT a YYYYMMDDnn date, and anything else simply adds
+// one.  The serial is never decreased.
+func (p *Provider) BumpSerial(ctx context.Context, zone string) error {
+	return p.updateSOA(ctx, zone, func([]string) {})
+}
+
+// SetSOAPrimary sets the primary nameserver (MNAME) in the SOA record of
+// the zone and increases the serial.
+func (p *Provider) SetSOAPrimary(ctx context.Context, zone, primaryNS string) error {
+	if primaryNS == "" {
+		return fmt.Errorf("zone %s: empty SOA primary nameserver", zone)
+	}
+	primaryNS = canonicalZone(primaryNS)
+	return p.updateSOA(ctx, zone, func(fields []string) {
+		fields[0] = primaryNS
+	})
+}
+
+// SetSOAHostmaster sets the responsible mailbox (RNAME) in the SOA record
+// of the zone and increases the serial.  email may be an address like
+// hostmaster@example.org, which is converted to the dotted SOA form.
+func (p *Provider) SetSOAHostmaster(ctx context.Context, zone, email string) error {
+	rname, err := emailToRName(email)
+	if err != nil {
+		return fmt.Errorf("zone %s: %w", zone, err)
+	}
+	return p.updateSOA(ctx, zone, func(fields []string) {
+		fields[1] = rname
+	})
+}
+
+// soaEditModes are the SOA-EDIT-API values PowerDNS knows
+var soaEditModes = []string{"DEFAULT", "INCREASE", "EPOCH", "SOA-EDIT", "SOA-EDIT-INCREASE"}
+
+// SetSOAEdit sets the SOA-EDIT-API metadata of the zone, which makes the
+// server change the serial on every edit through the API: DEFAULT,
+// INCREASE, EPOCH, SOA-EDIT or SOA-EDIT-INCREASE, in any case.  An unknown
+// mode is an error and nothing is sent.  An empty mode removes the
+// setting, so serials are only changed by hand.
+func (p *Provider) SetSOAEdit(ctx context.Context, zone, mode string) error {
+	if mode == "" {
+		return p.DeleteMetadata(ctx, zone, string(powerdns.MetadataSOAEditAPI))
+	}
+	upper := strings.ToUpper(mode)
+	if !slices.Contains(soaEditModes, upper) {
+		return fmt.Errorf("zone %s: invalid SOA-EDIT-API mode %q, expected one of %s", zone, mode, strings.Join(soaEditModes, ", "))
+	}
+	return p.SetMetadata(ctx, zone, string(powerdns.MetadataSOAEditAPI), []string{upper})
+}
+
+// emailToRName converts a mail address to the domain name form used in the
+// SOA RNAME field: the @ becomes a dot, and dots in the local part are
+// escaped so they aren't mistaken for label separators.  Input without an
+// @ is taken to be in that form already.
+func emailToRName(email string) (string, error) {
+	local, domain, ok := strings.Cut(email, "@")
+	if !ok {
+		if email == "" {
+			return "", fmt.Errorf("empty SOA hostmaster")
+		}
+		return canonicalZone(email), nil
+	}
+	if local == "" || domain == "" || strings.Contains(domain, "@") {
+		return "", fmt.Errorf("invalid SOA hostmaster address %q", email)
+	}
+	local = strings.ReplaceAll(local, `\`, `\\`)
+	local = strings.ReplaceAll(local, ".", `\.`)
+	return local + "." + canonicalZone(domain), nil
+}
+
+// updateSOA replaces the SOA record of the zone with one modified by edit,
+// which gets the seven SOA fields.  The serial is increased afterwards as
+// BumpSerial describes, since secondaries only notice a changed SOA with a
+// new serial.  It is written like any other change, so DryRun and
+// AutoRectify apply.
+func (p *Provider) updateSOA(ctx context.Context, zone string, edit func(fields []string)) error {
+	zone = p.normalizeZone(zone)
+	c, err := p.client(ctx)
+	if err != nil {
+		return err
+	}
+	fullZone, err := c.getZone(ctx, zone)
+	if err != nil {
+		return err
+	}
+	fields, serial, err := soaSerialFields(fullZone, zone)
+	if err != nil {
+		return err
+	}
+	edit(fields)
+	fields[2] = strconv.FormatUint(uint64(nextSerial(serial, powerdns.StringValue(fullZone.SOAEditAPI), time.Now())), 10)
+	soa := findRRset(fullZone, powerdns.StringValue(fullZone.Name), "SOA")
+	_, err = p.apply(ctx, c, zone, fullZone, nil, []rrsetChange{{
+		name:     powerdns.StringValue(soa.Name),
+		rrType:   "SOA",
+		ttl:      powerdns.Uint32Value(soa.TTL),
+		contents: []string{strings.Join(fields, " ")},
+		comments: soa.Comments,
+	}}, true)
+	return err
+}
+
+// soaSerialFields splits the apex SOA record of the zone into its fields
+// and parses the serial.
+func soaSerialFields(fullZone *powerdns.Zone, zone string) ([]string, uint32, error) {
+	soa := findRRset(fullZone, powerdns.StringValue(fullZone.Name), "SOA")
+	if soa == nil || len(soa.Records) == 0 {
+		return nil, 0, fmt.Errorf("zone %s has no SOA record", zone)
+	}
+	fields := strings.Fields(powerdns.StringValue(soa.Records[0].Content))
+	if len(fields) != 7 {
+		return nil, 0, fmt.Errorf("malformed SOA record in zone %s: %q", zone, powerdns.StringValue(soa.Records[0].Content))
+	}
+	serial, err := strconv.ParseUint(fields[2], 10, 32)
+	if err != nil {
+		return nil, 0, fmt.Errorf("malformed SOA serial in zone %s: %w", zone, err)
+	}
+	return fields, uint32(serial), nil
+}
+
+// nextSerial returns the serial following current under the given
+// SOA-EDIT-API kind.  Serial arithmetic wraps around as RFC 1982 permits.
+func nextSerial(current uint32, soaEditAPI string, now time.Time) uint32 {
+	next := current + 1
+	var candidate uint32
+	switch strings.ToUpper(soaEditAPI) {
+	case "EPOCH":
+		candidate = uint32(now.Unix())
+	case "DEFAULT":
+		y, m, d := now.UTC().Date()
+		candidate = uint32(y*1000000+int(m)*10000+d*100) + 1
+	}
+	if candidate > next {
+		return candidate
+	}
+	return next
+}
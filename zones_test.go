@@ -0,0 +1,770 @@
+package powerdns
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/joeig/go-powerdns/v3"
+	"github.com/libdns/libdns"
+)
+
+func TestCanonicalZone(t *testing.T) {
+	for _, in := range []string{"example.org", "example.org.", "Example.ORG", "EXAMPLE.ORG.", " example.org. "} {
+		if got := CanonicalZone(in); got != "example.org." {
+			t.Errorf("CanonicalZone(%q) = %q", in, got)
+		}
+	}
+	if got := CanonicalZone("."); got != "." {
+		t.Errorf("CanonicalZone of the root = %q", got)
+	}
+}
+
+func TestDeleteZone(t *testing.T) {
+	f := newFakePDNS(t)
+	f.AddZone("example.org.", rrset("example.org.", "NS", 3600, "ns1.example.org."))
+	p := f.provider()
+
+	if err := p.DeleteZone(context.Background(), "example.org."); err != nil {
+		t.Fatalf("deleting zone: %s", err)
+	}
+	if f.Zone("example.org.") != nil {
+		t.Errorf("zone still present after delete")
+	}
+
+	err := p.DeleteZone(context.Background(), "example.org.")
+	if !errors.Is(err, ErrZoneNotFound) {
+		t.Errorf("deleting missing zone: expected ErrZoneNotFound, got %v", err)
+	}
+}
+
+func TestZoneDefinitionRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	f := newFakePDNS(t)
+	www := rrset("www.example.org.", "A", 60, "127.0.0.1", "127.0.0.2")
+	www.Records[1].Disabled = powerdns.Bool(true)
+	www.Comments = []powerdns.Comment{{Content: powerdns.String("ticket 42"), Account: powerdns.String("ops"), ModifiedAt: powerdns.Uint64(1700000000)}}
+	f.AddZone("example.org.",
+		rrset("example.org.", "SOA", 3600, "ns1.example.org. hostmaster.example.org. 7 10800 3600 604800 3600"),
+		rrset("example.org.", "NS", 3600, "ns1.example.org.", "ns2.example.org."),
+		www,
+		rrset("example.org.", "TXT", 300, `"v=spf1 -all"`),
+	)
+	f.Metadata["example.org."] = map[string][]string{
+		"ALLOW-AXFR-FROM": {"192.0.2.0/24"},
+		"SOA-EDIT-API":    {"DEFAULT"},
+	}
+	p := f.provider()
+
+	def, err := p.ExportZoneDefinition(ctx, "example.org.")
+	if err != nil {
+		t.Fatalf("export: %s", err)
+	}
+	if def.Kind != "Native" || len(def.RRsets) != 4 {
+		t.Errorf("unexpected export: %#v", def)
+	}
+	if _, ok := def.Metadata["SOA-EDIT-API"]; ok {
+		t.Errorf("zone field metadata should not be exported as metadata")
+	}
+
+	// make sure the definition really is portable
+	raw, err := json.Marshal(def)
+	if err != nil {
+		t.Fatalf("marshal: %s", err)
+	}
+	var restored ZoneExport
+	if err := json.Unmarshal(raw, &restored); err != nil {
+		t.Fatalf("unmarshal: %s", err)
+	}
+
+	if err := p.DeleteZone(ctx, "example.org."); err != nil {
+		t.Fatalf("delete: %s", err)
+	}
+	if err := p.ImportZoneDefinition(ctx, restored); err != nil {
+		t.Fatalf("import: %s", err)
+	}
+
+	again, err := p.ExportZoneDefinition(ctx, "example.org.")
+	if err != nil {
+		t.Fatalf("second export: %s", err)
+	}
+	if !reflect.DeepEqual(def, again) {
+		t.Errorf("round trip mismatch:\nbefore %#v\nafter  %#v", def, again)
+	}
+}
+
+func TestNotify(t *testing.T) {
+	ctx := context.Background()
+	f := newFakePDNS(t)
+	f.AddZone("primary.org.")
+	f.Zones["primary.org."].Kind = powerdns.ZoneKindPtr(powerdns.MasterZoneKind)
+	f.AddZone("secondary.org.")
+	f.Zones["secondary.org."].Kind = powerdns.ZoneKindPtr(powerdns.SlaveZoneKind)
+	p := f.provider()
+
+	if err := p.Notify(ctx, "Primary.org"); err != nil {
+		t.Fatalf("Notify: %s", err)
+	}
+	if n := f.CallCount("PUT", "/zones/primary.org./notify"); n != 1 {
+		t.Errorf("expected one notify for primary.org., got %d", n)
+	}
+	if err := p.Notify(ctx, "secondary.org."); err == nil || !strings.Contains(err.Error(), "Slave") {
+		t.Errorf("expected an error naming the zone kind, got %v", err)
+	}
+	if n := f.CallCount("PUT", "/notify"); n != 1 {
+		t.Errorf("secondary zone was notified about")
+	}
+}
+
+func TestRetrieveZone(t *testing.T) {
+	ctx := context.Background()
+	f := newFakePDNS(t)
+	f.AddZone("secondary.org.")
+	f.Zones["secondary.org."].Kind = powerdns.ZoneKindPtr(powerdns.SlaveZoneKind)
+	f.Zones["secondary.org."].Masters = []string{"192.0.2.1"}
+	f.AddZone("native.org.")
+	p := f.provider()
+
+	if err := p.RetrieveZone(ctx, "secondary.org."); err != nil {
+		t.Fatalf("RetrieveZone: %s", err)
+	}
+	if n := f.CallCount("PUT", "/zones/secondary.org./axfr-retrieve"); n != 1 {
+		t.Errorf("expected one retrieve for secondary.org., got %d", n)
+	}
+	if err := p.RetrieveZone(ctx, "native.org."); err == nil || !strings.Contains(err.Error(), "Native") {
+		t.Errorf("expected an error naming the zone kind, got %v", err)
+	}
+	if n := f.CallCount("PUT", "/axfr-retrieve"); n != 1 {
+		t.Errorf("native zone was retrieved")
+	}
+	if err := p.RetrieveZone(ctx, "missing.org."); !errors.Is(err, ErrZoneNotFound) {
+		t.Errorf("expected ErrZoneNotFound, got %v", err)
+	}
+}
+
+func TestGetZonePrimaries(t *testing.T) {
+	ctx := context.Background()
+	f := newFakePDNS(t)
+	f.AddZone("secondary.org.")
+	f.Zones["secondary.org."].Kind = powerdns.ZoneKindPtr(powerdns.SlaveZoneKind)
+	f.Zones["secondary.org."].Masters = []string{"192.0.2.1", "[2001:db8::1]:5300"}
+	f.AddZone("native.org.")
+	f.Zones["native.org."].Masters = []string{"192.0.2.9"}
+	p := f.provider()
+
+	primaries, err := p.GetZonePrimaries(ctx, "secondary.org")
+	if err != nil || !reflect.DeepEqual(primaries, []string{"192.0.2.1", "[2001:db8::1]:5300"}) {
+		t.Errorf("GetZonePrimaries(secondary.org) = %q, %v", primaries, err)
+	}
+	primaries, err = p.GetZonePrimaries(ctx, "native.org.")
+	if err != nil || primaries == nil || len(primaries) != 0 {
+		t.Errorf("GetZonePrimaries(native.org) = %q, %v; expected an empty list", primaries, err)
+	}
+	if _, err := p.GetZonePrimaries(ctx, "missing.org."); !errors.Is(err, ErrZoneNotFound) {
+		t.Errorf("expected ErrZoneNotFound, got %v", err)
+	}
+}
+
+func TestSetZonePrimaries(t *testing.T) {
+	ctx := context.Background()
+	f := newFakePDNS(t)
+	f.AddZone("secondary.org.")
+	f.Zones["secondary.org."].Kind = powerdns.ZoneKindPtr(powerdns.SlaveZoneKind)
+	f.Zones["secondary.org."].Masters = []string{"192.0.2.1"}
+	f.AddZone("native.org.")
+	p := f.provider()
+
+	primaries := []string{"192.0.2.2", "192.0.2.3:5300", "[2001:db8::2]:5300", "2001:db8::3"}
+	if err := p.SetZonePrimaries(ctx, "secondary.org", primaries); err != nil {
+		t.Fatalf("SetZonePrimaries: %s", err)
+	}
+	if got := f.Zones["secondary.org."].Masters; !reflect.DeepEqual(got, primaries) {
+		t.Errorf("primaries sent = %q, want %q", got, primaries)
+	}
+
+	if err := p.SetZonePrimaries(ctx, "native.org.", []string{"192.0.2.2"}); err == nil || !strings.Contains(err.Error(), "Native") {
+		t.Errorf("expected an error naming the zone kind, got %v", err)
+	}
+	for _, bad := range [][]string{nil, {"ns1.example.org"}, {"192.0.2.2", "192.0.2.300"}, {"192.0.2.2:dns"}} {
+		if err := p.SetZonePrimaries(ctx, "secondary.org.", bad); err == nil {
+			t.Errorf("SetZonePrimaries(%q): expected an error", bad)
+		}
+	}
+	if n := f.CallCount("PUT", "/zones/native.org."); n != 0 {
+		t.Errorf("native.org. was changed")
+	}
+	if got := f.Zones["secondary.org."].Masters; !reflect.DeepEqual(got, primaries) {
+		t.Errorf("invalid primaries were stored: %q", got)
+	}
+}
+
+func TestExportZone(t *testing.T) {
+	f := newFakePDNS(t)
+	f.AddZone("example.org.",
+		rrset("example.org.", "SOA", 3600, "ns1.example.org. hostmaster.example.org. 7 10800 3600 604800 3600"),
+		rrset("example.org.", "NS", 3600, "ns1.example.org."),
+	)
+	p := f.provider()
+
+	out, err := p.ExportZone(context.Background(), "example.org.")
+	if err != nil {
+		t.Fatalf("ExportZone: %s", err)
+	}
+	for _, want := range []string{
+		"example.org.\t3600\tIN\tSOA\tns1.example.org. hostmaster.example.org. 7 10800 3600 604800 3600\n",
+		"example.org.\t3600\tIN\tNS\tns1.example.org.\n",
+	} {
+		if !strings.Contains(string(out), want) {
+			t.Errorf("export lacks %q:\n%s", want, out)
+		}
+	}
+	if _, err := p.ExportZone(context.Background(), "missing.org."); !errors.Is(err, ErrZoneNotFound) {
+		t.Errorf("expected ErrZoneNotFound, got %v", err)
+	}
+}
+
+func TestBumpSerial(t *testing.T) {
+	ctx := context.Background()
+	f := newFakePDNS(t)
+	f.AddZone("example.org.",
+		rrset("example.org.", "SOA", 3600, "ns1.example.org. hostmaster.example.org. 7 10800 3600 604800 3600"),
+		rrset("www.example.org.", "A", 60, "127.0.0.1"),
+	)
+	p := f.provider()
+	before, err := p.GetRecords(ctx, "example.org.")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := p.BumpSerial(ctx, "example.org."); err != nil {
+		t.Fatalf("BumpSerial: %s", err)
+	}
+	// the fake bumps the serial on every PATCH as well, so only check
+	// that it went up
+	if serial := powerdns.Uint32Value(f.Zone("example.org.").Serial); serial <= 7 {
+		t.Errorf("serial did not increase: %d", serial)
+	}
+	www := f.RRset("example.org.", "www.example.org.", "A")
+	if got := rrsetContents(www); !reflect.DeepEqual(got, []string{"127.0.0.1"}) {
+		t.Errorf("records changed: %v", got)
+	}
+	after, err := p.GetRecords(ctx, "example.org.")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(after) != len(before) {
+		t.Errorf("record count changed from %d to %d", len(before), len(after))
+	}
+}
+
+func TestGetZoneSerial(t *testing.T) {
+	ctx := context.Background()
+	f := newFakePDNS(t)
+	f.AddZone("example.org.",
+		rrset("example.org.", "SOA", 3600, "ns1.example.org. hostmaster.example.org. 7 10800 3600 604800 3600"),
+	)
+	p := f.provider()
+
+	serial, err := p.GetZoneSerial(ctx, "example.org.")
+	if err != nil || serial != 7 {
+		t.Fatalf("GetZoneSerial = %d, %v", serial, err)
+	}
+	if _, err := p.AppendRecords(ctx, "example.org.", []libdns.Record{
+		libdns.TXT{Name: "www", Text: "hello"},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if after, err := p.GetZoneSerial(ctx, "example.org."); err != nil || after <= serial {
+		t.Errorf("serial did not increase after an append: %d, %v", after, err)
+	}
+
+	// with SOA-EDIT the served serial is the edited one
+	f.Zones["example.org."].EditedSerial = powerdns.Uint32(2024030901)
+	if serial, err := p.GetZoneSerial(ctx, "example.org."); err != nil || serial != 2024030901 {
+		t.Errorf("GetZoneSerial with SOA-EDIT = %d, %v", serial, err)
+	}
+
+	// fall back to the SOA record if the server doesn't report a serial
+	f.Zones["example.org."].EditedSerial = nil
+	f.Zones["example.org."].Serial = nil
+	if serial, err := p.GetZoneSerial(ctx, "example.org."); err != nil || serial != 8 {
+		t.Errorf("GetZoneSerial from the SOA record = %d, %v", serial, err)
+	}
+}
+
+func TestSetSOAEdit(t *testing.T) {
+	ctx := context.Background()
+	f := newFakePDNS(t)
+	f.AddZone("example.org.")
+	p := f.provider()
+
+	if err := p.SetSOAEdit(ctx, "example.org.", "epoch"); err != nil {
+		t.Fatalf("SetSOAEdit: %s", err)
+	}
+	if got := f.Metadata["example.org."]["SOA-EDIT-API"]; !reflect.DeepEqual(got, []string{"EPOCH"}) {
+		t.Errorf("SOA-EDIT-API is %q", got)
+	}
+
+	before := f.CallCount(http.MethodPut, "/metadata/SOA-EDIT-API")
+	if err := p.SetSOAEdit(ctx, "example.org.", "YEARLY"); err == nil || !strings.Contains(err.Error(), "invalid SOA-EDIT-API mode") {
+		t.Errorf("expected an invalid mode error, got %v", err)
+	}
+	if f.CallCount(http.MethodPut, "/metadata/SOA-EDIT-API") != before {
+		t.Error("an invalid mode was sent to the server")
+	}
+
+	if err := p.SetSOAEdit(ctx, "example.org.", ""); err != nil {
+		t.Fatalf("SetSOAEdit: %s", err)
+	}
+	if _, ok := f.Metadata["example.org."]["SOA-EDIT-API"]; ok {
+		t.Error("SOA-EDIT-API is still set")
+	}
+}
+
+func TestSetSOAFields(t *testing.T) {
+	ctx := context.Background()
+	f := newFakePDNS(t)
+	f.AddZone("example.org.",
+		rrset("example.org.", "SOA", 3600, "ns1.example.org. hostmaster.example.org. 7 10800 3600 604800 3600"),
+	)
+	p := f.provider()
+
+	if err := p.SetSOAPrimary(ctx, "example.org.", "ns9.example.net"); err != nil {
+		t.Fatalf("SetSOAPrimary: %s", err)
+	}
+	if err := p.SetSOAHostmaster(ctx, "example.org.", "john.doe@example.net"); err != nil {
+		t.Fatalf("SetSOAHostmaster: %s", err)
+	}
+	fields := strings.Fields(rrsetContents(f.RRset("example.org.", "example.org.", "SOA"))[0])
+	if fields[0] != "ns9.example.net." || fields[1] != `john\.doe.example.net.` {
+		t.Errorf("unexpected SOA %v", fields)
+	}
+	if serial, _ := strconv.ParseUint(fields[2], 10, 32); serial <= 7 {
+		t.Errorf("serial was not increased: %d", serial)
+	}
+	if fields[3] != "10800" || fields[6] != "3600" {
+		t.Errorf("timers changed: %v", fields)
+	}
+}
+
+func TestEmailToRName(t *testing.T) {
+	for in, want := range map[string]string{
+		"hostmaster@example.org":  "hostmaster.example.org.",
+		"hostmaster@example.org.": "hostmaster.example.org.",
+		"john.doe@example.org":    `john\.doe.example.org.`,
+		"a.b.c@sub.example.org":   `a\.b\.c.sub.example.org.`,
+		"hostmaster.example.org":  "hostmaster.example.org.",
+		`john\.doe.example.org.`:  `john\.doe.example.org.`,
+		`back\slash@example.org`:  `back\\slash.example.org.`,
+	} {
+		got, err := emailToRName(in)
+		if err != nil || got != want {
+			t.Errorf("emailToRName(%q) = %q, %v, want %q", in, got, err, want)
+		}
+	}
+	for _, bad := range []string{"", "@example.org", "user@", "a@b@example.org"} {
+		if _, err := emailToRName(bad); err == nil {
+			t.Errorf("emailToRName(%q) should fail", bad)
+		}
+	}
+}
+
+func TestNextSerial(t *testing.T) {
+	now := time.Date(2024, 3, 9, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		current uint32
+		kind    string
+		want    uint32
+	}{
+		{7, "INCREASE", 8},
+		{7, "", 8},
+		{7, "DEFAULT", 2024030901},
+		{2024030905, "DEFAULT", 2024030906},
+		{7, "EPOCH", uint32(now.Unix())},
+		{uint32(now.Unix()) + 10, "EPOCH", uint32(now.Unix()) + 11},
+		{4294967295, "INCREASE", 0},
+	}
+	for _, tt := range tests {
+		if got := nextSerial(tt.current, tt.kind, now); got != tt.want {
+			t.Errorf("nextSerial(%d, %q) = %d, want %d", tt.current, tt.kind, got, tt.want)
+		}
+	}
+}
+
+func TestListZonesWithDetails(t *testing.T) {
+	var paths []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.Path)
+		if r.URL.Path != "/api/v1/servers/localhost/zones" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`[
+			{"id": "example.org.", "name": "example.org.", "kind": "Native", "serial": 2024010101, "dnssec": true, "account": "team-a"},
+			{"id": "example.net.", "name": "example.net.", "kind": "Slave", "serial": 7, "masters": ["192.0.2.53"], "dnssec": false, "account": ""}
+		]`))
+	}))
+	defer srv.Close()
+	p := &Provider{ServerURL: srv.URL, APIToken: "secret"}
+
+	zones, err := p.ListZonesWithDetails(context.Background())
+	if err != nil {
+		t.Fatalf("ListZonesWithDetails: %s", err)
+	}
+	want := []ZoneInfo{
+		{Name: "example.org.", Kind: "Native", Serial: 2024010101, DNSSEC: true, Account: "team-a"},
+		{Name: "example.net.", Kind: "Slave", Serial: 7, Masters: []string{"192.0.2.53"}},
+	}
+	if !reflect.DeepEqual(zones, want) {
+		t.Errorf("have %#v want %#v", zones, want)
+	}
+	if len(paths) != 1 {
+		t.Errorf("expected only the zone list to be fetched, got %q", paths)
+	}
+}
+
+func TestZoneAccount(t *testing.T) {
+	ctx := context.Background()
+	f := newFakePDNS(t)
+	f.AddZone("other.org.")
+	p := f.provider()
+
+	for _, zone := range []string{"a.example.", "b.example."} {
+		if err := p.CreateZone(ctx, zone, CreateZoneOptions{Account: "tenant-1"}); err != nil {
+			t.Fatalf("CreateZone: %s", err)
+		}
+	}
+	if got := powerdns.StringValue(f.Zones["a.example."].Account); got != "tenant-1" {
+		t.Errorf("account sent on create = %q", got)
+	}
+
+	// without an account the provider's default is used
+	p.DefaultAccount = "tenant-0"
+	if err := p.CreateZone(ctx, "c.example.", CreateZoneOptions{}); err != nil {
+		t.Fatalf("CreateZone: %s", err)
+	}
+	if got := powerdns.StringValue(f.Zones["c.example."].Account); got != "tenant-0" {
+		t.Errorf("default account sent on create = %q", got)
+	}
+	p.DefaultAccount = ""
+	delete(f.Zones, "c.example.")
+
+	zones, err := p.ListZonesWithDetails(ctx)
+	if err != nil {
+		t.Fatalf("ListZonesWithDetails: %s", err)
+	}
+	accounts := make(map[string]string)
+	for _, z := range zones {
+		accounts[z.Name] = z.Account
+	}
+	if want := map[string]string{"a.example.": "tenant-1", "b.example.": "tenant-1", "other.org.": ""}; !reflect.DeepEqual(accounts, want) {
+		t.Errorf("accounts read back %v, want %v", accounts, want)
+	}
+
+	if err := p.SetZoneAccount(ctx, "b.example.", "tenant-2"); err != nil {
+		t.Fatalf("SetZoneAccount: %s", err)
+	}
+	mine, err := p.ListZonesByAccount(ctx, "tenant-1")
+	if err != nil || len(mine) != 1 || mine[0].Name != "a.example." {
+		t.Errorf("ListZonesByAccount = %v, %v", mine, err)
+	}
+	if err := p.SetZoneAccount(ctx, "missing.example.", "x"); !errors.Is(err, ErrZoneNotFound) {
+		t.Errorf("expected ErrZoneNotFound, got %v", err)
+	}
+}
+
+func TestZoneCatalog(t *testing.T) {
+	ctx := context.Background()
+	f := newFakePDNS(t)
+	f.AddZone("member.org.", rrset("member.org.", "NS", 3600, "ns1.example.org."))
+	f.Zones["member.org."].Catalog = powerdns.String("catalog.example.")
+	f.AddZone("plain.org.", rrset("plain.org.", "NS", 3600, "ns1.example.org."))
+	p := f.provider()
+
+	info, err := p.GetZoneInfo(ctx, "member.org.")
+	if err != nil {
+		t.Fatalf("GetZoneInfo: %s", err)
+	}
+	if info.Catalog != "catalog.example." || info.Kind != "Native" {
+		t.Errorf("unexpected zone info %#v", info)
+	}
+	catalog, err := p.GetZoneCatalog(ctx, "member.org.")
+	if err != nil || catalog != "catalog.example." {
+		t.Errorf("GetZoneCatalog = %q, %v", catalog, err)
+	}
+	catalog, err = p.GetZoneCatalog(ctx, "plain.org.")
+	if err != nil || catalog != "" {
+		t.Errorf("GetZoneCatalog on a zone outside a catalog = %q, %v", catalog, err)
+	}
+	if _, err := p.GetZoneInfo(ctx, "missing.org."); !errors.Is(err, ErrZoneNotFound) {
+		t.Errorf("expected ErrZoneNotFound, got %v", err)
+	}
+
+	old := newFakePDNS(t)
+	old.Version = "4.6.3"
+	old.AddZone("member.org.")
+	if _, err := old.provider().GetZoneCatalog(ctx, "member.org."); !errors.Is(err, errors.ErrUnsupported) {
+		t.Errorf("expected ErrUnsupported on 4.6, got %v", err)
+	}
+}
+
+func TestCreateCatalogMember(t *testing.T) {
+	ctx := context.Background()
+	f := newFakePDNS(t)
+	f.AddZone("member.org.")
+	p := f.provider()
+	if err := p.CreateZone(ctx, "catalog.example.", CreateZoneOptions{Kind: "producer"}); err != nil {
+		t.Fatalf("CreateZone: %s", err)
+	}
+	if kind := *f.Zones["catalog.example."].Kind; kind != powerdns.ProducerZoneKind {
+		t.Errorf("catalog created as %s", kind)
+	}
+
+	if err := p.CreateCatalogMember(ctx, "catalog.example", "Member.org"); err != nil {
+		t.Fatalf("CreateCatalogMember: %s", err)
+	}
+	if got := powerdns.StringValue(f.Zones["member.org."].Catalog); got != "catalog.example." {
+		t.Errorf("member catalog = %q", got)
+	}
+	catalog, err := p.GetZoneCatalog(ctx, "member.org.")
+	if err != nil || catalog != "catalog.example." {
+		t.Errorf("GetZoneCatalog = %q, %v", catalog, err)
+	}
+
+	if err := p.CreateCatalogMember(ctx, "member.org.", "catalog.example."); err == nil {
+		t.Error("a Native zone should not be accepted as catalog")
+	}
+	if err := p.CreateCatalogMember(ctx, "catalog.example.", "missing.org."); !errors.Is(err, ErrZoneNotFound) {
+		t.Errorf("expected ErrZoneNotFound for a missing member, got %v", err)
+	}
+
+	old := newFakePDNS(t)
+	old.Version = "4.6.3"
+	old.AddZone("member.org.")
+	if err := old.provider().CreateCatalogMember(ctx, "catalog.example.", "member.org."); !errors.Is(err, errors.ErrUnsupported) {
+		t.Errorf("expected ErrUnsupported on 4.6, got %v", err)
+	}
+}
+
+func TestGetRawZone(t *testing.T) {
+	f := newFakePDNS(t)
+	f.AddZone("example.org.", rrset("example.org.", "NS", 3600, "ns1.example.org."))
+	f.Zones["example.org."].SOAEditAPI = powerdns.String("INCREASE")
+	p := f.provider()
+
+	z, err := p.GetRawZone(context.Background(), "example.org.")
+	if err != nil {
+		t.Fatalf("GetRawZone: %s", err)
+	}
+	if powerdns.StringValue(z.Name) != "example.org." || powerdns.StringValue(z.SOAEditAPI) != "INCREASE" || findRRset(z, "example.org.", "NS") == nil {
+		t.Errorf("unexpected zone %#v", z)
+	}
+	if _, err := p.GetRawZone(context.Background(), "missing.org."); !errors.Is(err, ErrZoneNotFound) {
+		t.Errorf("expected ErrZoneNotFound, got %v", err)
+	}
+}
+
+func TestCreateZoneExists(t *testing.T) {
+	ctx := context.Background()
+	f := newFakePDNS(t)
+	f.AddZone("example.org.", rrset("example.org.", "NS", 3600, "ns1.example.org."))
+	p := f.provider()
+
+	err := p.CreateZone(ctx, "example.org.", CreateZoneOptions{})
+	if !errors.Is(err, ErrZoneExists) {
+		t.Errorf("expected ErrZoneExists, got %v", err)
+	}
+	if err := p.CreateZone(ctx, "example.org.", CreateZoneOptions{IfNotExists: true, Kind: "Master"}); err != nil {
+		t.Errorf("CreateZone with IfNotExists on an existing zone: %s", err)
+	}
+	if z := f.Zone("example.org."); *z.Kind != powerdns.NativeZoneKind || findRRset(z, "example.org.", "NS") == nil {
+		t.Errorf("existing zone was changed: %#v", z)
+	}
+	if err := p.CreateZone(ctx, "new.org.", CreateZoneOptions{IfNotExists: true}); err != nil || f.Zone("new.org.") == nil {
+		t.Errorf("CreateZone with IfNotExists on a new zone: %v", err)
+	}
+
+	// older servers answer with a 422
+	if err := wrapAPIError(&powerdns.Error{StatusCode: http.StatusUnprocessableEntity, Message: "Domain 'example.org.' already exists"}, ""); !errors.Is(err, ErrZoneExists) {
+		t.Errorf("expected ErrZoneExists for a 422, got %v", err)
+	}
+}
+
+func TestDefaultZoneKind(t *testing.T) {
+	ctx := context.Background()
+	f := newFakePDNS(t)
+	p := f.provider()
+	p.DefaultZoneKind = "Primary"
+
+	if _, err := p.GetRecords(ctx, "example.org."); err == nil || !strings.Contains(err.Error(), "invalid zone kind") {
+		t.Errorf("expected an invalid zone kind error, got %v", err)
+	}
+	if err := p.CreateZone(ctx, "example.org.", CreateZoneOptions{}); err == nil {
+		t.Error("CreateZone with an invalid default kind succeeded")
+	}
+	f.Lock()
+	calls := len(f.Calls)
+	f.Unlock()
+	if calls != 0 {
+		t.Errorf("%d requests were sent with an invalid default kind", calls)
+	}
+
+	p = f.provider()
+	p.DefaultZoneKind = "master"
+	if err := p.CreateZone(ctx, "example.org.", CreateZoneOptions{}); err != nil {
+		t.Fatalf("CreateZone: %s", err)
+	}
+	if err := p.CreateZone(ctx, "native.org.", CreateZoneOptions{Kind: "Native"}); err != nil {
+		t.Fatalf("CreateZone: %s", err)
+	}
+	if kind := *f.Zone("example.org.").Kind; kind != powerdns.MasterZoneKind {
+		t.Errorf("zone created as %s, want Master", kind)
+	}
+	if kind := *f.Zone("native.org.").Kind; kind != powerdns.NativeZoneKind {
+		t.Errorf("an explicit kind was overridden: %s", kind)
+	}
+	if err := p.CreateZone(ctx, "bad.org.", CreateZoneOptions{Kind: "Hidden"}); err == nil || !strings.Contains(err.Error(), "invalid zone kind") {
+		t.Errorf("expected an invalid zone kind error, got %v", err)
+	}
+}
+
+func TestPresignedZoneIsNotRectified(t *testing.T) {
+	ctx := context.Background()
+	f := newFakePDNS(t)
+	p := f.provider()
+	p.AutoRectify = true
+
+	if err := p.CreateZone(ctx, "signed.org.", CreateZoneOptions{Presigned: true, DNSSEC: true}); err == nil {
+		t.Errorf("expected an error for a presigned zone with DNSSEC")
+	}
+	if err := p.CreateZone(ctx, "signed.org.", CreateZoneOptions{Presigned: true, Nameservers: []string{"ns1.example.net."}}); err != nil {
+		t.Fatalf("CreateZone: %s", err)
+	}
+	z := f.Zone("signed.org.")
+	if !powerdns.BoolValue(z.Presigned) || powerdns.BoolValue(z.DNSsec) {
+		t.Errorf("zone not created as presigned without DNSSEC: presigned=%v dnssec=%v", powerdns.BoolValue(z.Presigned), powerdns.BoolValue(z.DNSsec))
+	}
+
+	if _, err := p.AppendRecords(ctx, "signed.org.", []libdns.Record{
+		libdns.TXT{Name: "www", Text: "hello"},
+	}); err != nil {
+		t.Fatalf("AppendRecords: %s", err)
+	}
+	if err := p.RectifyZone(ctx, "signed.org."); err == nil {
+		t.Errorf("expected RectifyZone to refuse a presigned zone")
+	}
+	if n := f.CallCount("PUT", "/rectify"); n != 0 {
+		t.Errorf("presigned zone was rectified %d times", n)
+	}
+
+	// an imported presigned zone must not get PowerDNS managed keys either
+	def := ZoneExport{Name: "imported.org.", Kind: "Native", DNSSEC: ZoneDNSSEC{Enabled: true, Presigned: true}}
+	if err := p.ImportZoneDefinition(ctx, def); err != nil {
+		t.Fatalf("ImportZoneDefinition: %s", err)
+	}
+	if z := f.Zone("imported.org."); powerdns.BoolValue(z.DNSsec) || !powerdns.BoolValue(z.Presigned) {
+		t.Errorf("imported zone: presigned=%v dnssec=%v", powerdns.BoolValue(z.Presigned), powerdns.BoolValue(z.DNSsec))
+	}
+
+	// other zones are rectified as asked
+	if err := p.CreateZone(ctx, "plain.org.", CreateZoneOptions{}); err != nil {
+		t.Fatalf("CreateZone: %s", err)
+	}
+	if _, err := p.AppendRecords(ctx, "plain.org.", []libdns.Record{
+		libdns.TXT{Name: "www", Text: "hello"},
+	}); err != nil {
+		t.Fatalf("AppendRecords: %s", err)
+	}
+	if n := f.CallCount("PUT", "/zones/plain.org./rectify"); n != 1 {
+		t.Errorf("expected plain.org. to be rectified once, got %d", n)
+	}
+}
+
+func TestAPIRectifySkipsAutoRectify(t *testing.T) {
+	ctx := context.Background()
+	f := newFakePDNS(t)
+	f.AddZone("meta.org.")
+	f.Metadata["meta.org."] = map[string][]string{"API-RECTIFY": {"1"}}
+	f.AddZone("field.org.")
+	f.Zones["field.org."].APIRectify = powerdns.Bool(true)
+	f.AddZone("plain.org.")
+	f.Metadata["plain.org."] = map[string][]string{"API-RECTIFY": {"0"}}
+	p := f.provider()
+	p.AutoRectify = true
+
+	for _, zone := range []string{"meta.org.", "field.org.", "plain.org."} {
+		if _, err := p.AppendRecords(ctx, zone, []libdns.Record{
+			libdns.TXT{Name: "www", Text: "hello"},
+		}); err != nil {
+			t.Fatalf("AppendRecords to %s: %s", zone, err)
+		}
+	}
+	if n := f.CallCount("PUT", "/zones/meta.org./rectify"); n != 0 {
+		t.Errorf("zone with API-RECTIFY metadata was rectified %d times", n)
+	}
+	if n := f.CallCount("PUT", "/zones/field.org./rectify"); n != 0 {
+		t.Errorf("zone with api_rectify was rectified %d times", n)
+	}
+	if n := f.CallCount("PUT", "/zones/plain.org./rectify"); n != 1 {
+		t.Errorf("expected plain.org. to be rectified once, got %d", n)
+	}
+}
+
+func TestAutoRectifyCoversEveryRecordWrite(t *testing.T) {
+	ctx := context.Background()
+	f := newFakePDNS(t)
+	f.AddZone("example.org.",
+		rrset("example.org.", "SOA", 3600, "ns1.example.org. hostmaster.example.org. 7 10800 3600 604800 3600"),
+		rrset("www.example.org.", "A", 60, "192.0.2.1"),
+	)
+	p := f.provider()
+	p.AutoRectify = true
+
+	rectified := 0
+	for _, step := range []struct {
+		name      string
+		write     func() error
+		rectifies bool
+	}{
+		{"ReplaceZone", func() error {
+			_, err := p.ReplaceZone(ctx, "example.org.", []libdns.Record{
+				libdns.Address{Name: "www", IP: netip.MustParseAddr("192.0.2.2"), TTL: time.Minute},
+			})
+			return err
+		}, true},
+		{"ReplaceZone without changes", func() error {
+			_, err := p.ReplaceZone(ctx, "example.org.", []libdns.Record{
+				libdns.Address{Name: "www", IP: netip.MustParseAddr("192.0.2.2"), TTL: time.Minute},
+			})
+			return err
+		}, false},
+		{"SetRecordDisabled", func() error {
+			return p.SetRecordDisabled(ctx, "example.org.", "www", "A", true)
+		}, true},
+		{"SetRecordComment", func() error {
+			return p.SetRecordComment(ctx, "example.org.", "www", "A", "TICKET-42", "ops")
+		}, false},
+		{"BumpSerial", func() error {
+			return p.BumpSerial(ctx, "example.org.")
+		}, true},
+	} {
+		if err := step.write(); err != nil {
+			t.Fatalf("%s: %s", step.name, err)
+		}
+		if step.rectifies {
+			rectified++
+		}
+		if n := f.CallCount("PUT", "/zones/example.org./rectify"); n != rectified {
+			t.Errorf("after %s: rectified %d times, want %d", step.name, n, rectified)
+		}
+	}
+}